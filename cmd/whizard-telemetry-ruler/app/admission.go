@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/cache"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/emicklei/go-restful"
+	"github.com/golang/glog"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// validateRuleGroup is the validating admission webhook of ClusterRuleGroup and RuleGroup,
+// it rejects the group with invalid rules, the rules are validated with the loaded groups.
+func validateRuleGroup(req *restful.Request, resp *restful.Response) {
+
+	review := &admissionv1.AdmissionReview{}
+	if err := req.ReadEntity(review); err != nil || review.Request == nil {
+		responseWithHeaderAndEntity(resp, http.StatusBadRequest, fmt.Sprintf("invalid admission review, %v", err))
+		return
+	}
+
+	response := &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	if errs := admitRuleGroup(review.Request); len(errs) > 0 {
+		var ss []string
+		for _, e := range errs {
+			ss = append(ss, e.Error())
+		}
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: strings.Join(ss, "; "),
+		}
+		glog.Infof("reject %s %s/%s, %s", review.Request.Kind.Kind, review.Request.Namespace, review.Request.Name, response.Result.Message)
+	}
+
+	review.Response = response
+	review.Request = nil
+	responseWithHeaderAndEntity(resp, http.StatusOK, review)
+}
+
+func admitRuleGroup(req *admissionv1.AdmissionRequest) []error {
+
+	crgs := &v1alpha1.ClusterRuleGroupList{}
+	if err := cache.Cache().List(context.Background(), crgs); err != nil {
+		return []error{fmt.Errorf("failed to list cluster rule groups, %s", err)}
+	}
+	rgs := &v1alpha1.RuleGroupList{}
+	if err := cache.Cache().List(context.Background(), rgs); err != nil {
+		return []error{fmt.Errorf("failed to list rule groups, %s", err)}
+	}
+
+	// The group replaces the loaded one with the same name.
+	switch req.Kind.Kind {
+	case "ClusterRuleGroup":
+		crg := v1alpha1.ClusterRuleGroup{}
+		if err := json.Unmarshal(req.Object.Raw, &crg); err != nil {
+			return []error{err}
+		}
+
+		groups := []v1alpha1.ClusterRuleGroup{crg}
+		for _, item := range crgs.Items {
+			if item.Name != crg.Name || item.Namespace != crg.Namespace {
+				groups = append(groups, item)
+			}
+		}
+		return rule.ValidateGroup(crg.Name, groups, rgs.Items)
+	case "RuleGroup":
+		rg := v1alpha1.RuleGroup{}
+		if err := json.Unmarshal(req.Object.Raw, &rg); err != nil {
+			return []error{err}
+		}
+		if len(rg.Namespace) == 0 {
+			rg.Namespace = req.Namespace
+		}
+
+		groups := []v1alpha1.RuleGroup{rg}
+		for _, item := range rgs.Items {
+			if item.Name != rg.Name || item.Namespace != rg.Namespace {
+				groups = append(groups, item)
+			}
+		}
+		return rule.ValidateGroup(fmt.Sprintf("%s/%s", rg.Namespace, rg.Name), crgs.Items, groups)
+	default:
+		return []error{fmt.Errorf("unsupported kind %s", req.Kind.Kind)}
+	}
+}
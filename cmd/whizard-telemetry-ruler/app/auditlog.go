@@ -0,0 +1,430 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/metrics"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/golang/glog"
+)
+
+// The number of lines after which the checkpoint is saved when catching up with the audit log.
+const auditLogCheckpointLines = 1000
+
+var (
+	auditLogPath         string
+	auditLogCheckpoint   string
+	auditLogPollInterval time.Duration
+
+	tailer     *auditLogTailer
+	stopTailer sync.Once
+)
+
+// auditLogOffset is the checkpoint of the audit log, the file is identified by inode, so the
+// offset can be found after the file is rotated.
+type auditLogOffset struct {
+	Path   string `json:"path"`
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// auditLogTailer follows the JSON-lines audit log of kube-apiserver, and sends the audits to the workers.
+// The checkpoint is the offset of the first line whose audits are not processed by the workers yet, so the
+// delivery is at-least-once, the lines being processed when the ruler stops are read again after a restart.
+// The rotated file is read to the end before the new file is followed, and a truncated file is read from the start.
+type auditLogTailer struct {
+	path       string
+	checkpoint string
+	interval   time.Duration
+
+	file   *os.File
+	inode  uint64
+	offset int64
+	reader *bufio.Reader
+	// The last line which has not been ended when reading.
+	partial []byte
+	// The lines which are sent to the workers and not processed yet.
+	pending auditLogPending
+	// The checkpoint which is saved last.
+	saved auditLogOffset
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// startAuditLogTailer follow the audit log if --audit-log-path is set.
+func startAuditLogTailer() error {
+
+	if len(auditLogPath) == 0 {
+		return nil
+	}
+	if len(auditLogCheckpoint) == 0 {
+		return fmt.Errorf("--audit-log-checkpoint is required to follow the audit log %s", auditLogPath)
+	}
+
+	t := &auditLogTailer{
+		path:       auditLogPath,
+		checkpoint: auditLogCheckpoint,
+		interval:   auditLogPollInterval,
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+	if err := t.restore(); err != nil {
+		return err
+	}
+
+	tailer = t
+	go t.run()
+	glog.Infof("follow the audit log %s from offset %d", t.path, t.offset)
+	return nil
+}
+
+// stopAuditLogTailer stop following the audit log, and save the checkpoint.
+func stopAuditLogTailer() {
+	stopTailer.Do(func() {
+		if tailer != nil {
+			close(tailer.stopCh)
+			<-tailer.doneCh
+		}
+	})
+}
+
+// restore open the file and seek to the offset of the checkpoint. The audit log is followed from its end
+// if there is no checkpoint, so the history is not replayed when the source is enabled.
+func (t *auditLogTailer) restore() error {
+
+	cp := &auditLogOffset{}
+	data, err := ioutil.ReadFile(t.checkpoint)
+	switch {
+	case os.IsNotExist(err):
+		cp = nil
+	case err != nil:
+		return fmt.Errorf("failed to read the checkpoint %s, %s", t.checkpoint, err)
+	default:
+		if err := json.Unmarshal(data, cp); err != nil {
+			return fmt.Errorf("failed to decode the checkpoint %s, %s", t.checkpoint, err)
+		}
+		if cp.Path != t.path {
+			glog.Warningf("the checkpoint %s is of %s, the audit log %s is followed from the end", t.checkpoint, cp.Path, t.path)
+			cp = nil
+		}
+	}
+
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// The file will be read from the start when it is created.
+			return nil
+		}
+		return err
+	}
+
+	switch {
+	case cp == nil:
+		return t.open(t.path, fi.Size())
+	case inodeOf(fi) == cp.Inode:
+		if fi.Size() < cp.Offset {
+			glog.Warningf("the audit log %s is truncated, it is read from the start", t.path)
+			return t.open(t.path, 0)
+		}
+		return t.open(t.path, cp.Offset)
+	}
+
+	// The file is rotated when the ruler is down, the rotated file is read from the offset first.
+	if rotated := findByInode(filepath.Dir(t.path), cp.Inode); len(rotated) > 0 {
+		glog.Infof("the audit log %s is rotated to %s, it is read from offset %d", t.path, rotated, cp.Offset)
+		return t.open(rotated, cp.Offset)
+	}
+
+	glog.Warningf("the rotated audit log of %s is not found, the lines after offset %d of it are lost", t.path, cp.Offset)
+	return t.open(t.path, 0)
+}
+
+func (t *auditLogTailer) open(path string, offset int64) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if t.file != nil {
+		_ = t.file.Close()
+	}
+	t.file, t.inode, t.offset = f, inodeOf(fi), offset
+	t.reader = bufio.NewReader(f)
+	t.partial = nil
+	return nil
+}
+
+func (t *auditLogTailer) run() {
+
+	defer close(t.doneCh)
+	defer func() {
+		if t.file != nil {
+			_ = t.file.Close()
+		}
+	}()
+
+	for {
+		if t.file == nil {
+			if _, err := os.Stat(t.path); err == nil {
+				if err := t.open(t.path, 0); err != nil {
+					glog.Errorf("failed to open the audit log %s, %s", t.path, err)
+				}
+			}
+		}
+
+		n := 0
+		if t.file != nil {
+			n = t.read()
+			if n == 0 {
+				t.follow()
+			}
+		}
+
+		select {
+		case <-t.stopCh:
+			t.save()
+			return
+		default:
+		}
+
+		if n == 0 {
+			// The lines read before may be processed since the last save.
+			t.save()
+			select {
+			case <-t.stopCh:
+				t.save()
+				return
+			case <-time.After(t.interval):
+			}
+		}
+	}
+}
+
+// read send the complete lines until the end of file, and return the number of lines read.
+func (t *auditLogTailer) read() int {
+
+	n := 0
+	for {
+		line, err := t.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] != '\n' {
+				// The line is not ended yet, it is completed by the next read.
+				t.partial = append(t.partial, line...)
+			} else {
+				if len(t.partial) > 0 {
+					line = append(t.partial, line...)
+					t.partial = nil
+				}
+				t.send(line, t.offset)
+				t.offset += int64(len(line))
+				n++
+				if n%auditLogCheckpointLines == 0 {
+					t.save()
+				}
+			}
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				glog.Errorf("failed to read the audit log %s, %s", t.file.Name(), err)
+			}
+			break
+		}
+
+		select {
+		case <-t.stopCh:
+			t.save()
+			return n
+		default:
+		}
+	}
+
+	if n > 0 {
+		t.save()
+	}
+	return n
+}
+
+// follow check whether the file is rotated or truncated when the end of file is reached.
+func (t *auditLogTailer) follow() {
+
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		// The file is renamed and the new file is not created yet.
+		return
+	}
+
+	if inodeOf(fi) != t.inode {
+		// The lines written before the rotation are read first.
+		t.read()
+		glog.Infof("the audit log %s is rotated, follow the new file", t.path)
+		if err := t.open(t.path, 0); err != nil {
+			glog.Errorf("failed to open the audit log %s, %s", t.path, err)
+			t.file = nil
+			return
+		}
+		t.save()
+		return
+	}
+
+	if fi.Size() < t.offset {
+		glog.Warningf("the audit log %s is truncated, it is read from the start", t.path)
+		if err := t.open(t.path, 0); err != nil {
+			glog.Errorf("failed to open the audit log %s, %s", t.path, err)
+			t.file = nil
+			return
+		}
+		t.save()
+	}
+}
+
+// send decode the line at the offset and send the audit to the workers, the invalid line is skipped.
+func (t *auditLogTailer) send(line []byte, offset int64) {
+
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+
+	// The audit log has an audit event in every line.
+	audits, err := rule.NewAuditing(append(append([]byte{'['}, line...), ']'))
+	if err != nil {
+		metrics.EventsRejected.WithLabelValues(constant.Auditing, metrics.ReasonDecodeError).Inc()
+		return
+	}
+
+	receiveAudits(audits, t.pending.add(t.inode, offset, len(audits)))
+}
+
+// save write the checkpoint atomically.
+func (t *auditLogTailer) save() {
+
+	if t.file == nil {
+		return
+	}
+
+	cp := auditLogOffset{Path: t.path, Inode: t.inode, Offset: t.offset}
+	if l := t.pending.first(); l != nil {
+		cp.Inode, cp.Offset = l.inode, l.offset
+	}
+	if cp == t.saved {
+		return
+	}
+
+	data, err := json.Marshal(&cp)
+	if err != nil {
+		glog.Errorf("failed to encode the checkpoint of audit log, %s", err)
+		return
+	}
+
+	tmp := t.checkpoint + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		glog.Errorf("failed to write the checkpoint %s, %s", t.checkpoint, err)
+		return
+	}
+	if err := os.Rename(tmp, t.checkpoint); err != nil {
+		glog.Errorf("failed to write the checkpoint %s, %s", t.checkpoint, err)
+		return
+	}
+	t.saved = cp
+}
+
+// auditLogPending is the lines which are sent to the workers and not processed yet, in the order of the file.
+type auditLogPending struct {
+	sync.Mutex
+	lines []*auditLogLine
+}
+
+// auditLogLine is a line sent to the workers, with the number of its audits which are not processed yet.
+type auditLogLine struct {
+	inode     uint64
+	offset    int64
+	remaining int
+}
+
+// add record the line with n audits, and return the function which the workers call when an audit is processed.
+func (p *auditLogPending) add(inode uint64, offset int64, n int) func() {
+
+	if n == 0 {
+		return nil
+	}
+
+	l := &auditLogLine{inode: inode, offset: offset, remaining: n}
+	p.Lock()
+	p.lines = append(p.lines, l)
+	p.Unlock()
+
+	return func() {
+		p.Lock()
+		defer p.Unlock()
+		l.remaining--
+		for len(p.lines) > 0 && p.lines[0].remaining <= 0 {
+			p.lines[0] = nil
+			p.lines = p.lines[1:]
+		}
+	}
+}
+
+// first return the first line which is not processed, nil if all the lines are processed.
+func (p *auditLogPending) first() *auditLogLine {
+
+	p.Lock()
+	defer p.Unlock()
+	if len(p.lines) == 0 {
+		return nil
+	}
+	return p.lines[0]
+}
+
+// findByInode return the path of the file with the inode in the directory, empty if it is not found.
+func findByInode(dir string, inode uint64) string {
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil || inode == 0 {
+		return ""
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() && inodeOf(fi) == inode {
+			return filepath.Join(dir, fi.Name())
+		}
+	}
+
+	return ""
+}
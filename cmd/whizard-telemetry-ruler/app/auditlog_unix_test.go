@@ -0,0 +1,313 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"whizard-telemetry-ruler/pkg/rule"
+)
+
+// captureAudits replace the channel of workers, and return it.
+func captureAudits(t *testing.T) chan *rule.WhizardEvent {
+	saved := whizardChan
+	whizardChan = make(chan *rule.WhizardEvent, 100)
+	t.Cleanup(func() { whizardChan = saved })
+	return whizardChan
+}
+
+// received return the audits sent to the workers.
+func received(ch chan *rule.WhizardEvent) []*rule.WhizardEvent {
+	var es []*rule.WhizardEvent
+	for {
+		select {
+		case e := <-ch:
+			es = append(es, e)
+		default:
+			return es
+		}
+	}
+}
+
+func ids(es []*rule.WhizardEvent) []string {
+	var ids []string
+	for _, e := range es {
+		ids = append(ids, string(e.Auditing.AuditID))
+	}
+	return ids
+}
+
+func auditLine(id string) string {
+	return fmt.Sprintf(`{"auditID":%q,"verb":"get"}`, id) + "\n"
+}
+
+func appendFile(t *testing.T, path, s string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestTailer(dir string) *auditLogTailer {
+	return &auditLogTailer{
+		path:       filepath.Join(dir, "audit.log"),
+		checkpoint: filepath.Join(dir, "checkpoint"),
+	}
+}
+
+func readCheckpoint(t *testing.T, tailer *auditLogTailer) auditLogOffset {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(tailer.checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cp auditLogOffset
+	if err := json.Unmarshal(data, &cp); err != nil {
+		t.Fatal(err)
+	}
+	return cp
+}
+
+// processAll call the done of the audits, as the workers do after the audits are evaluated.
+func processAll(es []*rule.WhizardEvent) {
+	for _, e := range es {
+		if e.Done != nil {
+			e.Done()
+		}
+	}
+}
+
+func TestAuditLogPartialLine(t *testing.T) {
+
+	ch := captureAudits(t)
+	tailer := newTestTailer(t.TempDir())
+	appendFile(t, tailer.path, "")
+	if err := tailer.restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	line := auditLine("2")
+	appendFile(t, tailer.path, auditLine("1")+line[:10])
+	if n := tailer.read(); n != 1 {
+		t.Fatalf("read %d lines, want 1", n)
+	}
+	if got := ids(received(ch)); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("got audits %v, want [1]", got)
+	}
+	if tailer.offset != int64(len(auditLine("1"))) {
+		t.Errorf("offset: got %d, want the end of the first line", tailer.offset)
+	}
+
+	// The line is completed by the next write.
+	appendFile(t, tailer.path, line[10:])
+	if n := tailer.read(); n != 1 {
+		t.Fatalf("read %d lines, want 1", n)
+	}
+	if got := ids(received(ch)); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Fatalf("got audits %v, want [2]", got)
+	}
+	if want := int64(len(auditLine("1")) + len(line)); tailer.offset != want {
+		t.Errorf("offset: got %d, want %d", tailer.offset, want)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+
+	ch := captureAudits(t)
+	tailer := newTestTailer(t.TempDir())
+	appendFile(t, tailer.path, "")
+	if err := tailer.restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, tailer.path, auditLine("1"))
+	tailer.read()
+	inode := tailer.inode
+
+	// The line written before the rotation is read from the rotated file, then the new file is followed.
+	rotated := tailer.path + ".1"
+	if err := os.Rename(tailer.path, rotated); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, rotated, auditLine("2"))
+	appendFile(t, tailer.path, auditLine("3"))
+
+	tailer.follow()
+	if tailer.inode == inode || tailer.file.Name() != tailer.path {
+		t.Fatalf("got file %s with inode %d, want the new file", tailer.file.Name(), tailer.inode)
+	}
+	tailer.read()
+
+	es := received(ch)
+	if got := ids(es); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Fatalf("got audits %v, want [1 2 3]", got)
+	}
+
+	processAll(es)
+	tailer.save()
+	if cp := readCheckpoint(t, tailer); cp.Inode != tailer.inode || cp.Offset != int64(len(auditLine("3"))) {
+		t.Errorf("got checkpoint %+v, want the end of the new file", cp)
+	}
+}
+
+func TestAuditLogTruncation(t *testing.T) {
+
+	ch := captureAudits(t)
+	tailer := newTestTailer(t.TempDir())
+	appendFile(t, tailer.path, "")
+	if err := tailer.restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, tailer.path, auditLine("1")+auditLine("2"))
+	tailer.read()
+
+	if err := os.Truncate(tailer.path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, tailer.path, auditLine("3"))
+
+	tailer.follow()
+	if tailer.offset != 0 {
+		t.Fatalf("offset: got %d, want 0 after the truncation", tailer.offset)
+	}
+	tailer.read()
+	if got := ids(received(ch)); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Fatalf("got audits %v, want [1 2 3]", got)
+	}
+}
+
+func TestAuditLogCheckpoint(t *testing.T) {
+
+	ch := captureAudits(t)
+	dir := t.TempDir()
+	tailer := newTestTailer(dir)
+	appendFile(t, tailer.path, auditLine("0"))
+
+	// The audit log is followed from its end without checkpoint.
+	if err := tailer.restore(); err != nil {
+		t.Fatal(err)
+	}
+	start := int64(len(auditLine("0")))
+	if tailer.offset != start {
+		t.Fatalf("offset: got %d, want %d", tailer.offset, start)
+	}
+
+	appendFile(t, tailer.path, auditLine("1")+auditLine("2")+auditLine("3"))
+	tailer.read()
+	es := received(ch)
+	if got := ids(es); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Fatalf("got audits %v, want [1 2 3]", got)
+	}
+
+	// The checkpoint is the offset of the first line which is not processed, the audit 3 is processed
+	// before the audit 2.
+	es[0].Done()
+	es[2].Done()
+	tailer.save()
+	pending := start + int64(len(auditLine("1")))
+	cp := readCheckpoint(t, tailer)
+	if cp.Path != tailer.path || cp.Inode != tailer.inode || cp.Offset != pending {
+		t.Fatalf("got checkpoint %+v, want offset %d", cp, pending)
+	}
+
+	// The pending lines are read again after restarting.
+	_ = tailer.file.Close()
+	restarted := newTestTailer(dir)
+	if err := restarted.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.offset != pending {
+		t.Fatalf("restored offset: got %d, want %d", restarted.offset, pending)
+	}
+	restarted.read()
+	es = received(ch)
+	if got := ids(es); !reflect.DeepEqual(got, []string{"2", "3"}) {
+		t.Fatalf("got audits %v, want [2 3]", got)
+	}
+
+	processAll(es)
+	restarted.save()
+	end := pending + int64(len(auditLine("2"))+len(auditLine("3")))
+	if cp := readCheckpoint(t, restarted); cp.Offset != end {
+		t.Fatalf("got checkpoint %+v, want offset %d", cp, end)
+	}
+	_ = restarted.file.Close()
+
+	t.Run("rotated when down", func(t *testing.T) {
+		appendFile(t, tailer.path, auditLine("4"))
+		if err := os.Rename(tailer.path, tailer.path+".1"); err != nil {
+			t.Fatal(err)
+		}
+		appendFile(t, tailer.path, auditLine("5"))
+
+		restarted := newTestTailer(dir)
+		if err := restarted.restore(); err != nil {
+			t.Fatal(err)
+		}
+		defer restarted.file.Close()
+		if restarted.file.Name() != tailer.path+".1" || restarted.offset != end {
+			t.Fatalf("got file %s at offset %d, want the rotated file at offset %d", restarted.file.Name(), restarted.offset, end)
+		}
+
+		restarted.read()
+		restarted.follow()
+		restarted.read()
+		es := received(ch)
+		if got := ids(es); !reflect.DeepEqual(got, []string{"4", "5"}) {
+			t.Fatalf("got audits %v, want [4 5]", got)
+		}
+		processAll(es)
+		restarted.save()
+	})
+
+	t.Run("truncated when down", func(t *testing.T) {
+		if err := os.Truncate(tailer.path, 0); err != nil {
+			t.Fatal(err)
+		}
+		// The file is shorter than the offset of checkpoint.
+		appendFile(t, tailer.path, `{"auditID":"6"}`+"\n")
+
+		restarted := newTestTailer(dir)
+		if err := restarted.restore(); err != nil {
+			t.Fatal(err)
+		}
+		defer restarted.file.Close()
+		if restarted.offset != 0 {
+			t.Fatalf("offset: got %d, want 0", restarted.offset)
+		}
+		restarted.read()
+		if got := ids(received(ch)); !reflect.DeepEqual(got, []string{"6"}) {
+			t.Fatalf("got audits %v, want [6]", got)
+		}
+	})
+}
@@ -17,112 +17,47 @@ limitations under the License.
 package app
 
 import (
+	"time"
 	"whizard-telemetry-ruler/pkg/config"
 	"whizard-telemetry-ruler/pkg/exporter"
+	"whizard-telemetry-ruler/pkg/metrics"
 	"whizard-telemetry-ruler/pkg/rule"
-	"whizard-telemetry-ruler/pkg/utils"
 
 	"github.com/golang/glog"
-	"github.com/kubesphere/event-rule-engine/visitor"
 )
 
-func processAuditingEvent (a *rule.Auditing) {
+// processEvent evaluate the event with the rules, and export the alerts.
+func processEvent(e *rule.WhizardEvent) {
 
-	err := evaluateAuditingRule(a)
-	if err != nil {
-		glog.Errorf("match rule error %s", err)
-		return
-	}
-
-	if len(a.Message) > 0 {
-		go exporter.ExportAuditingAlerts(a)
-	}
-
-}
-
-func processKubeEvent(e *rule.Event) {
-	err := evaluateKubeEventRule(e)
-	if err != nil {
-		glog.Errorf("match rule error %s", err)
-		return
-	}
-
-	if len(e.Message) > 0 {
-		go exporter.ExportEventAlerts(e)
+	for _, alert := range evaluateEvent(config.GetConfig(), e, time.Now()) {
+		if len(alert.Message()) > 0 {
+			exporter.ExportAlert(alert)
+		}
 	}
 
 }
 
-func evaluateAuditingRule(a *rule.Auditing) error {
-
-	auditingMap, err := utils.StructToMap(a.Event)
-	if err != nil {
-		return err
-	}
-
-	flattenAuditing := utils.Flatten(auditingMap)
-	rs := config.GetConfig().Rules
-	severity := ""
-	for _, r := range rs {
-		if !r.Rule.Enable || r.Rule.Expr.Kind != rule.KindRule || r.GetEventType() != rule.AuditingType {
-			continue
-		}
-
-		if !r.SeverityHigherThan(severity)  {
-			continue
-		}
-
-		c, _ := r.GetCondition(rs)
-		err, ok := visitor.EventRuleEvaluate(flattenAuditing, c)
-		if err != nil {
-			glog.Errorf("match rule[%s] error %s", r.Name, err)
-			continue
-		}
+// evaluateEvent return an alert for every rule of the config selected by the match mode,
+// and every sequence rule completed, the event is evaluated at the time.
+func evaluateEvent(c *config.Config, e *rule.WhizardEvent, now time.Time) []*rule.WhizardEvent {
 
-		if ok {
-			// When the event matched multiple rules, the message is generated by the rule with the highest priority
-			a.Message, a.Annotations = r.GetAuditingAlertMessage(a, flattenAuditing, rs)
-			a.SetAlertRuleName(r.Name)
-			severity = r.Alerts.Severity
-		}
-	}
-
-	return nil
+	return rule.EvaluateEvent(c.RulesByType, c.Sequences, e, now, func(ev *rule.Evaluation) {
+		recordEvaluation(ev, now)
+	})
 }
 
-func evaluateKubeEventRule(e *rule.Event) error {
+// recordEvaluation record the evaluation of rule in metrics and the status of rule.
+func recordEvaluation(ev *rule.Evaluation, now time.Time) {
 
-	m, err := utils.StructToMap(e.Event)
-	if err != nil {
-		return err
+	r := ev.Rule
+	metrics.RuleEvaluations.WithLabelValues(r.Group, r.Name).Inc()
+	if ev.Err != nil {
+		glog.Errorf("match rule[%s] error %s", r.Name, ev.Err)
+		metrics.RuleEvaluationErrors.WithLabelValues(r.Group, r.Name).Inc()
 	}
 
-	fm := utils.Flatten(m)
-	rs := config.GetConfig().Rules
-	severity := ""
-	for _, r := range rs {
-		if !r.Enable || r.Rule.Expr.Kind != rule.KindRule || r.GetEventType() != rule.EventsType {
-			continue
-		}
-
-		if !r.SeverityHigherOrEqualTo(severity) {
-			continue
-		}
-
-		c, _ := r.GetCondition(rs)
-		err, ok := visitor.EventRuleEvaluate(fm, c)
-		if err != nil {
-			glog.Errorf("match rule[%s] error %s", r.Name, err)
-			continue
-		}
-
-		if ok {
-			// When the event matched multiple rules, the message is generated by the rule with the highest priority
-			e.Message, e.Annotations = r.GetEventAlertMessage(e, fm, rs)
-			e.SetAlertRuleName(r.Name)
-			severity = r.Alerts.Severity
-		}
+	if ev.Matched {
+		metrics.RuleMatches.WithLabelValues(r.Group, r.Name).Inc()
+		r.RecordMatch(now)
 	}
-
-	return nil
 }
@@ -0,0 +1,228 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/spf13/cobra"
+)
+
+// The output formats of lint.
+const (
+	lintOutputText  = "text"
+	lintOutputJSON  = "json"
+	lintOutputSARIF = "sarif"
+)
+
+// lintProblem is a problem with the file of its group.
+type lintProblem struct {
+	File string `json:"file"`
+	rule.Problem
+}
+
+// NewLintCommand return the command to analyse the rule files statically, without a Kubernetes connection.
+func NewLintCommand() *cobra.Command {
+
+	var output string
+	var checks []string
+	for _, c := range rule.LintChecks {
+		checks = append(checks, fmt.Sprintf("  %-22s %-8s %s", c.ID, c.Level, c.Description))
+	}
+
+	cmd := &cobra.Command{
+		Use:   "lint <rule-file>...",
+		Short: "Analyse the rules statically",
+		Long: `Analyse the ClusterRuleGroups and RuleGroups of the files statically, the rules of all files are
+loaded together so they can reference each other. It exits non-zero if any problem is an error.
+
+Checks:
+` + strings.Join(checks, "\n"),
+		Args:          cobra.MinimumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLint(cmd.OutOrStdout(), args, output)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", lintOutputText, "The output format, text, json or sarif")
+
+	return cmd
+}
+
+func runLint(out io.Writer, paths []string, output string) error {
+
+	switch output {
+	case lintOutputText, lintOutputJSON, lintOutputSARIF:
+	default:
+		return fmt.Errorf("unknown output %s, it should be %s, %s or %s", output, lintOutputText, lintOutputJSON, lintOutputSARIF)
+	}
+
+	// The files of groups, the files are loaded one by one to know where the groups are.
+	var groups []v1alpha1.ClusterRuleGroup
+	var namespaced []v1alpha1.RuleGroup
+	files := make(map[string]string)
+	for _, path := range paths {
+		crgs, rgs, err := loadRuleFiles([]string{path})
+		if err != nil {
+			return err
+		}
+		for _, g := range crgs {
+			files[g.Name] = path
+		}
+		for _, g := range rgs {
+			files[fmt.Sprintf("%s/%s", g.Namespace, g.Name)] = path
+		}
+		groups = append(groups, crgs...)
+		namespaced = append(namespaced, rgs...)
+	}
+
+	problems := make([]lintProblem, 0)
+	errs := 0
+	for _, p := range rule.Lint(groups, namespaced) {
+		problems = append(problems, lintProblem{File: files[p.Group], Problem: p})
+		if p.Level == rule.LevelError {
+			errs++
+		}
+	}
+
+	var err error
+	switch output {
+	case lintOutputJSON:
+		err = writeJSON(out, problems)
+	case lintOutputSARIF:
+		err = writeJSON(out, toSARIF(problems))
+	default:
+		for _, p := range problems {
+			name := p.Group
+			if len(p.Rule) > 0 {
+				name = fmt.Sprintf("%s.%s", p.Group, p.Rule)
+			}
+			fmt.Fprintf(out, "%s: %s: %s: %s [%s]\n", p.File, name, p.Level, p.Message, p.Check)
+		}
+		fmt.Fprintf(out, "%d problems (%d errors, %d warnings)\n", len(problems), errs, len(problems)-errs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("lint found %d errors", errs)
+	}
+
+	return nil
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// The subset of SARIF 2.1.0 which lint reports.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+func toSARIF(problems []lintProblem) *sarifLog {
+
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "whizard-telemetry-ruler"}},
+		Results: make([]sarifResult, 0, len(problems)),
+	}
+	for _, c := range rule.LintChecks {
+		r := sarifRule{ID: c.ID, ShortDescription: sarifMessage{Text: c.Description}}
+		r.DefaultConfiguration.Level = c.Level
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, r)
+	}
+
+	for _, p := range problems {
+		location := sarifLocation{}
+		location.PhysicalLocation.ArtifactLocation.URI = p.File
+		name := p.Group
+		if len(p.Rule) > 0 {
+			name = fmt.Sprintf("%s.%s", p.Group, p.Rule)
+		}
+		location.LogicalLocations = []sarifLogicalLocation{{FullyQualifiedName: name}}
+
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    p.Check,
+			Level:     p.Level,
+			Message:   sarifMessage{Text: p.Message},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	return &sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+}
@@ -0,0 +1,532 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"whizard-telemetry-ruler/pkg/config"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/exporter"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// The value of --send to print the alerts to stdout.
+const replaySendStdout = "stdout"
+
+// The width of the histogram bars in the text report.
+const replayBarWidth = 40
+
+type replayOptions struct {
+	ruleFiles  []string
+	eventType  string
+	bucket     time.Duration
+	samples    int
+	output     string
+	send       string
+	sinkConfig string
+}
+
+// replayReport is the result of replaying the events through the rules.
+type replayReport struct {
+	Events int        `json:"events"`
+	Alerts int        `json:"alerts"`
+	Start  *time.Time `json:"start,omitempty"`
+	End    *time.Time `json:"end,omitempty"`
+	// The number of malformed lines which are skipped.
+	Malformed int `json:"malformed"`
+	// The width of the buckets of histograms.
+	Bucket string              `json:"bucket"`
+	Rules  []*replayRuleReport `json:"rules"`
+
+	bucket time.Duration
+	// The reports of rules, the key is group.name.
+	index map[string]*replayRuleReport
+}
+
+// replayRuleReport is the alerts of a rule, the rules without alerts are reported too.
+type replayRuleReport struct {
+	Group    string `json:"group"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity,omitempty"`
+	Matches  int    `json:"matches"`
+	// The messages of the first alerts.
+	Samples []string `json:"samples,omitempty"`
+	// The number of alerts in every bucket, the empty buckets are omitted.
+	Histogram []replayBucket `json:"histogram,omitempty"`
+
+	buckets map[int64]int
+}
+
+type replayBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// replayAlert is an alert printed to stdout.
+type replayAlert struct {
+	Time        time.Time         `json:"time"`
+	Group       string            `json:"group"`
+	Rule        string            `json:"rule"`
+	Severity    string            `json:"severity,omitempty"`
+	Message     string            `json:"message"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NewReplayCommand return the command to backtest the rules with the events of files, without a Kubernetes connection.
+func NewReplayCommand() *cobra.Command {
+
+	o := &replayOptions{}
+	cmd := &cobra.Command{
+		Use:   "replay <event-file>...",
+		Short: "Backtest the rules with recorded events",
+		Long: `Replay the events of the files through the rules in the same way as the ruler, and report the alerts
+of every rule with sample messages and a time histogram. An event file can be the JSON-lines audit log of
+kube-apiserver, a dump of kubernetes events such as kubectl get events -o json, the JSON-lines logs, or the
+bodies which the webhooks receive, and - reads stdin. The events are evaluated at their own time, so the
+thresholds and sequences fire as they would have. The alerts can be sent to a receiver of the sink config,
+or printed to stdout as JSON lines, and then the report is written to stderr.`,
+		Args:          cobra.MinimumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReplay(cmd.OutOrStdout(), args, o)
+		},
+	}
+	cmd.Flags().StringSliceVarP(&o.ruleFiles, "rules", "r", nil, "The files of ClusterRuleGroups and RuleGroups")
+	cmd.Flags().StringVarP(&o.eventType, "type", "t", rule.AuditingType, "The type of events, auditing, events or logging")
+	cmd.Flags().DurationVar(&o.bucket, "bucket", time.Hour, "The width of the buckets of histograms")
+	cmd.Flags().IntVar(&o.samples, "samples", 3, "The number of sample messages of every rule")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "text", "The format of report, text or json")
+	cmd.Flags().StringVar(&o.send, "send", "", "Send the alerts to the receiver of the sink config with this name, or stdout to print them")
+	cmd.Flags().StringVar(&o.sinkConfig, "sink-config", "", "The file of the sink config, in the same format as the sink of the ruler ConfigMap")
+	_ = cmd.MarkFlagRequired("rules")
+	if f := flag.CommandLine.Lookup("match-mode"); f != nil {
+		cmd.Flags().AddFlag(pflag.PFlagFromGoFlag(f))
+	}
+
+	return cmd
+}
+
+func runReplay(out io.Writer, paths []string, o *replayOptions) error {
+
+	if err := rule.ValidateMatchMode(rule.GlobalMatchMode()); err != nil {
+		return err
+	}
+	if o.output != "text" && o.output != "json" {
+		return fmt.Errorf("unknown output %s, it should be text or json", o.output)
+	}
+	if o.bucket <= 0 {
+		return fmt.Errorf("the bucket must be greater than 0")
+	}
+
+	groups, namespaced, err := loadRuleFiles(o.ruleFiles)
+	if err != nil {
+		return err
+	}
+	rules := rule.BuildRules(groups, namespaced)
+	c := &config.Config{Rules: rules, RulesByType: rule.RulesByType(rules), Sequences: rule.Sequences(rules)}
+
+	var send func(e *rule.WhizardEvent, t time.Time) error
+	switch o.send {
+	case "":
+	case replaySendStdout:
+		encoder := json.NewEncoder(out)
+		send = func(e *rule.WhizardEvent, t time.Time) error {
+			return encoder.Encode(toReplayAlert(e, t))
+		}
+		// The report is written to stderr, so the alerts can be piped.
+		out = os.Stderr
+	default:
+		exp, err := replayExporter(o.sinkConfig, o.send)
+		if err != nil {
+			return err
+		}
+		send = func(e *rule.WhizardEvent, _ time.Time) error {
+			switch e.Kind {
+			case constant.Auditing:
+				return exp.ExportAuditingAlerts(e.Auditing)
+			case constant.Event:
+				return exp.ExportEventAlerts(e.Event)
+			default:
+				return exp.ExportLoggingAlerts(e.Logging)
+			}
+		}
+	}
+
+	report := newReplayReport(c, o.eventType, o.bucket)
+	var last time.Time
+	for _, path := range paths {
+		malformed, err := readReplayEvents(path, o.eventType, func(e *rule.WhizardEvent) error {
+			t := eventTime(e)
+			if t.IsZero() {
+				// The events without time are evaluated at the time of the previous event.
+				t = last
+			}
+			if t.IsZero() {
+				t = time.Now()
+			}
+			last = t
+
+			for _, alert := range evaluateEvent(c, e, t) {
+				report.add(alert, t, o.samples)
+				if send == nil {
+					continue
+				}
+				if err := send(alert, t); err != nil {
+					glog.Errorf("failed to send the alert of rule %s, %s", toReplayAlert(alert, t).Rule, err)
+				}
+			}
+			report.Events++
+			return nil
+		})
+		report.Malformed += malformed
+		if err != nil {
+			return err
+		}
+	}
+
+	report.finish()
+	if o.output == "json" {
+		return writeJSON(out, report)
+	}
+	report.print(out)
+	return nil
+}
+
+// replayExporter return the exporter of the receiver with the name in the sink config.
+func replayExporter(sinkConfig, name string) (exporter.Exporters, error) {
+
+	if len(sinkConfig) == 0 {
+		return nil, fmt.Errorf("--sink-config is required to send the alerts to receiver %s", name)
+	}
+	data, err := ioutil.ReadFile(sinkConfig)
+	if err != nil {
+		return nil, err
+	}
+	sink := &exporter.Sink{}
+	if err := yaml.Unmarshal(data, sink); err != nil {
+		return nil, fmt.Errorf("failed to decode %s, %s", sinkConfig, err)
+	}
+
+	for i := range sink.Receivers {
+		if sink.Receivers[i].ReceiverName == name {
+			return exporter.NewExporter(&sink.Receivers[i])
+		}
+	}
+
+	return nil, fmt.Errorf("receiver %s is not found in %s", name, sinkConfig)
+}
+
+// readReplayEvents decode the events of the file one by one, and return the number of malformed lines which are
+// skipped. The file is read line by line as JSON lines, a line is an event, an array of events, or an object with
+// the events in items, such as an EventList. A file whose first line is only { or [, such as the output of
+// kubectl get events -o json, is a stream of indented JSON values, which could not be read after a malformed value.
+func readReplayEvents(path, eventType string, handle func(e *rule.WhizardEvent) error) (int, error) {
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	handleValue := func(raw json.RawMessage) error {
+		for _, item := range replayItems(raw) {
+			es, err := rule.DecodeEvents(eventType, replayBody(eventType, item))
+			if err != nil {
+				glog.Errorf("skip the invalid event of %s, %s", path, err)
+				continue
+			}
+			for _, e := range es {
+				if err := handle(e); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	reader := bufio.NewReader(r)
+	malformed := 0
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return malformed, err
+		}
+
+		trimmed := bytes.TrimSpace(line)
+		if n == 1 && (bytes.Equal(trimmed, []byte("{")) || bytes.Equal(trimmed, []byte("["))) {
+			return malformed, readReplayStream(path, io.MultiReader(bytes.NewReader(line), reader), handleValue)
+		}
+
+		if len(trimmed) > 0 {
+			// A line may have several values.
+			decoder := json.NewDecoder(bytes.NewReader(trimmed))
+			for {
+				var raw json.RawMessage
+				if e := decoder.Decode(&raw); e == io.EOF {
+					break
+				} else if e != nil {
+					glog.Errorf("skip the malformed line %d of %s, %s", n, path, e)
+					malformed++
+					break
+				}
+				if e := handleValue(raw); e != nil {
+					return malformed, e
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return malformed, nil
+		}
+	}
+}
+
+// readReplayStream decode the JSON values of the stream, it stops at the first malformed value.
+func readReplayStream(path string, r io.Reader, handle func(raw json.RawMessage) error) error {
+
+	decoder := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to decode %s, %s", path, err)
+		}
+		if err := handle(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// replayItems return the events of a JSON value.
+func replayItems(raw json.RawMessage) []json.RawMessage {
+
+	var items []json.RawMessage
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		if err := json.Unmarshal(raw, &items); err == nil {
+			return items
+		}
+		return nil
+	}
+
+	list := struct {
+		Items []json.RawMessage `json:"items"`
+	}{}
+	if err := json.Unmarshal(raw, &list); err == nil && list.Items != nil {
+		return list.Items
+	}
+
+	return []json.RawMessage{raw}
+}
+
+// replayBody return the body which the webhook of the type receives for an event, the kubernetes event
+// is wrapped as the kube-events exporter does if it is not wrapped.
+func replayBody(eventType string, item json.RawMessage) []byte {
+
+	if eventType == rule.EventsType {
+		wrapped := struct {
+			Event json.RawMessage `json:"Event"`
+		}{}
+		if err := json.Unmarshal(item, &wrapped); err != nil || wrapped.Event == nil {
+			item, _ = json.Marshal(map[string]json.RawMessage{"Event": item})
+		}
+	}
+
+	return append(append([]byte("["), item...), ']')
+}
+
+// eventTime return the time when the event happened, zero if it is unknown.
+func eventTime(e *rule.WhizardEvent) time.Time {
+
+	switch e.Kind {
+	case constant.Auditing:
+		if !e.Auditing.StageTimestamp.IsZero() {
+			return e.Auditing.StageTimestamp.Time
+		}
+		return e.Auditing.RequestReceivedTimestamp.Time
+	case constant.Event:
+		ev := e.Event.Event
+		if ev == nil {
+			return time.Time{}
+		}
+		switch {
+		case !ev.LastTimestamp.IsZero():
+			return ev.LastTimestamp.Time
+		case !ev.EventTime.IsZero():
+			return ev.EventTime.Time
+		case !ev.FirstTimestamp.IsZero():
+			return ev.FirstTimestamp.Time
+		default:
+			return ev.CreationTimestamp.Time
+		}
+	case constant.Logging:
+		for _, key := range []string{"time", "@timestamp"} {
+			if s, ok := e.Logging.Log[key].(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					return t
+				}
+			}
+		}
+		// The date of Fluent Bit is the seconds since the epoch.
+		if f, ok := e.Logging.Log["date"].(float64); ok {
+			return time.Unix(0, int64(f*float64(time.Second)))
+		}
+	}
+
+	return time.Time{}
+}
+
+func toReplayAlert(e *rule.WhizardEvent, t time.Time) *replayAlert {
+
+	a := &replayAlert{Time: t}
+	switch e.Kind {
+	case constant.Auditing:
+		a.Group, a.Rule, a.Severity = e.Auditing.GetAlertRuleGroup(), e.Auditing.GetAlertRuleName(), e.Auditing.GetAlertSeverity()
+		a.Message, a.Annotations = e.Auditing.Message, e.Auditing.Annotations
+	case constant.Event:
+		a.Group, a.Rule, a.Severity = e.Event.GetAlertRuleGroup(), e.Event.GetAlertRuleName(), e.Event.GetAlertSeverity()
+		a.Message, a.Annotations = e.Event.Message, e.Event.Annotations
+	case constant.Logging:
+		a.Group, a.Rule, a.Severity = e.Logging.GetAlertRuleGroup(), e.Logging.GetAlertRuleName(), e.Logging.GetAlertSeverity()
+		a.Message, a.Annotations = e.Logging.Message, e.Logging.Annotations
+	}
+
+	return a
+}
+
+// newReplayReport return the report with the enabled rules of the type and the sequence rules.
+func newReplayReport(c *config.Config, eventType string, bucket time.Duration) *replayReport {
+
+	report := &replayReport{Bucket: bucket.String(), bucket: bucket, index: make(map[string]*replayRuleReport)}
+	rs := append(append([]*rule.Rule{}, c.RulesByType[eventType]...), c.Sequences...)
+	for _, r := range rs {
+		rr := &replayRuleReport{
+			Group:    r.Group,
+			Rule:     r.Name,
+			Severity: r.Alerts.Severity,
+			buckets:  make(map[int64]int),
+		}
+		report.Rules = append(report.Rules, rr)
+		report.index[fmt.Sprintf("%s.%s", r.Group, r.Name)] = rr
+	}
+
+	return report
+}
+
+func (r *replayReport) add(e *rule.WhizardEvent, t time.Time, samples int) {
+
+	a := toReplayAlert(e, t)
+	rr, ok := r.index[fmt.Sprintf("%s.%s", a.Group, a.Rule)]
+	if !ok {
+		return
+	}
+
+	r.Alerts++
+	if r.Start == nil || t.Before(*r.Start) {
+		start := t
+		r.Start = &start
+	}
+	if r.End == nil || t.After(*r.End) {
+		end := t
+		r.End = &end
+	}
+
+	rr.Matches++
+	if len(rr.Samples) < samples {
+		rr.Samples = append(rr.Samples, a.Message)
+	}
+	rr.buckets[t.Truncate(r.bucket).Unix()]++
+}
+
+// finish sort the rules by matches, and build the histograms.
+func (r *replayReport) finish() {
+
+	for _, rr := range r.Rules {
+		var starts []int64
+		for start := range rr.buckets {
+			starts = append(starts, start)
+		}
+		sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+		for _, start := range starts {
+			rr.Histogram = append(rr.Histogram, replayBucket{Start: time.Unix(start, 0).UTC(), Count: rr.buckets[start]})
+		}
+	}
+
+	sort.SliceStable(r.Rules, func(i, j int) bool {
+		return r.Rules[i].Matches > r.Rules[j].Matches
+	})
+}
+
+func (r *replayReport) print(out io.Writer) {
+
+	fmt.Fprintf(out, "Replayed %d events, %d alerts", r.Events, r.Alerts)
+	if r.Start != nil {
+		fmt.Fprintf(out, " from %s to %s", r.Start.UTC().Format(time.RFC3339), r.End.UTC().Format(time.RFC3339))
+	}
+	if r.Malformed > 0 {
+		fmt.Fprintf(out, ", %d malformed lines are skipped", r.Malformed)
+	}
+	fmt.Fprintf(out, "\n\n")
+
+	for _, rr := range r.Rules {
+		fmt.Fprintf(out, "%s.%s (%s): %d matches\n", rr.Group, rr.Rule, rr.Severity, rr.Matches)
+		if rr.Matches == 0 {
+			fmt.Fprintln(out)
+			continue
+		}
+
+		fmt.Fprintf(out, "  samples:\n")
+		for _, s := range rr.Samples {
+			fmt.Fprintf(out, "    %s\n", s)
+		}
+
+		max := 0
+		for _, b := range rr.Histogram {
+			if b.Count > max {
+				max = b.Count
+			}
+		}
+		fmt.Fprintf(out, "  histogram (%s):\n", r.Bucket)
+		for _, b := range rr.Histogram {
+			width := (b.Count*replayBarWidth + max - 1) / max
+			fmt.Fprintf(out, "    %s %s %d\n", b.Start.Format(time.RFC3339), strings.Repeat("#", width), b.Count)
+		}
+		fmt.Fprintln(out)
+	}
+}
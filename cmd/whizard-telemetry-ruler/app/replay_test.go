@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReplay(t *testing.T) {
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		// The file which has the expected stdout.
+		golden string
+		// The substring of stderr.
+		stderr string
+	}{
+		{
+			name:   "text report",
+			args:   []string{"--rules", "testdata/rules.yaml", "testdata/audit.log"},
+			golden: "testdata/replay.txt",
+		},
+		{
+			name:   "json report",
+			args:   []string{"--rules", "testdata/rules.yaml", "--output", "json", "testdata/audit.log"},
+			golden: "testdata/replay.json",
+		},
+		{
+			// The alerts are printed to stdout, and the report is written to stderr.
+			name:   "send to stdout",
+			args:   []string{"--rules", "testdata/rules.yaml", "--send", "stdout", "testdata/audit.log"},
+			golden: "testdata/replay_alerts.jsonl",
+			stderr: "Replayed 5 events, 3 alerts from 2023-01-01T00:00:10Z to 2023-01-01T01:30:00Z, 1 malformed lines are skipped",
+		},
+		{
+			name:   "missing rules",
+			args:   []string{"testdata/audit.log"},
+			code:   1,
+			stderr: `required flag(s) "rules" not set`,
+		},
+		{
+			name:   "unknown output",
+			args:   []string{"--rules", "testdata/rules.yaml", "--output", "yaml", "testdata/audit.log"},
+			code:   1,
+			stderr: "unknown output yaml",
+		},
+		{
+			name:   "missing sink config",
+			args:   []string{"--rules", "testdata/rules.yaml", "--send", "webhook", "testdata/audit.log"},
+			code:   1,
+			stderr: "--sink-config is required to send the alerts to receiver webhook",
+		},
+		{
+			name:   "missing event file",
+			args:   []string{"--rules", "testdata/rules.yaml", "testdata/missing.log"},
+			code:   1,
+			stderr: "no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, code := runMain(t, append([]string{"replay"}, tt.args...)...)
+			if code != tt.code {
+				t.Fatalf("exit code: got %d, want %d, stderr:\n%s", code, tt.code, stderr)
+			}
+			if !strings.Contains(stderr, tt.stderr) {
+				t.Errorf("stderr does not contain %q:\n%s", tt.stderr, stderr)
+			}
+
+			if len(tt.golden) == 0 {
+				return
+			}
+			want, err := ioutil.ReadFile(tt.golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(want), stdout); len(diff) > 0 {
+				t.Errorf("stdout is not the same as %s (-want +got):\n%s", tt.golden, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// loadRuleFiles read the ClusterRuleGroups and RuleGroups from the YAML or JSON files, a file can contain
+// several documents, and the other kinds are rejected.
+func loadRuleFiles(paths []string) ([]v1alpha1.ClusterRuleGroup, []v1alpha1.RuleGroup, error) {
+
+	var groups []v1alpha1.ClusterRuleGroup
+	var namespaced []v1alpha1.RuleGroup
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+		for {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				if err == io.EOF {
+					break
+				}
+				_ = f.Close()
+				return nil, nil, fmt.Errorf("failed to decode %s, %s", path, err)
+			}
+			if len(raw) == 0 || string(raw) == "null" {
+				continue
+			}
+
+			tm := metav1.TypeMeta{}
+			if err := json.Unmarshal(raw, &tm); err != nil {
+				_ = f.Close()
+				return nil, nil, fmt.Errorf("failed to decode %s, %s", path, err)
+			}
+			switch tm.Kind {
+			case "ClusterRuleGroup":
+				crg := v1alpha1.ClusterRuleGroup{}
+				err = json.Unmarshal(raw, &crg)
+				groups = append(groups, crg)
+			case "RuleGroup":
+				rg := v1alpha1.RuleGroup{}
+				err = json.Unmarshal(raw, &rg)
+				if len(rg.Namespace) == 0 {
+					rg.Namespace = metav1.NamespaceDefault
+				}
+				namespaced = append(namespaced, rg)
+			default:
+				err = fmt.Errorf("unsupported kind %q", tm.Kind)
+			}
+			if err != nil {
+				_ = f.Close()
+				return nil, nil, fmt.Errorf("failed to decode %s, %s", path, err)
+			}
+		}
+		_ = f.Close()
+	}
+
+	return groups, namespaced, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/cache"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/emicklei/go-restful"
+)
+
+// The name of the group which the inline rules of a test request belong to.
+const testGroup = "test"
+
+// ruleTestRequest is the body of rule test, the payload is tested against either a loaded group or the inline rules.
+type ruleTestRequest struct {
+	// The type of payload, auditing, events or logging.
+	Type string `json:"type"`
+	// The body which the webhook receives.
+	Payload json.RawMessage `json:"payload"`
+	// The loaded group, name for ClusterRuleGroup, and namespace/name for RuleGroup.
+	Group string `json:"group,omitempty"`
+	// The inline rules, they can reference the macros, lists and aliases of the loaded groups.
+	Rules []v1alpha1.Rule `json:"rules,omitempty"`
+	// The match mode of the inline rules.
+	MatchMode string `json:"matchMode,omitempty"`
+}
+
+// listRuleGroups list the loaded ClusterRuleGroups and RuleGroups.
+var listRuleGroups = func() ([]v1alpha1.ClusterRuleGroup, []v1alpha1.RuleGroup, error) {
+
+	crgs := &v1alpha1.ClusterRuleGroupList{}
+	if err := cache.Cache().List(context.Background(), crgs); err != nil {
+		return nil, nil, fmt.Errorf("failed to list cluster rule groups, %s", err)
+	}
+	rgs := &v1alpha1.RuleGroupList{}
+	if err := cache.Cache().List(context.Background(), rgs); err != nil {
+		return nil, nil, fmt.Errorf("failed to list rule groups, %s", err)
+	}
+
+	return crgs.Items, rgs.Items, nil
+}
+
+// testRules evaluate the events of payload against the rules, and return the result of every event,
+// nothing is exported and the states of the running rules are untouched.
+func testRules(req *restful.Request, resp *restful.Response) {
+
+	body := &ruleTestRequest{}
+	if err := req.ReadEntity(body); err != nil {
+		responseWithHeaderAndEntity(resp, http.StatusBadRequest, fmt.Sprintf("invalid request, %s", err))
+		return
+	}
+
+	if (len(body.Group) == 0) == (len(body.Rules) == 0) {
+		responseWithHeaderAndEntity(resp, http.StatusBadRequest, "exactly one of group or rules must be specified")
+		return
+	}
+
+	es, err := rule.DecodeEvents(body.Type, body.Payload)
+	if err != nil {
+		responseWithHeaderAndEntity(resp, http.StatusBadRequest, fmt.Sprintf("invalid payload, %s", err))
+		return
+	}
+
+	crgs, rgs, err := listRuleGroups()
+	if err != nil {
+		responseWithHeaderAndEntity(resp, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	groups, group := crgs, body.Group
+	if len(body.Rules) > 0 {
+		if err := rule.ValidateMatchMode(body.MatchMode); err != nil {
+			responseWithHeaderAndEntity(resp, http.StatusBadRequest, fmt.Sprintf("matchMode %s", err))
+			return
+		}
+
+		// The inline group replaces the loaded group with the same name.
+		crg := v1alpha1.ClusterRuleGroup{}
+		crg.Name = testGroup
+		crg.Spec = v1alpha1.ClusterRuleGroupRuleSpec{Type: body.Type, Rules: body.Rules, MatchMode: body.MatchMode}
+		groups = []v1alpha1.ClusterRuleGroup{crg}
+		for _, item := range crgs {
+			if item.Name != testGroup {
+				groups = append(groups, item)
+			}
+		}
+		group = testGroup
+	}
+
+	t := rule.NewTester(groups, rgs, group)
+	now := time.Now()
+	results := make([]*rule.TestResult, 0, len(es))
+	for _, e := range es {
+		results = append(results, t.Test(e, now))
+	}
+
+	responseWithHeaderAndEntity(resp, http.StatusOK, results)
+}
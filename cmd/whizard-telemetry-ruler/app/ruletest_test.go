@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/emicklei/go-restful"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestTestRules(t *testing.T) {
+
+	newRule := func(name, condition, severity string) v1alpha1.Rule {
+		return v1alpha1.Rule{
+			Name:   name,
+			Enable: pointer.Bool(true),
+			Expr:   v1alpha1.Expr{Kind: rule.KindRule, Condition: condition},
+			Alerts: v1alpha1.Alerts{Severity: severity, Message: "${user} " + name},
+		}
+	}
+	crgs := []v1alpha1.ClusterRuleGroup{{
+		ObjectMeta: metav1.ObjectMeta{Name: "loaded"},
+		Spec: v1alpha1.ClusterRuleGroupRuleSpec{
+			Type: rule.AuditingType,
+			Rules: []v1alpha1.Rule{
+				{Name: "user", Expr: v1alpha1.Expr{Kind: rule.KindAlias, Alias: "User.username"}},
+				{Name: "deleting", Expr: v1alpha1.Expr{Kind: rule.KindMacro, Macro: `Verb = "delete"`}},
+				newRule("delete", "${deleting}", "WARNING"),
+				newRule("delete-pods", `${deleting} and ObjectRef.Resource = "pods"`, "CRITICAL"),
+			},
+		},
+	}}
+
+	saved := listRuleGroups
+	listRuleGroups = func() ([]v1alpha1.ClusterRuleGroup, []v1alpha1.RuleGroup, error) {
+		return crgs, nil, nil
+	}
+	defer func() { listRuleGroups = saved }()
+
+	container := restful.NewContainer()
+	ws := new(restful.WebService)
+	ws.Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	ws.Route(ws.POST("/api/v1/rules/test").To(testRules))
+	container.Add(ws)
+
+	payload := `[
+		{"Verb": "delete", "User": {"username": "admin"}, "ObjectRef": {"Resource": "pods"}},
+		{"Verb": "get", "User": {"username": "admin"}, "ObjectRef": {"Resource": "pods"}}
+	]`
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		// The winner and alerts of every event.
+		winners []string
+		alerts  [][]rule.TestAlert
+		// The rules evaluated for the first event.
+		rules []string
+	}{
+		{
+			name:    "group",
+			body:    `{"type": "auditing", "group": "loaded", "payload": ` + payload + `}`,
+			status:  http.StatusOK,
+			winners: []string{"delete-pods", ""},
+			alerts: [][]rule.TestAlert{
+				{{Group: "loaded", Rule: "delete-pods", Severity: "CRITICAL", Message: "admin delete-pods"}},
+				nil,
+			},
+			rules: []string{"delete", "delete-pods"},
+		},
+		{
+			// The inline rules use the macro and alias of the loaded group, all matches are alerted and the
+			// first one is the winner.
+			name: "inline",
+			body: `{"type": "auditing", "matchMode": "all-matches", "payload": ` + payload + `, "rules": [
+				{"name": "any", "enable": true, "expr": {"kind": "rule", "condition": "User.username = \"admin\""},
+					"alerts": {"severity": "INFO", "message": "${loaded.user} any"}},
+				{"name": "delete", "enable": true, "expr": {"kind": "rule", "condition": "${loaded.deleting}"},
+					"alerts": {"severity": "ERROR", "message": "${loaded.user} delete"}}
+			]}`,
+			status:  http.StatusOK,
+			winners: []string{"any", "any"},
+			alerts: [][]rule.TestAlert{
+				{
+					{Group: "test", Rule: "any", Severity: "INFO", Message: "admin any"},
+					{Group: "test", Rule: "delete", Severity: "ERROR", Message: "admin delete"},
+				},
+				{{Group: "test", Rule: "any", Severity: "INFO", Message: "admin any"}},
+			},
+			rules: []string{"any", "delete"},
+		},
+		{
+			name:   "both group and rules",
+			body:   `{"type": "auditing", "group": "loaded", "rules": [{"name": "r"}], "payload": []}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "neither group nor rules",
+			body:   `{"type": "auditing", "payload": []}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown type",
+			body:   `{"type": "metrics", "group": "loaded", "payload": []}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/rules/test", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", restful.MIME_JSON)
+			rec := httptest.NewRecorder()
+			container.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status: got %d, want %d, body: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var results []rule.TestResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(tt.winners) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.winners))
+			}
+
+			for i, res := range results {
+				if res.Winner != tt.winners[i] {
+					t.Errorf("event %d winner: got %q, want %q", i, res.Winner, tt.winners[i])
+				}
+				if len(res.Alerts) != len(tt.alerts[i]) {
+					t.Errorf("event %d alerts: got %+v, want %+v", i, res.Alerts, tt.alerts[i])
+					continue
+				}
+				for j, a := range res.Alerts {
+					want := tt.alerts[i][j]
+					if a.Group != want.Group || a.Rule != want.Rule || a.Severity != want.Severity || a.Message != want.Message {
+						t.Errorf("event %d alert %d: got %+v, want %+v", i, j, a, want)
+					}
+				}
+			}
+
+			var names []string
+			for _, r := range results[0].Rules {
+				if r.Error != "" {
+					t.Errorf("rule %s: %s", r.Name, r.Error)
+				}
+				names = append(names, r.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.rules, ",") {
+				t.Errorf("rules: got %v, want %v", names, tt.rules)
+			}
+		})
+	}
+}
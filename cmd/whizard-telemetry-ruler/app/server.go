@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"github.com/emicklei/go-restful"
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"io/ioutil"
@@ -29,8 +30,11 @@ import (
 	"whizard-telemetry-ruler/pkg/cache"
 	"whizard-telemetry-ruler/pkg/config"
 	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/exporter"
+	"whizard-telemetry-ruler/pkg/metrics"
 	"whizard-telemetry-ruler/pkg/rule"
 
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -42,6 +46,7 @@ var (
 	port                  int
 	tls                   bool
 	goroutinesNum         int
+	adminAddress          string
 
 	waitHandlerGroup sync.WaitGroup
 	whizardChan      chan *rule.WhizardEvent
@@ -51,6 +56,10 @@ func AddFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&port, "port", 8080, "The port which the server listen, default 8080")
 	fs.BoolVar(&tls, "tls", true, "Use https, default false")
 	fs.IntVar(&goroutinesNum, "goroutines-num", constant.GoroutinesNumMax, "the num of goroutine to match rule,default 200")
+	fs.StringVar(&adminAddress, "admin-address", "127.0.0.1:8081", "The address which the admin endpoints listen, they are not served if it is empty")
+	fs.StringVar(&auditLogPath, "audit-log-path", "", "The JSON-lines audit log file of kube-apiserver to follow, the audit log is not followed if it is empty")
+	fs.StringVar(&auditLogCheckpoint, "audit-log-checkpoint", "", "The file to keep the offset of the audit log, it is required if --audit-log-path is set")
+	fs.DurationVar(&auditLogPollInterval, "audit-log-poll-interval", time.Second, "The interval to poll the audit log for new lines and rotation")
 }
 
 func NewServerCommand() *cobra.Command {
@@ -63,6 +72,9 @@ func NewServerCommand() *cobra.Command {
 	}
 	AddFlags(cmd.Flags())
 	cmd.Flags().AddGoFlagSet(flag.CommandLine)
+	cmd.AddCommand(NewTestCommand())
+	cmd.AddCommand(NewLintCommand())
+	cmd.AddCommand(NewReplayCommand())
 
 	return cmd
 }
@@ -73,15 +85,36 @@ func Run() error {
 		glog.Errorf("FLAG: --%s=%q", flag.Name, flag.Value)
 	})
 
+	if err := rule.ValidateMatchMode(rule.GlobalMatchMode()); err != nil {
+		glog.Fatal(err)
+	}
+
+	if err := exporter.InitSpool(); err != nil {
+		glog.Fatal(err)
+	}
+
 	if err := config.LoadConfig(); err != nil {
 		glog.Fatal(err)
 	}
 
 	glog.Info("Run start")
 	whizardChan = make(chan *rule.WhizardEvent, constant.ChannelLenMax)
+	metrics.RegisterChannel(func() float64 {
+		return float64(len(whizardChan))
+	}, func() float64 {
+		return float64(cap(whizardChan))
+	})
 
 	go whizardEventsWorker()
 
+	if err := startAuditLogTailer(); err != nil {
+		glog.Fatal(err)
+	}
+
+	if err := adminServer(); err != nil {
+		glog.Fatal(err)
+	}
+
 	glog.Info("Run function completed")
 	return httpServer()
 }
@@ -95,11 +128,15 @@ func httpServer() error {
 		Produces(restful.MIME_JSON)
 	ws.Route(ws.POST("/webhook/auditing").To(handlerAudits))
 	ws.Route(ws.POST("/webhook/events").To(handlerEvents))
+	ws.Route(ws.POST("/webhook/logging").To(handlerLogging))
 	ws.Route(ws.GET("/readiness").To(readiness))
 	ws.Route(ws.GET("/liveness").To(readiness))
 	ws.Route(ws.GET("/prestop").To(preStop))
+	ws.Route(ws.POST("/admission/rulegroups").To(validateRuleGroup))
+	ws.Route(ws.POST("/api/v1/rules/test").To(testRules))
 
 	container.Add(ws)
+	container.Handle("/metrics", promhttp.Handler())
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
@@ -116,12 +153,47 @@ func httpServer() error {
 	return err
 }
 
+// adminServer serve the admin endpoints on --admin-address, they are not served on the port of webhooks,
+// which is exposed by the Service without authentication. It listens on localhost by default, and the
+// endpoints are reached by kubectl port-forward.
+func adminServer() error {
+
+	if len(adminAddress) == 0 {
+		return nil
+	}
+
+	container := restful.NewContainer()
+	ws := new(restful.WebService)
+	ws.Path("").
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("/admin/spool").To(listSpool))
+	ws.Route(ws.POST("/admin/spool/replay").To(replaySpool))
+	ws.Route(ws.DELETE("/admin/spool").To(purgeSpool))
+	ws.Route(ws.GET("/admin/routes").To(listRoutes))
+	container.Add(ws)
+
+	l, err := net.Listen("tcp", adminAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen the admin address %s, %s", adminAddress, err)
+	}
+
+	go func() {
+		if err := http.Serve(l, container); err != nil {
+			glog.Errorf("admin server error, %s", err)
+		}
+	}()
+	glog.Infof("serve the admin endpoints on %s", adminAddress)
+	return nil
+}
+
 func handlerEvents(request *restful.Request, response *restful.Response) {
 	waitHandlerGroup.Add(1)
 	defer waitHandlerGroup.Done()
 
 	body, err := ioutil.ReadAll(request.Request.Body)
 	if err != nil {
+		metrics.EventsRejected.WithLabelValues(constant.Event, metrics.ReasonReadError).Inc()
 		err := response.WriteHeaderAndEntity(http.StatusBadRequest, "")
 		if err != nil {
 			glog.Errorf("response error %s", err)
@@ -131,6 +203,7 @@ func handlerEvents(request *restful.Request, response *restful.Response) {
 	var events []*rule.Event
 	events, err = rule.NewEvents(body)
 	if err != nil {
+		metrics.EventsRejected.WithLabelValues(constant.Event, metrics.ReasonDecodeError).Inc()
 		err := response.WriteHeaderAndEntity(http.StatusBadRequest, "")
 		if err != nil {
 			glog.Errorf("response error %s", err)
@@ -143,6 +216,7 @@ func handlerEvents(request *restful.Request, response *restful.Response) {
 			Kind:  constant.Event,
 			Event: event,
 		}
+		metrics.EventsReceived.WithLabelValues(constant.Event).Inc()
 		whizardChan <- whizardEvent
 	}
 
@@ -152,9 +226,59 @@ func handlerEvents(request *restful.Request, response *restful.Response) {
 	}
 }
 
+func handlerLogging(request *restful.Request, response *restful.Response) {
+	waitHandlerGroup.Add(1)
+	defer waitHandlerGroup.Done()
+
+	body, err := ioutil.ReadAll(request.Request.Body)
+	if err != nil {
+		metrics.EventsRejected.WithLabelValues(constant.Logging, metrics.ReasonReadError).Inc()
+		err := response.WriteHeaderAndEntity(http.StatusBadRequest, "")
+		if err != nil {
+			glog.Errorf("response error %s", err)
+		}
+		return
+	}
+	var logs []*rule.Logging
+	logs, err = rule.NewLogging(body)
+	if err != nil {
+		metrics.EventsRejected.WithLabelValues(constant.Logging, metrics.ReasonDecodeError).Inc()
+		err := response.WriteHeaderAndEntity(http.StatusBadRequest, "")
+		if err != nil {
+			glog.Errorf("response error %s", err)
+		}
+		return
+	}
+
+	// Populate the Workspace information based on namespace labels.
+	for _, log := range logs {
+		if ns := log.Namespace(); len(ns) > 0 {
+			namespace := &corev1.Namespace{}
+			if err := cache.Cache().Get(context.Background(), types.NamespacedName{Name: ns}, namespace); err == nil {
+				ws, ok := namespace.Labels["kubesphere.io/workspace"]
+				if ok {
+					log.Workspace = ws
+				}
+			}
+		}
+		whizardLog := &rule.WhizardEvent{
+			Kind:    constant.Logging,
+			Logging: log,
+		}
+		metrics.EventsReceived.WithLabelValues(constant.Logging).Inc()
+		whizardChan <- whizardLog
+	}
+
+	err = response.WriteHeaderAndEntity(http.StatusOK, "")
+	if err != nil {
+		glog.Errorf("response error %s", err)
+	}
+}
+
 func whizardEventsWorker() {
 	glog.Info("Entering whizardEventsWorker")
 	routinesChan := make(chan interface{}, goroutinesNum)
+	metrics.WorkersMax.Set(float64(goroutinesNum))
 	for {
 		whizardEvents := <-whizardChan
 		if whizardEvents == nil {
@@ -167,20 +291,19 @@ func whizardEventsWorker() {
 			cancel()
 		case <-ctx.Done():
 			glog.Errorf("get goroutines for  %s timeout", whizardEvents.Kind)
+			metrics.EventsDropped.WithLabelValues(whizardEvents.Kind, metrics.ReasonWorkerTimeout).Inc()
 			cancel()
+			whizardEvents.Processed()
 			continue
 		}
+		metrics.WorkersBusy.Inc()
 
 		go func() {
 			stopCh := make(chan interface{}, 1)
 			go func() {
-				if whizardEvents.Kind == constant.Auditing {
-					processAuditingEvent(whizardEvents.Auditing)
-					close(stopCh)
-				} else if whizardEvents.Kind == constant.Event {
-					processKubeEvent(whizardEvents.Event)
-					close(stopCh)
-				}
+				processEvent(whizardEvents)
+				whizardEvents.Processed()
+				close(stopCh)
 			}()
 
 			ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second*constant.GoroutinesTimeOut)
@@ -190,9 +313,11 @@ func whizardEventsWorker() {
 				break
 			case <-ctx2.Done():
 				glog.Errorf("match %s timeout", whizardEvents.Kind)
+				metrics.EventsDropped.WithLabelValues(whizardEvents.Kind, metrics.ReasonMatchTimeout).Inc()
 			}
 
 			<-routinesChan
+			metrics.WorkersBusy.Dec()
 		}()
 	}
 }
@@ -203,6 +328,7 @@ func handlerAudits(req *restful.Request, resp *restful.Response) {
 
 	body, err := ioutil.ReadAll(req.Request.Body)
 	if err != nil {
+		metrics.EventsRejected.WithLabelValues(constant.Auditing, metrics.ReasonReadError).Inc()
 		err := resp.WriteHeaderAndEntity(http.StatusBadRequest, "")
 		if err != nil {
 			glog.Errorf("response error %s", err)
@@ -214,6 +340,7 @@ func handlerAudits(req *restful.Request, resp *restful.Response) {
 	audits, err = rule.NewAuditing(body)
 
 	if err != nil {
+		metrics.EventsRejected.WithLabelValues(constant.Auditing, metrics.ReasonDecodeError).Inc()
 		err := resp.WriteHeaderAndEntity(http.StatusBadRequest, "")
 		if err != nil {
 			glog.Errorf("response error %s", err)
@@ -221,6 +348,18 @@ func handlerAudits(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
+	receiveAudits(audits, nil)
+
+	err = resp.WriteHeaderAndEntity(http.StatusOK, "")
+	if err != nil {
+		glog.Errorf("response error %s", err)
+	}
+}
+
+// receiveAudits send the audits to the workers, it is used by the webhook and the audit log file source.
+// The done is called when every audit is processed, it may be nil.
+func receiveAudits(audits []*rule.Auditing, done func()) {
+
 	// Iterate through audits, check and populate missing Workspace information based on namespace labels.
 	for _, audit := range audits {
 		if len(audit.Workspace) == 0 && audit.ObjectRef != nil && len(audit.ObjectRef.Namespace) > 0 {
@@ -235,20 +374,19 @@ func handlerAudits(req *restful.Request, resp *restful.Response) {
 		whizardAudit := &rule.WhizardEvent{
 			Kind:     constant.Auditing,
 			Auditing: audit,
+			Done:     done,
 		}
+		metrics.EventsReceived.WithLabelValues(constant.Auditing).Inc()
 		whizardChan <- whizardAudit
 	}
-
-	err = resp.WriteHeaderAndEntity(http.StatusOK, "")
-	if err != nil {
-		glog.Errorf("response error %s", err)
-	}
 }
 
 func Close() {
+	stopAuditLogTailer()
 	waitHandlerGroup.Wait()
 	glog.Errorf("msg handler close, wait pool close")
 	close(whizardChan)
+	exporter.Close()
 }
 
 // preStop
@@ -265,6 +403,48 @@ func readiness(_ *restful.Request, resp *restful.Response) {
 	responseWithHeaderAndEntity(resp, http.StatusOK, "")
 }
 
+// listSpool list the alerts in spool, filtered by the receiver in query.
+func listSpool(req *restful.Request, resp *restful.Response) {
+
+	records, err := exporter.ListSpooledAlerts(req.QueryParameter("receiver"))
+	if err != nil {
+		responseWithHeaderAndEntity(resp, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responseWithHeaderAndEntity(resp, http.StatusOK, records)
+}
+
+// replaySpool send the alerts in spool again, filtered by the receiver in query.
+func replaySpool(req *restful.Request, resp *restful.Response) {
+
+	n, err := exporter.ReplaySpooledAlerts(req.QueryParameter("receiver"))
+	if err != nil {
+		responseWithHeaderAndEntity(resp, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responseWithHeaderAndEntity(resp, http.StatusOK, map[string]int{"replayed": n})
+}
+
+// purgeSpool delete the alerts in spool, filtered by the receiver in query.
+func purgeSpool(req *restful.Request, resp *restful.Response) {
+
+	n, err := exporter.PurgeSpooledAlerts(req.QueryParameter("receiver"))
+	if err != nil {
+		responseWithHeaderAndEntity(resp, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responseWithHeaderAndEntity(resp, http.StatusOK, map[string]int{"purged": n})
+}
+
+// listRoutes list the recent routes of alerts, filtered by the receiver and rule in query.
+func listRoutes(req *restful.Request, resp *restful.Response) {
+
+	responseWithHeaderAndEntity(resp, http.StatusOK, exporter.GetRoutes(req.QueryParameter("receiver"), req.QueryParameter("rule")))
+}
+
 func responseWithHeaderAndEntity(resp *restful.Response, status int, value interface{}) {
 	e := resp.WriteHeaderAndEntity(status, value)
 	if e != nil {
@@ -0,0 +1,230 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// The time of the first event of a test, the events are evaluated at a fixed time so the results are reproducible.
+var testStartTime = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ruleTestFile is a file of rule unit tests.
+type ruleTestFile struct {
+	// The files of ClusterRuleGroups and RuleGroups, relative to the test file.
+	RuleFiles []string       `json:"ruleFiles"`
+	Tests     []ruleTestCase `json:"tests"`
+}
+
+// ruleTestCase is a rule unit test, the events are evaluated in order, and the alerts raised by all of them
+// are compared with the expected alerts regardless of order.
+type ruleTestCase struct {
+	Name string `json:"name"`
+	// The type of events, auditing, events or logging.
+	Type string `json:"type"`
+	// Only the rules of the group are tested if it is set, name for ClusterRuleGroup, and namespace/name for RuleGroup.
+	Group string `json:"group,omitempty"`
+	// The interval between events, it advances the windows of thresholds and sequences, default to 1s.
+	Interval string `json:"interval,omitempty"`
+	// The body which the webhook of the type receives.
+	Events json.RawMessage `json:"events"`
+	// The expected alerts, the groups are not compared unless every expected alert has one.
+	Alerts []rule.TestAlert `json:"alerts"`
+}
+
+// NewTestCommand return the command to run the rule unit tests offline, without a Kubernetes connection.
+func NewTestCommand() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Unit testing",
+	}
+
+	rulesCmd := &cobra.Command{
+		Use:   "rules <test-file>...",
+		Short: "Run the unit tests of rules",
+		Long: `Run the unit tests of rules, every test file names the ClusterRuleGroup and RuleGroup files
+and the events with the alerts they are expected to raise. It exits non-zero with a diff if any test fails.`,
+		Args:          cobra.MinimumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRuleTests(cmd.OutOrStdout(), args)
+		},
+	}
+	// The rule groups without matchMode are selected by the global match mode as the server does.
+	if f := flag.CommandLine.Lookup("match-mode"); f != nil {
+		rulesCmd.Flags().AddFlag(pflag.PFlagFromGoFlag(f))
+	}
+
+	cmd.AddCommand(rulesCmd)
+	return cmd
+}
+
+func runRuleTests(out io.Writer, paths []string) error {
+
+	if err := rule.ValidateMatchMode(rule.GlobalMatchMode()); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, path := range paths {
+		fmt.Fprintf(out, "Unit Testing: %s\n", path)
+		errs := runRuleTestFile(path)
+		if len(errs) == 0 {
+			fmt.Fprintf(out, "  SUCCESS\n\n")
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(out, "  FAILED:\n")
+		for _, err := range errs {
+			fmt.Fprintf(out, "    %s\n", strings.ReplaceAll(err.Error(), "\n", "\n    "))
+		}
+		fmt.Fprintln(out)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("rule tests failed in %d of %d files", failed, len(paths))
+	}
+
+	return nil
+}
+
+// runRuleTestFile run the tests of the file, and return an error for every failed test.
+func runRuleTestFile(path string) []error {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []error{err}
+	}
+	tf := &ruleTestFile{}
+	if err := yaml.UnmarshalStrict(data, tf); err != nil {
+		return []error{fmt.Errorf("failed to decode %s, %s", path, err)}
+	}
+
+	var ruleFiles []string
+	for _, f := range tf.RuleFiles {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(filepath.Dir(path), f)
+		}
+		ruleFiles = append(ruleFiles, f)
+	}
+	groups, namespaced, err := loadRuleFiles(ruleFiles)
+	if err != nil {
+		return []error{err}
+	}
+
+	// The rules are invalid for all tests.
+	var errs []error
+	for _, r := range rule.NewTester(groups, namespaced, "").InvalidRules() {
+		errs = append(errs, fmt.Errorf("rule %s.%s is invalid, %s", r.Group, r.Name, r.Error))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for i := range tf.Tests {
+		tc := &tf.Tests[i]
+		if err := tc.run(rule.NewTester(groups, namespaced, tc.Group)); err != nil {
+			errs = append(errs, fmt.Errorf("test %q: %s", tc.Name, err))
+		}
+	}
+
+	return errs
+}
+
+func (tc *ruleTestCase) run(t *rule.Tester) error {
+
+	interval := time.Second
+	if len(tc.Interval) > 0 {
+		d, err := time.ParseDuration(tc.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval %s, %s", tc.Interval, err)
+		}
+		interval = d
+	}
+
+	es, err := rule.DecodeEvents(tc.Type, tc.Events)
+	if err != nil {
+		return fmt.Errorf("invalid events, %s", err)
+	}
+
+	var got []rule.TestAlert
+	for i, e := range es {
+		res := t.Test(e, testStartTime.Add(time.Duration(i)*interval))
+		for _, r := range res.Rules {
+			if len(r.Error) > 0 {
+				return fmt.Errorf("rule %s.%s failed to evaluate event %d, %s", r.Group, r.Name, i, r.Error)
+			}
+		}
+		got = append(got, res.Alerts...)
+	}
+
+	want := tc.Alerts
+	// The groups are compared only if all expected alerts have them.
+	if !groupsExpected(want) {
+		for i := range got {
+			got[i].Group = ""
+		}
+	}
+	sortAlerts(want)
+	sortAlerts(got)
+
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); len(diff) > 0 {
+		return fmt.Errorf("the alerts are not expected (-want +got):\n%s", strings.TrimRight(diff, "\n"))
+	}
+
+	return nil
+}
+
+func groupsExpected(alerts []rule.TestAlert) bool {
+	for _, a := range alerts {
+		if len(a.Group) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortAlerts(alerts []rule.TestAlert) {
+	sort.SliceStable(alerts, func(i, j int) bool {
+		if alerts[i].Group != alerts[j].Group {
+			return alerts[i].Group < alerts[j].Group
+		}
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return alerts[i].Message < alerts[j].Message
+	})
+}
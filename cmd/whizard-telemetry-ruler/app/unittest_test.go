@@ -0,0 +1,145 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// The arguments of the command run by TestMainProcess, separated by new lines.
+const mainArgsEnv = "WHIZARD_TELEMETRY_RULER_ARGS"
+
+// TestMainProcess run the command as main does when it is started by runMain.
+func TestMainProcess(t *testing.T) {
+
+	args, ok := os.LookupEnv(mainArgsEnv)
+	if !ok {
+		return
+	}
+
+	cmd := NewServerCommand()
+	cmd.SetArgs(strings.Split(args, "\n"))
+	if err := cmd.Execute(); err != nil {
+		log.Fatalln(err)
+	}
+	os.Exit(0)
+}
+
+// runMain run the command with the arguments in a subprocess, and return its stdout, stderr and exit code.
+func runMain(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainProcess$")
+	cmd.Env = append(os.Environ(), mainArgsEnv+"="+strings.Join(args, "\n"))
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return stdout.String(), stderr.String(), 0
+	case errors.As(err, &exitErr):
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	default:
+		t.Fatal(err)
+		return "", "", 0
+	}
+}
+
+// diffLine return true if a line of the diff starts with the sign and contains s.
+func diffLine(out, sign, s string) bool {
+	for _, l := range strings.Split(out, "\n") {
+		if l = strings.TrimSpace(l); strings.HasPrefix(l, sign) && strings.Contains(l, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRuleUnitTests(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		files []string
+		code  int
+		// The substrings of the output.
+		output []string
+		// The lines of diff removed and added.
+		removed, added []string
+	}{
+		{
+			name:   "passed",
+			files:  []string{"testdata/rules_test.yaml"},
+			output: []string{"Unit Testing: testdata/rules_test.yaml\n  SUCCESS"},
+		},
+		{
+			name:  "failed",
+			files: []string{"testdata/rules_test.yaml", "testdata/failing_test.yaml"},
+			code:  1,
+			output: []string{
+				"Unit Testing: testdata/rules_test.yaml\n  SUCCESS",
+				"Unit Testing: testdata/failing_test.yaml\n  FAILED:",
+				`test "delete pod": the alerts are not expected (-want +got):`,
+				"rule tests failed in 1 of 2 files",
+			},
+			removed: []string{`"CRITICAL"`},
+			added:   []string{`"WARNING"`},
+		},
+		{
+			name:   "missing file",
+			files:  []string{"testdata/missing_test.yaml"},
+			code:   1,
+			output: []string{"no such file or directory", "rule tests failed in 1 of 1 files"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, stderr, code := runMain(t, append([]string{"test", "rules"}, tt.files...)...)
+			// The error is logged to stderr by main.
+			out += stderr
+			if code != tt.code {
+				t.Fatalf("exit code: got %d, want %d, output:\n%s", code, tt.code, out)
+			}
+			for _, s := range tt.output {
+				if !strings.Contains(out, s) {
+					t.Errorf("output does not contain %q:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.removed {
+				if !diffLine(out, "-", s) {
+					t.Errorf("diff does not remove %s:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.added {
+				if !diffLine(out, "+", s) {
+					t.Errorf("diff does not add %s:\n%s", s, out)
+				}
+			}
+			if strings.Contains(out, `test "no alert"`) {
+				t.Errorf("the passed test is reported:\n%s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// The receiver is connected, and the last alert is delivered.
+	ReceiverStateConnected = "Connected"
+	// The receiver is connected, but the last alert failed to deliver.
+	ReceiverStateFailing = "Failing"
+	// The config of receiver is invalid.
+	ReceiverStateInvalid = "Invalid"
+)
+
+// SecretKeySelector selects a key of a Secret.
+type SecretKeySelector struct {
+	// The namespace of the secret, default to the namespace of ruler. It must be the namespace of ruler
+	// if it is set, the secrets of other namespaces are not allowed.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// The name of the secret.
+	Name string `json:"name"`
+	// The key of the secret to select from.
+	Key string `json:"key"`
+}
+
+// BasicAuth is the basic authentication used to connect to the receiver.
+type BasicAuth struct {
+	Username string `json:"username"`
+	// The secret key which contains the password.
+	Password *SecretKeySelector `json:"password,omitempty"`
+}
+
+// ServiceReference holds a reference to Service.legacy.k8s.io
+type ServiceReference struct {
+	// `namespace` is the namespace of the service.
+	Namespace string `json:"namespace"`
+	// `name` is the name of the service.
+	Name string `json:"name"`
+	// `path` is an optional URL path which will be sent in any request to
+	// this service.
+	// +optional
+	Path *string `json:"path,omitempty"`
+	// If specified, the port on the service that hosting webhook.
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+}
+
+// ClientConfig contains the information to make a connection with the receiver.
+type ClientConfig struct {
+	// `url` gives the location of the receiver, in standard URL form
+	// (`scheme://host:port/path`). Exactly one of `url` or `service`
+	// must be specified.
+	// +optional
+	URL *string `json:"url,omitempty"`
+	// `service` is a reference to the service of the receiver.
+	// +optional
+	Service *ServiceReference `json:"service,omitempty"`
+	// `caBundle` is a PEM encoded CA bundle which will be used to validate the server certificate.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+	// The secret key which contains the PEM encoded CA bundle, it overrides the caBundle.
+	// +optional
+	CA *SecretKeySelector `json:"ca,omitempty"`
+	// The secret key which contains the bearer token.
+	// +optional
+	BearerToken *SecretKeySelector `json:"bearerToken,omitempty"`
+	// The basic authentication.
+	// +optional
+	BasicAuth *BasicAuth `json:"basicAuth,omitempty"`
+}
+
+type WebhookReceiver struct {
+	ClientConfig `json:",inline"`
+	// The schema of payload, alertmanager or notificationmanager, default to alertmanager.
+	// +optional
+	PayloadSchema string `json:"payloadSchema,omitempty"`
+}
+
+type NotificationManagerReceiver struct {
+	ClientConfig `json:",inline"`
+}
+
+type AlertmanagerReceiver struct {
+	// The instances of Alertmanager, alert will be sent to all of them.
+	Endpoints []ClientConfig `json:"endpoints"`
+	// The url set to the generatorURL of the alert.
+	// +optional
+	GeneratorURL string `json:"generatorURL,omitempty"`
+	// The duration after which the alert will be resolved, default to 5m.
+	// +optional
+	ResolveTimeout *metav1.Duration `json:"resolveTimeout,omitempty"`
+}
+
+// ReceiverMatch selects the alerts which will be sent to the receiver,
+// an empty field matches all alerts.
+type ReceiverMatch struct {
+	// The severities of alert, INFO, WARNING, ERROR or CRITICAL.
+	// +optional
+	Severities []string `json:"severities,omitempty"`
+	// The types of alert, auditing, events or logging.
+	// +optional
+	Types []string `json:"types,omitempty"`
+	// The names of rule group.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+	// The names of rule.
+	// +optional
+	Rules []string `json:"rules,omitempty"`
+	// The labels of alert, the value is an anchored regular expression.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// DeliveryConfig controls how the alerts are delivered to the receiver.
+type DeliveryConfig struct {
+	// Timeout of every request sent to the receiver, default to 5s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// The max number of alerts waiting to be sent, default to 1000.
+	// +optional
+	QueueSize *int32 `json:"queueSize,omitempty"`
+	// The max retry times of a failed alert, default to 3.
+	// +optional
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+	// The backoff of the first retry, default to 500ms.
+	// +optional
+	MinBackoff *metav1.Duration `json:"minBackoff,omitempty"`
+	// The max backoff between two retries, default to 30s.
+	// +optional
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+}
+
+// ClusterReceiverSpec defines the desired state of ClusterReceiver.
+type ClusterReceiverSpec struct {
+	// Receiver type, webhook, notificationmanager or alertmanager.
+	// +kubebuilder:validation:Enum=webhook;notificationmanager;alertmanager
+	Type string `json:"type"`
+	// It is required when the type is webhook.
+	// +optional
+	Webhook *WebhookReceiver `json:"webhook,omitempty"`
+	// It is required when the type is notificationmanager.
+	// +optional
+	NotificationManager *NotificationManagerReceiver `json:"notificationManager,omitempty"`
+	// It is required when the type is alertmanager.
+	// +optional
+	Alertmanager *AlertmanagerReceiver `json:"alertmanager,omitempty"`
+	// +optional
+	Delivery *DeliveryConfig `json:"delivery,omitempty"`
+	// Match selects the alerts which will be sent to this receiver.
+	// +optional
+	Match *ReceiverMatch `json:"match,omitempty"`
+	// Dedup suppresses the duplicate alerts sent to this receiver, it is overridden by the dedup of rule.
+	// +optional
+	Dedup *Dedup `json:"dedup,omitempty"`
+}
+
+// ClusterReceiverStatus defines the observed state of ClusterReceiver.
+type ClusterReceiverStatus struct {
+	// The state of receiver, Connected, Failing or Invalid.
+	// +optional
+	State string `json:"state,omitempty"`
+	// The reason why the receiver is invalid.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// The error of the last failed delivery.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+	// The time of the last failed delivery.
+	// +optional
+	LastErrorTime *metav1.Time `json:"lastErrorTime,omitempty"`
+	// The time of the last successful delivery.
+	// +optional
+	LastDeliveryTime *metav1.Time `json:"lastDeliveryTime,omitempty"`
+	// The generation observed by the ruler.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=cr
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterReceiver is the Schema for the receivers API
+type ClusterReceiver struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterReceiverSpec   `json:"spec,omitempty"`
+	Status ClusterReceiverStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterReceiverList contains a list of ClusterReceiver
+type ClusterReceiverList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterReceiver `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterReceiver{}, &ClusterReceiverList{})
+}
@@ -24,7 +24,7 @@ import (
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 type Expr struct {
-	// Rule kind, rule, macro,list,alias.
+	// Rule kind, rule, macro,list,alias,sequence.
 	Kind string `json:"kind,omitempty"`
 	// Rule condition
 	// This effective When the rule kind is rule.
@@ -42,7 +42,7 @@ type Alerts struct {
 	Annotations map[string]string `json:"annotations,omitempty"`
 	// The output formatter of message which send to user.
 	Message string `json:"message,omitempty"`
-	// Rule priority, INFO,WARNING,ERROR,CRITICAL.
+	// Rule priority, INFO,WARNING,ERROR,CRITICAL, default to INFO.
 	Severity string `json:"severity,omitempty"`
 }
 
@@ -55,8 +55,78 @@ type Rule struct {
 	// Expression of the rule
 	Expr   Expr   `json:"expr,omitempty"`
 	Alerts Alerts `json:"alerts,omitempty"`
-	// Is the rule enable.
-	Enable bool `json:"enable,omitempty"`
+	// Is the rule enable, the rules and sequences are disabled unless it is true,
+	// and the macros, lists and aliases are enabled unless it is false.
+	// +optional
+	Enable *bool `json:"enable,omitempty"`
+	// The names of receivers which the alert of this rule will be sent to,
+	// it overrides the receivers of the group.
+	// +optional
+	Receivers []string `json:"receivers,omitempty"`
+	// The rule fires only when its condition matches the events for count times within the window.
+	// +optional
+	Threshold *Threshold `json:"threshold,omitempty"`
+	// The ordered steps of the sequence rule, it is required when the kind of rule is sequence.
+	// +optional
+	Sequence *Sequence `json:"sequence,omitempty"`
+	// Dedup suppresses the duplicate alerts of this rule, it overrides the dedup of receivers.
+	// +optional
+	Dedup *Dedup `json:"dedup,omitempty"`
+}
+
+// Dedup forwards the first alert of a fingerprint and suppresses the duplicates within
+// the window, the duplicates are summarised when the window closes.
+type Dedup struct {
+	// The window in which the duplicate alerts are suppressed, such as 10m.
+	Window metav1.Duration `json:"window"`
+	// The labels of alert which fingerprint the alert with the rule name, such as namespace and name.
+	// +optional
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Sequence matches the events which match the steps in order, have the same join key,
+// and happen within the max span.
+type Sequence struct {
+	// The ordered steps, at least two steps are required.
+	Steps []SequenceStep `json:"steps"`
+	// The field path whose value joins the events of steps, such as User.username,
+	// it is used by the steps without joinBy.
+	// +optional
+	JoinBy string `json:"joinBy,omitempty"`
+	// The max duration from the first step to the last step, such as 10m.
+	MaxSpan metav1.Duration `json:"maxSpan"`
+}
+
+// SequenceStep is a step of the sequence rule.
+type SequenceStep struct {
+	// The name of step.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// The type of events matched by the step, auditing, events or logging,
+	// default to the type of the rule group.
+	// +kubebuilder:validation:Enum=auditing;events;logging
+	// +optional
+	Type string `json:"type,omitempty"`
+	// The condition of step, it can reference the macros, lists and aliases as the condition of rule.
+	Condition string `json:"condition"`
+	// The field path whose value joins the events, it overrides the joinBy of the sequence.
+	// +optional
+	JoinBy string `json:"joinBy,omitempty"`
+}
+
+// Threshold counts the matched events over a sliding time window.
+type Threshold struct {
+	// The number of matched events within the window to fire the rule, the count
+	// of the group is reset when the rule fired.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10000
+	Count int32 `json:"count"`
+	// The sliding time window, such as 5m.
+	Window metav1.Duration `json:"window"`
+	// The field paths to group the events, such as User.username, the events are
+	// counted for every group of values.
+	// +optional
+	GroupBy []string `json:"groupBy,omitempty"`
 }
 
 // RuleSpec defines the desired state of ClusterRuleGroup.
@@ -64,14 +134,68 @@ type ClusterRuleGroupRuleSpec struct {
 	// whizard log type ,auditing/events/logging
 	Type  string `json:"type,omitempty"`
 	Rules []Rule `json:"rules,omitempty"`
+	// The names of receivers which the alerts of this group will be sent to,
+	// the alerts are sent to all receivers if it is empty.
+	// +optional
+	Receivers []string `json:"receivers,omitempty"`
+	// The mode to select the alerts when several rules of this group match an event,
+	// first-match, highest-severity or all-matches. The rules of the groups without
+	// matchMode are selected together by the global match mode.
+	// +kubebuilder:validation:Enum=first-match;highest-severity;all-matches
+	// +optional
+	MatchMode string `json:"matchMode,omitempty"`
+}
+
+const (
+	// The condition is true if all rules of the group are valid.
+	RuleGroupReady = "Ready"
+	// The condition is true if some rules of the group are invalid and dropped.
+	RuleGroupInvalid = "Invalid"
+)
+
+// RuleStatus is the validation result and match statistics of a rule.
+type RuleStatus struct {
+	Name string `json:"name"`
+	// Whether the rule is valid, the invalid rule is dropped.
+	Valid bool `json:"valid"`
+	// The condition with the macros, lists and aliases expanded.
+	// +optional
+	Condition string `json:"condition,omitempty"`
+	// The reason why the rule is invalid.
+	// +optional
+	Error string `json:"error,omitempty"`
+	// The time the rule matched an event last.
+	// +optional
+	LastMatchTime *metav1.Time `json:"lastMatchTime,omitempty"`
 }
 
 // RuleStatus defines the observed state of ClusterRuleGroup.
 type ClusterRuleGroupRuleStatus struct {
+	// The conditions of the group, Ready and Invalid.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// The number of valid rules.
+	// +optional
+	ValidRules int32 `json:"validRules,omitempty"`
+	// The number of invalid rules.
+	// +optional
+	InvalidRules int32 `json:"invalidRules,omitempty"`
+	// The status of every rule.
+	// +optional
+	Rules []RuleStatus `json:"rules,omitempty"`
+	// The generation observed by the ruler.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:shortName=crg
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Valid",type=integer,JSONPath=`.status.validRules`
+// +kubebuilder:printcolumn:name="Invalid",type=integer,JSONPath=`.status.invalidRules`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ClusterRuleGroup is the Schema for the rules API
 type ClusterRuleGroup struct {
@@ -91,6 +215,34 @@ type ClusterRuleGroupList struct {
 	Items           []ClusterRuleGroup `json:"items"`
 }
 
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=rg
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Valid",type=integer,JSONPath=`.status.validRules`
+// +kubebuilder:printcolumn:name="Invalid",type=integer,JSONPath=`.status.invalidRules`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// RuleGroup is the Schema for the namespaced rules API, its rules only match the events of its namespace.
+type RuleGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterRuleGroupRuleSpec   `json:"spec,omitempty"`
+	Status ClusterRuleGroupRuleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RuleGroupList contains a list of RuleGroup
+type RuleGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RuleGroup `json:"items"`
+}
+
 func init() {
 	SchemeBuilder.Register(&ClusterRuleGroup{}, &ClusterRuleGroupList{})
+	SchemeBuilder.Register(&RuleGroup{}, &RuleGroupList{})
 }
@@ -0,0 +1,115 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// The silence has not started.
+	SilenceStatePending = "Pending"
+	// The silence is suppressing the matched alerts.
+	SilenceStateActive = "Active"
+	// The silence has ended, it will be deleted after the retention.
+	SilenceStateExpired = "Expired"
+	// The matchers of silence are invalid.
+	SilenceStateInvalid = "Invalid"
+)
+
+// SilenceMatcher matches a label of alert or a field of event, exactly one of label or field must be specified.
+type SilenceMatcher struct {
+	// The label of alert, such as alertname, severity, alerttype, rulegroup and namespace.
+	// +optional
+	Label string `json:"label,omitempty"`
+	// The field of event, such as ObjectRef.Namespace or involvedObject.namespace.
+	// +optional
+	Field string `json:"field,omitempty"`
+	// The value to match, a missing label or field is matched as an empty value.
+	Value string `json:"value"`
+	// The value is an anchored regular expression if it is true.
+	// +optional
+	IsRegex bool `json:"isRegex,omitempty"`
+}
+
+// SilenceSpec defines the desired state of Silence.
+type SilenceSpec struct {
+	// The alert is suppressed if all matchers are matched.
+	Matchers []SilenceMatcher `json:"matchers"`
+	// The time the silence starts, default to the creation time.
+	// +optional
+	StartsAt *metav1.Time `json:"startsAt,omitempty"`
+	// The time the silence ends.
+	EndsAt metav1.Time `json:"endsAt"`
+	// The creator of the silence.
+	// +optional
+	CreatedBy string `json:"createdBy,omitempty"`
+	// The reason of the silence.
+	// +optional
+	Comment string `json:"comment,omitempty"`
+}
+
+// SilenceStatus defines the observed state of Silence.
+type SilenceStatus struct {
+	// The state of silence, Pending, Active, Expired or Invalid.
+	// +optional
+	State string `json:"state,omitempty"`
+	// The reason why the silence is invalid.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// The number of alerts suppressed by the silence.
+	// +optional
+	Suppressed int64 `json:"suppressed,omitempty"`
+	// The time of the last suppressed alert.
+	// +optional
+	LastSuppressedTime *metav1.Time `json:"lastSuppressedTime,omitempty"`
+	// The generation observed by the ruler.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Ends",type=date,JSONPath=`.spec.endsAt`
+// +kubebuilder:printcolumn:name="Suppressed",type=integer,JSONPath=`.status.suppressed`
+// +kubebuilder:printcolumn:name="Creator",type=string,JSONPath=`.spec.createdBy`,priority=1
+// +kubebuilder:printcolumn:name="Comment",type=string,JSONPath=`.spec.comment`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Silence is the Schema for the silences API, it suppresses the matched alerts before they are sent to receivers.
+type Silence struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SilenceSpec   `json:"spec,omitempty"`
+	Status SilenceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SilenceList contains a list of Silence
+type SilenceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Silence `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Silence{}, &SilenceList{})
+}
@@ -20,23 +20,26 @@ import (
 	"context"
 	"sync"
 	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/utils"
 
 	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
 var (
 	once          sync.Once
 	cacheInformer cache.Cache
+	// The client read from the api server directly, it is used to read the
+	// objects which are not cached, such as secrets, and update status.
+	k8sClient client.Client
 )
 
-func init() {
-	once.Do(doOnce)
-}
-
 func doOnce() {
 	scheme := runtime.NewScheme()
 	_ = v1alpha1.AddToScheme(scheme)
@@ -49,11 +52,25 @@ func doOnce() {
 
 	cacheInformer, err = cache.New(k8sConfig, cache.Options{
 		Scheme: scheme,
+		// Only the ConfigMap of ruler is needed.
+		SelectorsByObject: cache.SelectorsByObject{
+			&corev1.ConfigMap{}: {
+				Field: fields.SelectorFromSet(fields.Set{
+					"metadata.name":      constant.WhizardTelemetryRuler,
+					"metadata.namespace": utils.GetNamespace(),
+				}),
+			},
+		},
 	})
 	if err != nil {
 		glog.Fatalln(err)
 	}
 
+	k8sClient, err = client.New(k8sConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		glog.Fatalln(err)
+	}
+
 	go func() {
 		err := cacheInformer.Start(context.Background())
 		if err != nil {
@@ -62,6 +79,14 @@ func doOnce() {
 	}()
 }
 
+// Cache return the informer cache, it is created and started on first use.
 func Cache() cache.Cache {
+	once.Do(doOnce)
 	return cacheInformer
 }
+
+// Client return the client which read from the api server directly.
+func Client() client.Client {
+	once.Do(doOnce)
+	return k8sClient
+}
@@ -22,11 +22,13 @@ import (
 	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
 	"whizard-telemetry-ruler/pkg/cache"
 	"whizard-telemetry-ruler/pkg/exporter"
+	"whizard-telemetry-ruler/pkg/metrics"
 	"whizard-telemetry-ruler/pkg/rule"
 
 	"sync"
 
 	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
 	kcache "k8s.io/client-go/tools/cache"
 )
 
@@ -35,11 +37,30 @@ type Config struct {
 	Receivers []exporter.Receiver
 	// Map of rules.
 	Rules map[string]rule.Rule
+	// The enabled rules grouped by type, they are compiled and ready to evaluate.
+	RulesByType map[string][]*rule.Rule
+	// The enabled sequence rules, they are compiled and ready to advance.
+	Sequences []*rule.Rule
 }
 
 var webhookName string
 var config *Config
 var once sync.Once
+var reloadOnce sync.Once
+var mutex sync.Mutex
+
+// Trigger a reload of the receivers, the receivers are reloaded by one goroutine, so the reloads do not race.
+var receiversCh = make(chan struct{}, 1)
+
+// Trigger a reload of the rules, the rules are reloaded by one goroutine, so a list of the rule groups
+// is never stored after a newer one, and the states of rules belong to the stored rules.
+var rulesCh = make(chan struct{}, 1)
+
+// ruleLoader list the rule groups and load their rules.
+var ruleLoader = rule.LoadRule
+
+// The last good receivers of ConfigMap and ClusterReceivers.
+var sinkReceivers, clusterReceivers []exporter.Receiver
 
 func init() {
 	flag.StringVar(&webhookName, "rule-webhook-name", "", "webhook name")
@@ -49,7 +70,7 @@ func init() {
 func LoadConfig() error {
 	//Resolve the circular dependency, assign the local variable to a global variable.
 	once.Do(func() {
-		// Add event handler, to reload config when crd change
+		// Add event handler, to reload rules when crd change
 		ruleInf, err := cache.Cache().GetInformer(context.Background(), &v1alpha1.ClusterRuleGroup{})
 		if err != nil {
 			glog.Fatal(err)
@@ -57,64 +78,235 @@ func LoadConfig() error {
 		ruleInf.AddEventHandler(kcache.ResourceEventHandlerFuncs{
 			AddFunc: onChange,
 			UpdateFunc: func(oldObj, newObj interface{}) {
+				// Ignore the update of status.
+				o, ok1 := oldObj.(*v1alpha1.ClusterRuleGroup)
+				n, ok2 := newObj.(*v1alpha1.ClusterRuleGroup)
+				if ok1 && ok2 && o.Generation == n.Generation {
+					return
+				}
 				onChange(newObj)
 			},
 			DeleteFunc: onChange,
 		})
-	})
 
-	//load sink
-	sink, err := LoadSinks()
+		// Add event handler, to reload rules when the namespaced rule groups change
+		nsRuleInf, err := cache.Cache().GetInformer(context.Background(), &v1alpha1.RuleGroup{})
+		if err != nil {
+			glog.Fatal(err)
+		}
+		nsRuleInf.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+			AddFunc: onChange,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// Ignore the update of status.
+				o, ok1 := oldObj.(*v1alpha1.RuleGroup)
+				n, ok2 := newObj.(*v1alpha1.RuleGroup)
+				if ok1 && ok2 && o.Generation == n.Generation {
+					return
+				}
+				onChange(newObj)
+			},
+			DeleteFunc: onChange,
+		})
 
-	// Load config
-	conf, err := loadConfig(sink)
-	if err != nil {
-		return err
-	}
+		// Add event handler, to reload receivers when the configmap change
+		sinkInf, err := cache.Cache().GetInformer(context.Background(), &corev1.ConfigMap{})
+		if err != nil {
+			glog.Fatal(err)
+		}
+		sinkInf.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+			AddFunc: onSinkChange,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				onSinkChange(newObj)
+			},
+			DeleteFunc: onSinkChange,
+		})
 
-	config = conf
+		// Add event handler, to reload receivers when the cluster receivers change
+		receiverInf, err := cache.Cache().GetInformer(context.Background(), &v1alpha1.ClusterReceiver{})
+		if err != nil {
+			glog.Fatal(err)
+		}
+		receiverInf.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+			AddFunc: onSinkChange,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// Ignore the update of status.
+				o, ok1 := oldObj.(*v1alpha1.ClusterReceiver)
+				n, ok2 := newObj.(*v1alpha1.ClusterReceiver)
+				if ok1 && ok2 && o.Generation == n.Generation {
+					return
+				}
+				onSinkChange(newObj)
+			},
+			DeleteFunc: onSinkChange,
+		})
 
-	// Init the alert receivers.
-	// The receiver must determine whether it will reconnect or not when config reload.
-	errs := exporter.Connect(conf.Receivers)
-	if errs != nil && len(errs) > 0 {
-		glog.Errorf("init receivers err")
-		for _, e := range errs {
-			glog.Error(e)
+		// Add event handler, to reload silences when the silences change
+		silenceInf, err := cache.Cache().GetInformer(context.Background(), &v1alpha1.Silence{})
+		if err != nil {
+			glog.Fatal(err)
 		}
+		silenceInf.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+			AddFunc: onSilenceChange,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// Ignore the update of status.
+				o, ok1 := oldObj.(*v1alpha1.Silence)
+				n, ok2 := newObj.(*v1alpha1.Silence)
+				if ok1 && ok2 && o.Generation == n.Generation {
+					return
+				}
+				onSilenceChange(newObj)
+			},
+			DeleteFunc: onSilenceChange,
+		})
+
+		go updateReceiverStatus()
+		go updateSilenceStatus()
+		go updateRuleStatus()
+	})
+
+	if err := loadRules(); err != nil {
+		return err
 	}
 
+	loadReceivers()
+	loadSilences()
+
+	// The changes during the first load are buffered in the channel, and reloaded after it.
+	reloadOnce.Do(func() {
+		go reloadRules()
+		go reloadReceivers()
+	})
+
 	return nil
 }
 
 func GetConfig() *Config {
+	mutex.Lock()
+	defer mutex.Unlock()
+
 	return config
 }
 
 func onChange(_ interface{}) {
-	// On crd change, reload config
-	if err := LoadConfig(); err != nil {
-		glog.Errorf("reload config error, %s", err)
+	// On crd change, reload rules
+	triggerRules()
+}
+
+// reloadRules reload the rules when they are triggered.
+func reloadRules() {
+	for range rulesCh {
+		if err := loadRules(); err != nil {
+			glog.Errorf("reload rules error, %s", err)
+			metrics.RuleLoadErrors.Inc()
+			continue
+		}
+		glog.Infof("reload rules")
+	}
+}
+
+func triggerRules() {
+	select {
+	case rulesCh <- struct{}{}:
+	default:
+	}
+}
+
+func onSinkChange(_ interface{}) {
+	// On configmap change, reload receivers
+	triggerReceivers()
+}
+
+// reloadReceivers reload the receivers when they are triggered.
+func reloadReceivers() {
+	for range receiversCh {
+		loadReceivers()
+	}
+}
+
+func triggerReceivers() {
+	select {
+	case receiversCh <- struct{}{}:
+	default:
+	}
+}
+
+// loadRules reload the rules, and keep the receivers.
+// It must not run concurrently, the changes are reloaded by reloadRules.
+func loadRules() error {
+
+	rules, err := ruleLoader()
+	if err != nil {
+		return err
 	}
-	glog.Errorf("reload config")
+	metrics.RuleReloads.Inc()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	conf := &Config{Rules: rules, RulesByType: rule.RulesByType(rules), Sequences: rule.Sequences(rules)}
+	if config != nil {
+		conf.Receivers = config.Receivers
+	}
+	config = conf
+	triggerRuleStatus()
+
+	return nil
 }
 
-func loadConfig(sink *exporter.Sink) (*Config, error) {
+// loadReceivers reload the receivers from the ConfigMap and ClusterReceivers, and keep the rules.
+// The last good receivers are kept if the sink config is missing or invalid,
+// the invalid ClusterReceiver is skipped and reported in its status.
+// It must not run concurrently, the changes are reloaded by reloadReceivers.
+func loadReceivers() {
 
-	conf := &Config{}
+	mutex.Lock()
+	sinks, crs := sinkReceivers, clusterReceivers
+	mutex.Unlock()
 
-	if sink == nil  {
-		conf.Receivers =nil
+	if sink, err := LoadSinks(); err != nil {
+		glog.Errorf("load sinks error, %s, keep the current receivers of configmap", err)
+	} else if errs := exporter.Validate(sink.Receivers); len(errs) > 0 {
+		glog.Errorf("the receivers of configmap are invalid, keep the current receivers of configmap")
+		for _, e := range errs {
+			glog.Error(e)
+		}
 	} else {
-			conf.Receivers = sink.Receivers
+		sinks = sink.Receivers
 	}
 
-	// Load rules
-	var err error
-	conf.Rules, err = rule.LoadRule()
+	receivers, states, err := loadClusterReceivers()
 	if err != nil {
-		return nil, err
+		glog.Errorf("load cluster receivers error, %s, keep the current cluster receivers", err)
+	} else {
+		crs = receivers
+	}
+
+	// The receiver must determine whether it will reconnect or not when config reload.
+	all := mergeReceivers(sinks, crs)
+	errs := exporter.Connect(all)
+	if len(errs) > 0 {
+		glog.Errorf("init receivers err, keep the current receivers")
+		for _, e := range errs {
+			glog.Error(e)
+		}
+		return
 	}
 
-	return conf, nil
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	sinkReceivers, clusterReceivers = sinks, crs
+	if states != nil {
+		receiverStates = states
+	}
+
+	conf := &Config{Receivers: all}
+	if config != nil {
+		conf.Rules = config.Rules
+		conf.RulesByType = config.RulesByType
+		conf.Sequences = config.Sequences
+	}
+	config = conf
+
+	glog.Infof("reload receivers")
 }
@@ -0,0 +1,136 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package config
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func testRuleSpec(name string) v1alpha1.ClusterRuleGroupRuleSpec {
+	return v1alpha1.ClusterRuleGroupRuleSpec{
+		Type: rule.AuditingType,
+		Rules: []v1alpha1.Rule{{
+			Name:      name,
+			Enable:    pointer.Bool(true),
+			Expr:      v1alpha1.Expr{Kind: rule.KindRule, Condition: `Verb = "delete"`},
+			Alerts:    v1alpha1.Alerts{Severity: "WARNING"},
+			Threshold: &v1alpha1.Threshold{Count: 2, Window: metav1.Duration{Duration: time.Hour}},
+		}},
+	}
+}
+
+// waitRules wait until the stored config has n rules.
+func waitRules(t *testing.T, n int) *Config {
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if c := GetConfig(); c != nil && len(c.Rules) == n {
+			return c
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the rules are not reloaded to %d rules", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestConcurrentRuleGroupChanges apply the changes of ClusterRuleGroups and RuleGroups concurrently, and expect
+// the loads not to overlap, the last changes to be stored, and the states of the stored rules to be kept.
+func TestConcurrentRuleGroupChanges(t *testing.T) {
+
+	var storeMutex sync.Mutex
+	var groups []v1alpha1.ClusterRuleGroup
+	var namespaced []v1alpha1.RuleGroup
+	var loading int32
+	ruleLoader = func() (map[string]rule.Rule, error) {
+		if atomic.AddInt32(&loading, 1) > 1 {
+			t.Error("the rules are loaded concurrently")
+		}
+		defer atomic.AddInt32(&loading, -1)
+
+		storeMutex.Lock()
+		gs := append([]v1alpha1.ClusterRuleGroup(nil), groups...)
+		ns := append([]v1alpha1.RuleGroup(nil), namespaced...)
+		storeMutex.Unlock()
+		// Widen the window between listing and storing.
+		time.Sleep(time.Millisecond)
+		return rule.LoadRuleGroups(gs, ns), nil
+	}
+	defer func() {
+		ruleLoader = rule.LoadRule
+	}()
+	go reloadRules()
+
+	n := 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			storeMutex.Lock()
+			groups = append(groups, v1alpha1.ClusterRuleGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("crg-%d", i)},
+				Spec:       testRuleSpec("rule"),
+			})
+			storeMutex.Unlock()
+			onChange(nil)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			storeMutex.Lock()
+			namespaced = append(namespaced, v1alpha1.RuleGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("rg-%d", i), Namespace: "default"},
+				Spec:       testRuleSpec("rule"),
+			})
+			storeMutex.Unlock()
+			onChange(nil)
+		}(i)
+	}
+	wg.Wait()
+
+	c := waitRules(t, 2*n)
+	f := rule.MapFields(map[string]interface{}{"Verb": "delete"})
+	now := time.Now()
+	for name := range c.Rules {
+		r := c.Rules[name]
+		if _, fired := r.Observe(f, now); fired {
+			t.Fatalf("%s fired by the first event", name)
+		}
+	}
+
+	// The unchanged rules keep the counts after another reload.
+	storeMutex.Lock()
+	groups = append(groups, v1alpha1.ClusterRuleGroup{ObjectMeta: metav1.ObjectMeta{Name: "crg-last"}, Spec: testRuleSpec("rule")})
+	storeMutex.Unlock()
+	onChange(nil)
+	c = waitRules(t, 2*n+1)
+	for name := range c.Rules {
+		r := c.Rules[name]
+		_, fired := r.Observe(f, now)
+		if want := name != "crg-last.rule"; fired != want {
+			t.Errorf("%s: fired %t, want %t", name, fired, want)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/cache"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/exporter"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	receiverStatusInterval = 30 * time.Second
+)
+
+// The state of a ClusterReceiver when it was loaded.
+type clusterReceiverState struct {
+	generation int64
+	// The reason why the ClusterReceiver is invalid, empty if it is valid.
+	invalid string
+	// The secret keys referenced by the ClusterReceiver and their values when it was loaded.
+	secrets map[secretKey]secretValue
+}
+
+// secretKey is a key of Secret referenced by a ClusterReceiver.
+type secretKey struct {
+	namespace string
+	name      string
+	key       string
+}
+
+func (k secretKey) String() string {
+	return fmt.Sprintf("%s/%s[%s]", k.namespace, k.name, k.key)
+}
+
+type secretValue struct {
+	value string
+	// False if the secret or the key was not found.
+	found bool
+}
+
+var receiverStates map[string]clusterReceiverState
+
+// secretReader read the value of the secret key, false if the secret or the key is not found.
+var secretReader = readSecret
+
+// loadClusterReceivers load the receivers from the ClusterReceivers.
+// The invalid ClusterReceiver is skipped, the state of every ClusterReceiver is returned with the receivers.
+func loadClusterReceivers() ([]exporter.Receiver, map[string]clusterReceiverState, error) {
+
+	crs := &v1alpha1.ClusterReceiverList{}
+	if err := cache.Cache().List(context.Background(), crs); err != nil {
+		return nil, nil, fmt.Errorf("failed to list cluster receivers, %s", err)
+	}
+
+	var receivers []exporter.Receiver
+	states := make(map[string]clusterReceiverState)
+	for i := range crs.Items {
+		cr := &crs.Items[i]
+		state := clusterReceiverState{generation: cr.Generation, secrets: make(map[secretKey]secretValue)}
+
+		receiver, err := toReceiver(cr, state.secrets)
+		if err == nil {
+			if errs := exporter.Validate([]exporter.Receiver{*receiver}); len(errs) > 0 {
+				err = errs[0]
+			}
+		}
+
+		if err != nil {
+			glog.Errorf("cluster receiver %s is invalid, %s", cr.Name, err)
+			state.invalid = err.Error()
+		} else {
+			receivers = append(receivers, *receiver)
+		}
+		states[cr.Name] = state
+	}
+
+	return receivers, states, nil
+}
+
+// toReceiver convert the ClusterReceiver to the receiver, the secrets referenced by the ClusterReceiver are resolved,
+// and the values are recorded in secrets.
+func toReceiver(cr *v1alpha1.ClusterReceiver, secrets map[secretKey]secretValue) (*exporter.Receiver, error) {
+
+	receiver := &exporter.Receiver{
+		ReceiverName: cr.Name,
+		ReceiverType: cr.Spec.Type,
+	}
+
+	var err error
+	switch cr.Spec.Type {
+	case constant.WebhookReceiver:
+		if cr.Spec.Webhook == nil {
+			return nil, fmt.Errorf("webhook is required when the type is %s", cr.Spec.Type)
+		}
+		if receiver.ReceiverConfig, err = toClientConfig(&cr.Spec.Webhook.ClientConfig, secrets); err != nil {
+			return nil, err
+		}
+		receiver.PayloadSchema = cr.Spec.Webhook.PayloadSchema
+	case constant.NotificationManagerReciver:
+		if cr.Spec.NotificationManager == nil {
+			return nil, fmt.Errorf("notificationManager is required when the type is %s", cr.Spec.Type)
+		}
+		if receiver.ReceiverConfig, err = toClientConfig(&cr.Spec.NotificationManager.ClientConfig, secrets); err != nil {
+			return nil, err
+		}
+	case constant.AlertManagerReciver:
+		if cr.Spec.Alertmanager == nil {
+			return nil, fmt.Errorf("alertmanager is required when the type is %s", cr.Spec.Type)
+		}
+		for i := range cr.Spec.Alertmanager.Endpoints {
+			c, err := toClientConfig(&cr.Spec.Alertmanager.Endpoints[i], secrets)
+			if err != nil {
+				return nil, err
+			}
+			receiver.Endpoints = append(receiver.Endpoints, c)
+		}
+		receiver.GeneratorURL = cr.Spec.Alertmanager.GeneratorURL
+		if cr.Spec.Alertmanager.ResolveTimeout != nil {
+			receiver.ResolveTimeout = cr.Spec.Alertmanager.ResolveTimeout.Duration
+		}
+	default:
+		return nil, fmt.Errorf("unsupported receiver type %s", cr.Spec.Type)
+	}
+
+	if d := cr.Spec.Delivery; d != nil {
+		if d.Timeout != nil {
+			receiver.Delivery.Timeout = d.Timeout.Duration
+		}
+		if d.QueueSize != nil {
+			receiver.Delivery.QueueSize = int(*d.QueueSize)
+		}
+		if d.MaxRetries != nil {
+			receiver.Delivery.MaxRetries = int(*d.MaxRetries)
+		}
+		if d.MinBackoff != nil {
+			receiver.Delivery.MinBackoff = d.MinBackoff.Duration
+		}
+		if d.MaxBackoff != nil {
+			receiver.Delivery.MaxBackoff = d.MaxBackoff.Duration
+		}
+	}
+
+	if m := cr.Spec.Match; m != nil {
+		receiver.Match = (&exporter.Match{
+			Severities: m.Severities,
+			Types:      m.Types,
+			Groups:     m.Groups,
+			Rules:      m.Rules,
+			Labels:     m.Labels,
+		}).DeepCopy()
+	}
+
+	if d := cr.Spec.Dedup; d != nil {
+		receiver.Dedup = (&exporter.Dedup{
+			Window: d.Window.Duration,
+			Labels: d.Labels,
+		}).DeepCopy()
+	}
+
+	return receiver, nil
+}
+
+func toClientConfig(c *v1alpha1.ClientConfig, secrets map[secretKey]secretValue) (exporter.WebhookClientConfig, error) {
+
+	config := exporter.WebhookClientConfig{
+		URL:      c.URL,
+		CABundle: c.CABundle,
+	}
+
+	if c.Service != nil {
+		config.Service = &exporter.ServiceReference{
+			Namespace: c.Service.Namespace,
+			Name:      c.Service.Name,
+			Path:      c.Service.Path,
+			Port:      c.Service.Port,
+		}
+	}
+
+	if c.CA != nil {
+		ca, err := getSecretValue(c.CA, secrets)
+		if err != nil {
+			return config, err
+		}
+		config.CABundle = []byte(ca)
+	}
+
+	if c.BearerToken != nil {
+		token, err := getSecretValue(c.BearerToken, secrets)
+		if err != nil {
+			return config, err
+		}
+		config.BearerToken = token
+	}
+
+	if c.BasicAuth != nil {
+		config.BasicAuth = &exporter.BasicAuth{Username: c.BasicAuth.Username}
+		if c.BasicAuth.Password != nil {
+			password, err := getSecretValue(c.BasicAuth.Password, secrets)
+			if err != nil {
+				return config, err
+			}
+			config.BasicAuth.Password = password
+		}
+	}
+
+	return *config.DeepCopy(), nil
+}
+
+// getSecretValue resolve the secret key, and record the value in secrets. The secret must be in the namespace
+// of ruler, so a ClusterReceiver could not read the secrets of other namespaces.
+func getSecretValue(selector *v1alpha1.SecretKeySelector, secrets map[secretKey]secretValue) (string, error) {
+
+	namespace := utils.GetNamespace()
+	if len(selector.Namespace) > 0 && selector.Namespace != namespace {
+		return "", fmt.Errorf("secret %s/%s is not in the namespace %s of ruler", selector.Namespace, selector.Name, namespace)
+	}
+
+	key := secretKey{namespace: namespace, name: selector.Name, key: selector.Key}
+	value, found, err := secretReader(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s/%s, %s", namespace, selector.Name, err)
+	}
+	secrets[key] = secretValue{value: value, found: found}
+	if !found {
+		return "", fmt.Errorf("secret %s is not found", key)
+	}
+
+	return value, nil
+}
+
+func readSecret(key secretKey) (string, bool, error) {
+
+	secret := &corev1.Secret{}
+	if err := cache.Client().Get(context.Background(), types.NamespacedName{Namespace: key.namespace, Name: key.name}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	value, ok := secret.Data[key.key]
+	return string(value), ok, nil
+}
+
+// secretsChanged return true if any secret key referenced by the ClusterReceivers is changed since they were
+// loaded. The secrets are read periodically instead of watched, so the secrets of the namespace are not cached.
+func secretsChanged() bool {
+
+	mutex.Lock()
+	states := receiverStates
+	mutex.Unlock()
+
+	for name, state := range states {
+		for key, loaded := range state.secrets {
+			value, found, err := secretReader(key)
+			if err != nil {
+				glog.Errorf("failed to get secret %s of cluster receiver %s, %s", key, name, err)
+				continue
+			}
+			if found != loaded.found || value != loaded.value {
+				glog.Infof("secret %s of cluster receiver %s changed", key, name)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// mergeReceivers merge the receivers of ConfigMap and ClusterReceivers,
+// the ClusterReceiver is used when both of them have the same name.
+func mergeReceivers(sinkReceivers, clusterReceivers []exporter.Receiver) []exporter.Receiver {
+
+	names := make(map[string]bool)
+	for _, r := range clusterReceivers {
+		names[r.ReceiverName] = true
+	}
+
+	var receivers []exporter.Receiver
+	for _, r := range sinkReceivers {
+		if names[r.ReceiverName] {
+			glog.Warningf("receiver %s is overridden by the cluster receiver with the same name", r.ReceiverName)
+			continue
+		}
+		receivers = append(receivers, r)
+	}
+
+	return append(receivers, clusterReceivers...)
+}
+
+// updateReceiverStatus update the status of ClusterReceivers periodically,
+// and reload the receivers if the secrets referenced by ClusterReceivers changed.
+func updateReceiverStatus() {
+	for {
+		syncReceiverStatus()
+		if secretsChanged() {
+			triggerReceivers()
+		}
+		time.Sleep(receiverStatusInterval)
+	}
+}
+
+func syncReceiverStatus() {
+
+	mutex.Lock()
+	states := receiverStates
+	mutex.Unlock()
+
+	crs := &v1alpha1.ClusterReceiverList{}
+	if err := cache.Cache().List(context.Background(), crs); err != nil {
+		glog.Errorf("failed to list cluster receivers, %s", err)
+		return
+	}
+
+	for i := range crs.Items {
+		cr := &crs.Items[i]
+		state, ok := states[cr.Name]
+		if !ok {
+			continue
+		}
+
+		status := v1alpha1.ClusterReceiverStatus{ObservedGeneration: state.generation}
+		if len(state.invalid) > 0 {
+			status.State = v1alpha1.ReceiverStateInvalid
+			status.Message = state.invalid
+		} else {
+			rs, ok := exporter.GetReceiverStatus(cr.Name)
+			if !ok {
+				continue
+			}
+
+			status.State = v1alpha1.ReceiverStateConnected
+			if rs.Failing() {
+				status.State = v1alpha1.ReceiverStateFailing
+			}
+			status.LastError = rs.LastError
+			if !rs.LastErrorTime.IsZero() {
+				status.LastErrorTime = &metav1.Time{Time: rs.LastErrorTime}
+			}
+			if !rs.LastDeliveryTime.IsZero() {
+				status.LastDeliveryTime = &metav1.Time{Time: rs.LastDeliveryTime}
+			}
+		}
+
+		if statusEqual(&cr.Status, &status) {
+			continue
+		}
+
+		cr = cr.DeepCopy()
+		cr.Status = status
+		if err := cache.Client().Status().Update(context.Background(), cr); err != nil {
+			glog.Errorf("failed to update status of cluster receiver %s, %s", cr.Name, err)
+		}
+	}
+}
+
+// statusEqual compare the status, the times are compared in seconds which is the precision stored in api server.
+func statusEqual(s1, s2 *v1alpha1.ClusterReceiverStatus) bool {
+
+	truncate := func(s *v1alpha1.ClusterReceiverStatus) v1alpha1.ClusterReceiverStatus {
+		out := *s.DeepCopy()
+		if out.LastErrorTime != nil {
+			out.LastErrorTime.Time = out.LastErrorTime.Time.Truncate(time.Second).UTC()
+		}
+		if out.LastDeliveryTime != nil {
+			out.LastDeliveryTime.Time = out.LastDeliveryTime.Time.Truncate(time.Second).UTC()
+		}
+		return out
+	}
+
+	return reflect.DeepEqual(truncate(s1), truncate(s2))
+}
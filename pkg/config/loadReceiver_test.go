@@ -0,0 +1,145 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"testing"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeSecrets replace the secret reader with the values, the key of values is namespace/name[key].
+func fakeSecrets(t *testing.T, values map[string]string, err *error) {
+	saved := secretReader
+	secretReader = func(key secretKey) (string, bool, error) {
+		if *err != nil {
+			return "", false, *err
+		}
+		v, ok := values[key.String()]
+		return v, ok, nil
+	}
+	t.Cleanup(func() { secretReader = saved })
+}
+
+func webhookReceiver(token *v1alpha1.SecretKeySelector) *v1alpha1.ClusterReceiver {
+	url := "http://receiver:8080"
+	return &v1alpha1.ClusterReceiver{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook"},
+		Spec: v1alpha1.ClusterReceiverSpec{
+			Type: constant.WebhookReceiver,
+			Webhook: &v1alpha1.WebhookReceiver{
+				ClientConfig: v1alpha1.ClientConfig{URL: &url, BearerToken: token},
+			},
+		},
+	}
+}
+
+func TestReceiverSecrets(t *testing.T) {
+
+	ns := utils.GetNamespace()
+	var readErr error
+	fakeSecrets(t, map[string]string{
+		fmt.Sprintf("%s/token[token]", ns): "secret",
+		"other/token[token]":               "other",
+	}, &readErr)
+
+	tests := []struct {
+		name     string
+		selector v1alpha1.SecretKeySelector
+		token    string
+		invalid  bool
+	}{
+		{name: "default namespace", selector: v1alpha1.SecretKeySelector{Name: "token", Key: "token"}, token: "secret"},
+		{name: "namespace of ruler", selector: v1alpha1.SecretKeySelector{Namespace: ns, Name: "token", Key: "token"}, token: "secret"},
+		{name: "other namespace", selector: v1alpha1.SecretKeySelector{Namespace: "other", Name: "token", Key: "token"}, invalid: true},
+		{name: "key not found", selector: v1alpha1.SecretKeySelector{Name: "token", Key: "password"}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector := tt.selector
+			secrets := make(map[secretKey]secretValue)
+			receiver, err := toReceiver(webhookReceiver(&selector), secrets)
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("the receiver should be invalid")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if receiver.ReceiverConfig.BearerToken != tt.token {
+				t.Errorf("token: got %q, want %q", receiver.ReceiverConfig.BearerToken, tt.token)
+			}
+			if len(secrets) != 1 {
+				t.Errorf("got secrets %v, want 1", secrets)
+			}
+		})
+	}
+}
+
+func TestSecretsChanged(t *testing.T) {
+
+	ns := utils.GetNamespace()
+	values := map[string]string{fmt.Sprintf("%s/token[token]", ns): "secret"}
+	var readErr error
+	fakeSecrets(t, values, &readErr)
+
+	load := func(key string) {
+		secrets := make(map[secretKey]secretValue)
+		_, _ = toReceiver(webhookReceiver(&v1alpha1.SecretKeySelector{Name: "token", Key: key}), secrets)
+		mutex.Lock()
+		receiverStates = map[string]clusterReceiverState{"webhook": {secrets: secrets}}
+		mutex.Unlock()
+	}
+	defer func() {
+		mutex.Lock()
+		receiverStates = nil
+		mutex.Unlock()
+	}()
+
+	load("token")
+	if secretsChanged() {
+		t.Error("the secret is not changed")
+	}
+
+	readErr = fmt.Errorf("timeout")
+	values[fmt.Sprintf("%s/token[token]", ns)] = "rotated"
+	if secretsChanged() {
+		t.Error("the secret could not be read, it should not be changed")
+	}
+
+	readErr = nil
+	if !secretsChanged() {
+		t.Error("the secret is rotated")
+	}
+
+	// The receiver referencing a missing key is reloaded when the key is created.
+	load("password")
+	if secretsChanged() {
+		t.Error("the key is still missing")
+	}
+	values[fmt.Sprintf("%s/token[password]", ns)] = "password"
+	if !secretsChanged() {
+		t.Error("the key is created")
+	}
+}
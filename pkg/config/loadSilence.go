@@ -0,0 +1,208 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"flag"
+	"reflect"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/cache"
+	"whizard-telemetry-ruler/pkg/exporter"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	silenceStatusInterval = 30 * time.Second
+)
+
+var silenceRetention time.Duration
+
+// The alerts suppressed but not written to the status yet, by silence.
+var pendingSuppressed = make(map[string]*exporter.Suppressed)
+
+// The suppressed totals last written to the status, by silence. The status read from the informer cache
+// may not include the last update yet, the counts would be lost if they were added to it.
+var writtenSuppressed = make(map[string]suppressedTotal)
+
+type suppressedTotal struct {
+	uid   types.UID
+	total int64
+}
+
+func init() {
+	flag.DurationVar(&silenceRetention, "silence-retention", 24*time.Hour, "The duration an expired silence is kept before it is deleted")
+}
+
+func onSilenceChange(_ interface{}) {
+	loadSilences()
+}
+
+// loadSilences reload the silences, the invalid silence is skipped and reported in its status.
+func loadSilences() {
+
+	ss := &v1alpha1.SilenceList{}
+	if err := cache.Cache().List(context.Background(), ss); err != nil {
+		glog.Errorf("failed to list silences, %s", err)
+		return
+	}
+
+	var silences []exporter.Silence
+	for i := range ss.Items {
+		s := toSilence(&ss.Items[i])
+		if err := exporter.ValidateSilence(s); err != nil {
+			glog.Errorf("silence %s is invalid, %s", s.Name, err)
+			continue
+		}
+		silences = append(silences, *s)
+	}
+
+	exporter.SetSilences(silences)
+	glog.Infof("reload silences")
+}
+
+func toSilence(s *v1alpha1.Silence) *exporter.Silence {
+
+	silence := &exporter.Silence{
+		Name:     s.Name,
+		StartsAt: s.CreationTimestamp.Time,
+		EndsAt:   s.Spec.EndsAt.Time,
+	}
+	if s.Spec.StartsAt != nil {
+		silence.StartsAt = s.Spec.StartsAt.Time
+	}
+	for _, m := range s.Spec.Matchers {
+		silence.Matchers = append(silence.Matchers, exporter.SilenceMatcher{
+			Label:   m.Label,
+			Field:   m.Field,
+			Value:   m.Value,
+			IsRegex: m.IsRegex,
+		})
+	}
+
+	return silence
+}
+
+// updateSilenceStatus update the status of silences and delete the expired silences periodically.
+func updateSilenceStatus() {
+	for {
+		time.Sleep(silenceStatusInterval)
+		syncSilenceStatus()
+	}
+}
+
+func syncSilenceStatus() {
+
+	for name, s := range exporter.TakeSuppressed() {
+		p, ok := pendingSuppressed[name]
+		if !ok {
+			pendingSuppressed[name] = s
+			continue
+		}
+		p.Count += s.Count
+		p.Last = s.Last
+	}
+
+	ss := &v1alpha1.SilenceList{}
+	if err := cache.Cache().List(context.Background(), ss); err != nil {
+		glog.Errorf("failed to list silences, %s", err)
+		return
+	}
+
+	now := time.Now()
+	names := make(map[string]bool)
+	for i := range ss.Items {
+		s := &ss.Items[i]
+		names[s.Name] = true
+
+		if !now.Before(s.Spec.EndsAt.Add(silenceRetention)) {
+			if err := cache.Client().Delete(context.Background(), s); client.IgnoreNotFound(err) != nil {
+				glog.Errorf("failed to delete expired silence %s, %s", s.Name, err)
+				continue
+			}
+			glog.Infof("delete expired silence %s", s.Name)
+			delete(pendingSuppressed, s.Name)
+			delete(writtenSuppressed, s.Name)
+			continue
+		}
+
+		status := s.Status.DeepCopy()
+		status.ObservedGeneration = s.Generation
+		status.Message = ""
+		silence := toSilence(s)
+		switch err := exporter.ValidateSilence(silence); {
+		case err != nil:
+			status.State = v1alpha1.SilenceStateInvalid
+			status.Message = err.Error()
+		case now.Before(silence.StartsAt):
+			status.State = v1alpha1.SilenceStatePending
+		case now.Before(silence.EndsAt):
+			status.State = v1alpha1.SilenceStateActive
+		default:
+			status.State = v1alpha1.SilenceStateExpired
+		}
+
+		status.Suppressed = lastSuppressed(s)
+		p := pendingSuppressed[s.Name]
+		if p != nil {
+			status.Suppressed += p.Count
+			status.LastSuppressedTime = &metav1.Time{Time: p.Last.Truncate(time.Second)}
+		}
+
+		if reflect.DeepEqual(&s.Status, status) {
+			continue
+		}
+
+		s = s.DeepCopy()
+		s.Status = *status
+		if err := cache.Client().Status().Update(context.Background(), s); err != nil {
+			glog.Errorf("failed to update status of silence %s, %s", s.Name, err)
+			continue
+		}
+		delete(pendingSuppressed, s.Name)
+		writtenSuppressed[s.Name] = suppressedTotal{uid: s.UID, total: status.Suppressed}
+	}
+
+	// The counts of the deleted silences are dropped.
+	for name := range pendingSuppressed {
+		if !names[name] {
+			delete(pendingSuppressed, name)
+		}
+	}
+	for name := range writtenSuppressed {
+		if !names[name] {
+			delete(writtenSuppressed, name)
+		}
+	}
+}
+
+// lastSuppressed return the suppressed total of the status, or the total last written to it if the status
+// read from the cache is stale. The total of a silence recreated with the same name is not used.
+func lastSuppressed(s *v1alpha1.Silence) int64 {
+
+	w, ok := writtenSuppressed[s.Name]
+	if !ok || w.uid != s.UID || w.total < s.Status.Suppressed {
+		return s.Status.Suppressed
+	}
+
+	return w.total
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestLastSuppressed(t *testing.T) {
+
+	silence := func(uid string, suppressed int64) *v1alpha1.Silence {
+		return &v1alpha1.Silence{
+			ObjectMeta: metav1.ObjectMeta{Name: "maintenance", UID: types.UID(uid)},
+			Status:     v1alpha1.SilenceStatus{Suppressed: suppressed},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		written *suppressedTotal
+		silence *v1alpha1.Silence
+		want    int64
+	}{
+		{name: "never written", silence: silence("1", 3), want: 3},
+		{name: "stale cache", written: &suppressedTotal{uid: "1", total: 10}, silence: silence("1", 3), want: 10},
+		{name: "cache caught up", written: &suppressedTotal{uid: "1", total: 10}, silence: silence("1", 10), want: 10},
+		{name: "updated by others", written: &suppressedTotal{uid: "1", total: 10}, silence: silence("1", 12), want: 12},
+		{name: "recreated", written: &suppressedTotal{uid: "1", total: 10}, silence: silence("2", 0), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writtenSuppressed = make(map[string]suppressedTotal)
+			defer func() { writtenSuppressed = make(map[string]suppressedTotal) }()
+			if tt.written != nil {
+				writtenSuppressed["maintenance"] = *tt.written
+			}
+
+			if got := lastSuppressed(tt.silence); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,57 +19,44 @@ package config
 import (
 	"context"
 	"fmt"
-	"github.com/golang/glog"
-	"gopkg.in/yaml.v3"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"os"
-	kubeconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"strings"
+	"whizard-telemetry-ruler/pkg/cache"
 	"whizard-telemetry-ruler/pkg/constant"
 	"whizard-telemetry-ruler/pkg/exporter"
 	"whizard-telemetry-ruler/pkg/utils"
-)
 
-func LoadSinks() (*exporter.Sink, error) {
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
 
-	// Load Kubernetes config
-	k8sConfig, err := kubeconfig.GetConfig()
-	if err != nil {
-		fmt.Printf("Error loading kubeconfig: %v\n", err)
-		return nil, err
-	}
+const (
+	sinkConfigKey = "config"
+)
 
-	// Create Kubernetes clientset
-	clientset, err := kubernetes.NewForConfig(k8sConfig)
-	if err != nil {
-		fmt.Printf("Error creating Kubernetes clientset: %v\n", err)
-		return nil, err
-	}
+// LoadSinks load the receivers from the config of ConfigMap whizard-telemetry-ruler.
+// An empty config means there is no receiver.
+func LoadSinks() (*exporter.Sink, error) {
 
-	ns := os.Getenv("NAMESPACE")
-	if len(ns) == 0 {
-		ns = constant.DefaultNamespace
+	configmap := &corev1.ConfigMap{}
+	key := types.NamespacedName{Namespace: utils.GetNamespace(), Name: constant.WhizardTelemetryRuler}
+	if err := cache.Cache().Get(context.Background(), key, configmap); err != nil {
+		return nil, fmt.Errorf("failed to get configmap %s, %s", key, err)
 	}
 
-	configmap, err := clientset.CoreV1().ConfigMaps(ns).Get(context.Background(), "whizard-telemetry-ruler", metav1.GetOptions{})
-	data, ok := configmap.Data["config"]
+	data, ok := configmap.Data[sinkConfigKey]
 	if !ok {
-		glog.Errorf("Failed to get configmap : %v", err)
-		return nil, fmt.Errorf("failed to get configmap")
+		return nil, fmt.Errorf("%s not found in configmap %s", sinkConfigKey, key)
 	}
 
-	if data == "" {
-		fmt.Printf("receiver is empty, please check configmap")
-		return nil, fmt.Errorf("failed to get configmap")
+	sink := &exporter.Sink{}
+	if len(strings.TrimSpace(data)) == 0 {
+		return sink, nil
 	}
 
-	var sink *exporter.Sink
-	err = yaml.Unmarshal([]byte(data), &sink)
-	if err != nil {
-		glog.Errorf("json decode failed : %v", err)
-		return nil, fmt.Errorf("failed to get configmap")
+	if err := yaml.Unmarshal([]byte(data), sink); err != nil {
+		return nil, fmt.Errorf("failed to decode %s of configmap %s, %s", sinkConfigKey, key, err)
 	}
-	fmt.Println("-------------------")
-    fmt.Println(utils.ToJsonString(sink))
-	return sink, err
+
+	return sink, nil
 }
@@ -0,0 +1,187 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/cache"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	ruleStatusInterval = 30 * time.Second
+)
+
+// Trigger a sync of the status of rule groups after the rules are reloaded.
+var ruleStatusCh = make(chan struct{}, 1)
+
+// updateRuleStatus update the status of ClusterRuleGroups and RuleGroups periodically, and after the rules are reloaded.
+func updateRuleStatus() {
+	for {
+		syncRuleStatus()
+		select {
+		case <-ruleStatusCh:
+		case <-time.After(ruleStatusInterval):
+		}
+	}
+}
+
+func triggerRuleStatus() {
+	select {
+	case ruleStatusCh <- struct{}{}:
+	default:
+	}
+}
+
+func syncRuleStatus() {
+
+	crgs := &v1alpha1.ClusterRuleGroupList{}
+	if err := cache.Cache().List(context.Background(), crgs); err != nil {
+		glog.Errorf("failed to list cluster rule groups, %s", err)
+		return
+	}
+	for i := range crgs.Items {
+		crg := &crgs.Items[i]
+		status, ok := groupStatus(crg.Name, &crg.Status)
+		if !ok {
+			continue
+		}
+
+		crg = crg.DeepCopy()
+		crg.Status = *status
+		updateRuleGroupStatus(crg, crg.Name)
+	}
+
+	rgs := &v1alpha1.RuleGroupList{}
+	if err := cache.Cache().List(context.Background(), rgs); err != nil {
+		glog.Errorf("failed to list rule groups, %s", err)
+		return
+	}
+	for i := range rgs.Items {
+		rg := &rgs.Items[i]
+		name := fmt.Sprintf("%s/%s", rg.Namespace, rg.Name)
+		status, ok := groupStatus(name, &rg.Status)
+		if !ok {
+			continue
+		}
+
+		rg = rg.DeepCopy()
+		rg.Status = *status
+		updateRuleGroupStatus(rg, name)
+	}
+}
+
+func updateRuleGroupStatus(obj client.Object, name string) {
+	if err := cache.Client().Status().Update(context.Background(), obj); err != nil {
+		glog.Errorf("failed to update status of rule group %s, %s", name, err)
+	}
+}
+
+// groupStatus return the status of the group built from the validation result of the last
+// loaded rules, and false if the group is not loaded or the status is unchanged.
+func groupStatus(group string, current *v1alpha1.ClusterRuleGroupRuleStatus) (*v1alpha1.ClusterRuleGroupRuleStatus, bool) {
+
+	gr, ok := rule.GetGroupResult(group)
+	if !ok {
+		return nil, false
+	}
+
+	status := &v1alpha1.ClusterRuleGroupRuleStatus{
+		Conditions:         append([]metav1.Condition(nil), current.Conditions...),
+		ObservedGeneration: gr.Generation,
+	}
+
+	var invalid []string
+	for _, r := range gr.Rules {
+		rs := v1alpha1.RuleStatus{
+			Name:      r.Name,
+			Valid:     r.Valid,
+			Condition: r.Condition,
+			Error:     r.Error,
+		}
+		if t, ok := rule.GetLastMatchTime(group, r.Name); ok {
+			rs.LastMatchTime = &metav1.Time{Time: t.Truncate(time.Second)}
+		}
+		status.Rules = append(status.Rules, rs)
+
+		if r.Valid {
+			status.ValidRules++
+		} else {
+			status.InvalidRules++
+			invalid = append(invalid, r.Name)
+		}
+	}
+
+	ready := metav1.Condition{
+		Type:               v1alpha1.RuleGroupReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "RulesLoaded",
+		Message:            "all rules are valid",
+		ObservedGeneration: gr.Generation,
+	}
+	invalidCond := metav1.Condition{
+		Type:               v1alpha1.RuleGroupInvalid,
+		Status:             metav1.ConditionFalse,
+		Reason:             "RulesLoaded",
+		ObservedGeneration: gr.Generation,
+	}
+	if len(invalid) > 0 {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "InvalidRules"
+		ready.Message = fmt.Sprintf("%d of %d rules are invalid", len(invalid), len(gr.Rules))
+		invalidCond.Status = metav1.ConditionTrue
+		invalidCond.Reason = "InvalidRules"
+		invalidCond.Message = fmt.Sprintf("invalid rules: %s", strings.Join(invalid, ", "))
+	}
+	meta.SetStatusCondition(&status.Conditions, ready)
+	meta.SetStatusCondition(&status.Conditions, invalidCond)
+
+	if ruleStatusEqual(current, status) {
+		return nil, false
+	}
+
+	return status, true
+}
+
+// ruleStatusEqual compare the status, the times are compared in seconds which is the precision stored in api server.
+func ruleStatusEqual(s1, s2 *v1alpha1.ClusterRuleGroupRuleStatus) bool {
+
+	truncate := func(s *v1alpha1.ClusterRuleGroupRuleStatus) v1alpha1.ClusterRuleGroupRuleStatus {
+		out := *s.DeepCopy()
+		for i := range out.Conditions {
+			out.Conditions[i].LastTransitionTime.Time = out.Conditions[i].LastTransitionTime.Time.Truncate(time.Second).UTC()
+		}
+		for i := range out.Rules {
+			if out.Rules[i].LastMatchTime != nil {
+				out.Rules[i].LastMatchTime.Time = out.Rules[i].LastMatchTime.Time.Truncate(time.Second).UTC()
+			}
+		}
+		return out
+	}
+
+	return reflect.DeepEqual(truncate(s1), truncate(s2))
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"fmt"
+	"time"
+	"whizard-telemetry-ruler/pkg/rule"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	AlertStatusFiring = "firing"
+
+	// The version of the Alertmanager webhook payload.
+	WebhookPayloadVersion = "4"
+)
+
+const (
+	// Send the alerts with the Alertmanager webhook payload.
+	PayloadSchemaAlertmanager = "alertmanager"
+	// Send the alerts with the payload which the Notification Manager received.
+	PayloadSchemaNotificationManager = "notificationmanager"
+)
+
+// WebhookMessage is the payload sent to webhook, it's same as the Alertmanager webhook payload.
+type WebhookMessage struct {
+	*template.Data
+
+	// The protocol version.
+	Version         string `json:"version"`
+	GroupKey        string `json:"groupKey"`
+	TruncatedAlerts uint64 `json:"truncatedAlerts"`
+}
+
+func auditingAlert(a *rule.Auditing) template.Alert {
+
+	// The non-resource requests, such as /healthz, have no ObjectRef.
+	var namespace, resource, name string
+	if a.ObjectRef != nil {
+		namespace, resource, name = a.ObjectRef.Namespace, a.ObjectRef.Resource, a.ObjectRef.Name
+	}
+
+	labels := map[string]string{
+		"namespace": namespace,
+		"resource":  resource,
+		"name":      name,
+		"user":      a.User.Username,
+		"group":     utils.OutputAsJson(a.User.Groups),
+		"verb":      a.Verb,
+		"alerttype": "auditing",
+		"alertname": a.GetAlertRuleName(),
+		"severity":  a.GetAlertSeverity(),
+	}
+
+	// The time differs for every event, it is an annotation so that the alerts can be grouped and deduplicated.
+	annotations := make(map[string]string)
+	for k, v := range a.Annotations {
+		annotations[k] = v
+	}
+	annotations["requestReceivedTimestamp"] = a.RequestReceivedTimestamp.String()
+
+	return newAlert(labels, annotations, a.Message, a.RequestReceivedTimestamp.Time)
+}
+
+func eventAlert(e *rule.Event) template.Alert {
+
+	labels := map[string]string{
+		"namespace": e.Event.Namespace,
+		"reason":    e.Event.Reason,
+		"name":      e.Event.Name,
+		"user":      e.Event.Source.Host,
+		"group":     utils.OutputAsJson(e.Event.Series),
+		"alerttype": "events",
+		"alertname": e.GetAlertRuleName(),
+		"severity":  e.GetAlertSeverity(),
+	}
+
+	startsAt := e.Event.LastTimestamp.Time
+	if startsAt.IsZero() {
+		startsAt = e.Event.EventTime.Time
+	}
+
+	return newAlert(labels, e.Annotations, e.Message, startsAt)
+}
+
+func loggingAlert(l *rule.Logging) template.Alert {
+
+	labels := map[string]string{
+		"namespace": l.Namespace(),
+		"pod":       l.Pod(),
+		"container": l.Container(),
+		"node":      l.Node(),
+		"alerttype": "logging",
+		"alertname": l.GetAlertRuleName(),
+		"severity":  l.GetAlertSeverity(),
+	}
+
+	return newAlert(labels, l.Annotations, l.Message, time.Time{})
+}
+
+func newAlert(labels, annotations map[string]string, message string, startsAt time.Time) template.Alert {
+
+	msg := make(map[string]string)
+	for k, v := range annotations {
+		msg[k] = v
+	}
+
+	msgKey := "message"
+	if existingValue, exists := msg[msgKey]; exists {
+		glog.Warningf("Key '%s' already exists with value: %s,Please change the annotation field to another field", msgKey, existingValue)
+	} else {
+		msg[msgKey] = message
+	}
+
+	if startsAt.IsZero() {
+		startsAt = time.Now()
+	}
+
+	ls := make(model.LabelSet)
+	for k, v := range labels {
+		ls[model.LabelName(k)] = model.LabelValue(v)
+	}
+
+	return template.Alert{
+		Status:      AlertStatusFiring,
+		Labels:      labels,
+		Annotations: msg,
+		StartsAt:    startsAt,
+		Fingerprint: ls.Fingerprint().String(),
+	}
+}
+
+// newWebhookMessage create the Alertmanager webhook payload of the alert.
+func newWebhookMessage(receiver string, alert template.Alert) *WebhookMessage {
+
+	groupLabels := template.KV{"alertname": alert.Labels["alertname"]}
+
+	return &WebhookMessage{
+		Data: &template.Data{
+			Receiver:          receiver,
+			Status:            AlertStatusFiring,
+			Alerts:            template.Alerts{alert},
+			GroupLabels:       groupLabels,
+			CommonLabels:      alert.Labels,
+			CommonAnnotations: alert.Annotations,
+		},
+		Version:  WebhookPayloadVersion,
+		GroupKey: fmt.Sprintf("{}:{alertname=%q}", groupLabels["alertname"]),
+	}
+}
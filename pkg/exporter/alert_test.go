@@ -0,0 +1,92 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+// TestNonResourceAuditingAlert evaluate and export the alert of a request without ObjectRef, such as /healthz.
+func TestNonResourceAuditingAlert(t *testing.T) {
+
+	audits, err := rule.NewAuditing([]byte(`[{
+		"kind": "Event",
+		"level": "Metadata",
+		"auditID": "6c7b1a2e-5b0f-4a8e-9a59-2b2f6b1b8c11",
+		"stage": "ResponseComplete",
+		"requestURI": "/healthz",
+		"verb": "get",
+		"user": {"username": "system:anonymous", "groups": ["system:unauthenticated"]},
+		"requestReceivedTimestamp": "2023-01-01T00:00:00.000000Z"
+	}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := v1alpha1.ClusterRuleGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: v1alpha1.ClusterRuleGroupRuleSpec{
+			Type: rule.AuditingType,
+			Rules: []v1alpha1.Rule{{
+				Name:   "anonymous",
+				Enable: pointer.Bool(true),
+				Expr:   v1alpha1.Expr{Kind: rule.KindRule, Condition: `User.username = "system:anonymous"`},
+				Alerts: v1alpha1.Alerts{Severity: "WARNING"},
+			}},
+		},
+	}
+	rules := rule.BuildRules([]v1alpha1.ClusterRuleGroup{group}, nil)
+
+	e := &rule.WhizardEvent{Kind: constant.Auditing, Auditing: audits[0]}
+	alerts := rule.EvaluateEvent(rule.RulesByType(rules), rule.Sequences(rules), e, time.Now(), nil)
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+
+	if got, want := alerts[0].Message(), "system:anonymous get /healthz"; got != want {
+		t.Errorf("message: got %q, want %q", got, want)
+	}
+
+	labels, _ := routingLabels(alerts[0])
+	for _, name := range []string{"namespace", "resource", "name"} {
+		if v, ok := labels[name]; !ok || len(v) > 0 {
+			t.Errorf("label %s: got %q, want empty", name, v)
+		}
+	}
+	if got, want := labels["alertname"], "anonymous"; got != want {
+		t.Errorf("label alertname: got %q, want %q", got, want)
+	}
+
+	alert := auditingAlert(alerts[0].Auditing)
+	if got, want := alert.Labels["user"], "system:anonymous"; got != want {
+		t.Errorf("label user: got %q, want %q", got, want)
+	}
+	// The time of request is not a label, or the alerts of the rule could not be grouped.
+	if _, ok := alert.Labels["requestReceivedTimestamp"]; ok {
+		t.Error("requestReceivedTimestamp should not be a label")
+	}
+	if len(alert.Annotations["requestReceivedTimestamp"]) == 0 {
+		t.Error("requestReceivedTimestamp should be an annotation")
+	}
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/rule"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/alertmanager/template"
+)
+
+const (
+	AlertmanagerAlertsPath = "/api/v2/alerts"
+	// The default duration after which the alert is resolved by Alertmanager.
+	DefaultResolveTimeout = 5 * time.Minute
+)
+
+// AlertmanagerExporter export alerts to Alertmanager with the api v2.
+type AlertmanagerExporter struct {
+	// Exporter name, if the receiver name is set, use receiver name,
+	// else use the url of the first Alertmanager
+	name string
+	// The Alertmanager endpoints, alert will send to all of them.
+	endpoints []*alertmanagerEndpoint
+	// The url of alert generator.
+	GeneratorURL string
+	// The alert will be resolved after the ResolveTimeout.
+	ResolveTimeout time.Duration
+	// The receiver which this exporter created from.
+	receiver *Receiver
+}
+
+type alertmanagerEndpoint struct {
+	URL    string
+	Client http.Client
+	config *WebhookClientConfig
+}
+
+// postableAlert is the alert accepted by the api v2 of Alertmanager.
+type postableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt,omitempty"`
+	EndsAt       time.Time         `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func init() {
+	// Register before used.
+	RegisterPlugin(constant.AlertManagerReciver, NewAlertmanagerExporter)
+}
+
+// NewAlertmanagerExporter create an Alertmanager exporter.
+func NewAlertmanagerExporter(receiver *Receiver) (Exporters, error) {
+
+	am := &AlertmanagerExporter{}
+
+	err := am.GetHttpConfig(receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	return am, nil
+}
+
+func (am *AlertmanagerExporter) Connect() error {
+	return nil
+}
+
+func (am *AlertmanagerExporter) ExportAuditingAlerts(a *rule.Auditing) error {
+	return am.export(auditingAlert(a))
+}
+
+func (am *AlertmanagerExporter) ExportEventAlerts(e *rule.Event) error {
+	return am.export(eventAlert(e))
+}
+
+func (am *AlertmanagerExporter) ExportLoggingAlerts(l *rule.Logging) error {
+	return am.export(loggingAlert(l))
+}
+
+// export send the alert to all Alertmanager endpoints, it is successful
+// if any of the endpoints accepted the alert.
+func (am *AlertmanagerExporter) export(alert template.Alert) error {
+
+	pa := postableAlert{
+		Labels:       alert.Labels,
+		Annotations:  alert.Annotations,
+		StartsAt:     alert.StartsAt,
+		EndsAt:       time.Now().Add(am.ResolveTimeout),
+		GeneratorURL: am.GeneratorURL,
+	}
+	if pa.EndsAt.Before(pa.StartsAt) {
+		pa.EndsAt = pa.StartsAt.Add(am.ResolveTimeout)
+	}
+
+	s, err := utils.ToJsonString([]postableAlert{pa})
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(am.endpoints))
+	for i, endpoint := range am.endpoints {
+		wg.Add(1)
+		go func(i int, endpoint *alertmanagerEndpoint) {
+			defer wg.Done()
+			errs[i] = endpoint.post([]byte(s))
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var msgs []string
+	for i, err := range errs {
+		if err == nil {
+			return nil
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %s", am.endpoints[i].URL, err))
+	}
+
+	return fmt.Errorf("%s", strings.Join(msgs, "; "))
+}
+
+func (e *alertmanagerEndpoint) post(body []byte) error {
+
+	request, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	e.config.SetAuth(request)
+	response, err := e.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Discard the body
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return newStatusError(response)
+	}
+
+	return nil
+}
+
+// Reconnect reset the Alertmanager endpoints.
+func (am *AlertmanagerExporter) Reconnect(receiver *Receiver) error {
+
+	err := am.GetHttpConfig(receiver)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (am *AlertmanagerExporter) GetHttpConfig(receiver *Receiver) error {
+
+	if receiver == nil || receiver.ReceiverType != constant.AlertManagerReciver {
+		glog.Error(receiver)
+		return fmt.Errorf("no alertmanager receiver config")
+	}
+
+	var configs []WebhookClientConfig
+	if receiver.ReceiverConfig.URL != nil || receiver.ReceiverConfig.Service != nil {
+		configs = append(configs, receiver.ReceiverConfig)
+	}
+	configs = append(configs, receiver.Endpoints...)
+	if len(configs) == 0 {
+		return fmt.Errorf("no alertmanager receiver config")
+	}
+
+	var endpoints []*alertmanagerEndpoint
+	for _, c := range configs {
+		u, err := c.GetURL()
+		if err != nil {
+			return err
+		}
+
+		u, err = alertmanagerAlertsURL(u)
+		if err != nil {
+			return err
+		}
+
+		endpoints = append(endpoints, &alertmanagerEndpoint{
+			URL:    u,
+			Client: NewHttpClient(u, c.CABundle, receiver.Delivery.GetTimeout()),
+			config: c.DeepCopy(),
+		})
+	}
+	am.endpoints = endpoints
+
+	am.GeneratorURL = receiver.GeneratorURL
+	am.ResolveTimeout = receiver.ResolveTimeout
+	if am.ResolveTimeout <= 0 {
+		am.ResolveTimeout = DefaultResolveTimeout
+	}
+
+	am.receiver = receiver.DeepCopy()
+	am.name = receiver.ReceiverName
+	if len(am.name) == 0 {
+		am.name = am.endpoints[0].URL
+	}
+
+	return nil
+}
+
+// alertmanagerAlertsURL append the path of alerts api to the url if the path is not set.
+func alertmanagerAlertsURL(s string) (string, error) {
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	if len(strings.Trim(u.Path, "/")) == 0 {
+		u.Path = AlertmanagerAlertsPath
+	}
+
+	return u.String(), nil
+}
+
+func (am *AlertmanagerExporter) Name() string {
+	return am.name
+}
+
+// Type is "alertmanager"
+func (am *AlertmanagerExporter) Type() string {
+	return constant.AlertManagerReciver
+}
+
+func (am *AlertmanagerExporter) DeepEqual(receiver *Receiver) bool {
+	return receiverEqual(am.receiver, receiver)
+}
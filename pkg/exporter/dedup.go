@@ -0,0 +1,242 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/metrics"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/golang/glog"
+)
+
+// The annotations of the summary sent when the dedup window closes.
+const (
+	AnnotationDuplicates = "count"
+	AnnotationFirstSeen  = "firstSeen"
+	AnnotationLastSeen   = "lastSeen"
+)
+
+// Dedup forwards the first alert of a fingerprint and suppresses the duplicates within the window,
+// the fingerprint is made of the rule name and the values of the labels.
+type Dedup struct {
+	// The window in which the duplicates are suppressed.
+	Window time.Duration `yaml:"window,omitempty"`
+	// The labels of alert which make up the fingerprint with the rule name.
+	// +optional
+	Labels []string `yaml:"labels,omitempty"`
+}
+
+// DeepCopy return a copy of the dedup.
+func (d *Dedup) DeepCopy() *Dedup {
+	if d == nil {
+		return nil
+	}
+
+	return &Dedup{
+		Window: d.Window,
+		Labels: append([]string(nil), d.Labels...),
+	}
+}
+
+// dedupEntry is a fingerprint whose window is open.
+type dedupEntry struct {
+	// The number of suppressed duplicates.
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+	// The last suppressed duplicate, it is sent as the summary.
+	last  *rule.WhizardEvent
+	timer *time.Timer
+}
+
+// deduplicator holds the open windows of a receiver.
+type deduplicator struct {
+	mutex   sync.Mutex
+	entries map[string]*dedupEntry
+	// Send the summary when a window closes.
+	send func(e *rule.WhizardEvent)
+}
+
+func newDeduplicator(send func(e *rule.WhizardEvent)) *deduplicator {
+	return &deduplicator{
+		entries: make(map[string]*dedupEntry),
+		send:    send,
+	}
+}
+
+// admit return true if the alert should be sent, the dedup of rule overrides the dedup of receiver,
+// and all alerts are admitted when neither of them is set.
+func (d *deduplicator) admit(e *rule.WhizardEvent, labels map[string]string, dedup *Dedup) bool {
+
+	if rd := ruleDedup(e); rd != nil {
+		dedup = rd
+	}
+	if dedup == nil || dedup.Window <= 0 {
+		return true
+	}
+
+	fp := fingerprint(labels, dedup.Labels)
+	now := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if entry, ok := d.entries[fp]; ok {
+		entry.count++
+		entry.lastSeen = now
+		entry.last = e
+		return false
+	}
+
+	d.entries[fp] = &dedupEntry{
+		firstSeen: now,
+		lastSeen:  now,
+		timer:     time.AfterFunc(dedup.Window, func() { d.flush(fp) }),
+	}
+	return true
+}
+
+// flush close the window of the fingerprint, and send the summary if there are duplicates.
+func (d *deduplicator) flush(fp string) {
+
+	d.mutex.Lock()
+	entry, ok := d.entries[fp]
+	delete(d.entries, fp)
+	d.mutex.Unlock()
+
+	if ok && entry.count > 0 {
+		d.send(summarize(entry))
+	}
+}
+
+// close all open windows, the summaries are sent immediately.
+func (d *deduplicator) close() {
+
+	d.mutex.Lock()
+	entries := d.entries
+	d.entries = make(map[string]*dedupEntry)
+	d.mutex.Unlock()
+
+	for _, entry := range entries {
+		entry.timer.Stop()
+		if entry.count > 0 {
+			d.send(summarize(entry))
+		}
+	}
+}
+
+// fingerprint return the rule name and the values of the labels.
+func fingerprint(labels map[string]string, names []string) string {
+
+	var sb strings.Builder
+	sb.WriteString(labels["alertname"])
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("\xff%s=%s", name, labels[name]))
+	}
+
+	return sb.String()
+}
+
+func ruleDedup(e *rule.WhizardEvent) *Dedup {
+
+	var d *v1alpha1.Dedup
+	switch e.Kind {
+	case constant.Auditing:
+		d = e.Auditing.GetAlertDedup()
+	case constant.Event:
+		d = e.Event.GetAlertDedup()
+	case constant.Logging:
+		d = e.Logging.GetAlertDedup()
+	}
+	if d == nil {
+		return nil
+	}
+
+	return &Dedup{Window: d.Window.Duration, Labels: d.Labels}
+}
+
+// summarize return a copy of the last duplicate, annotated with the number of duplicates
+// and the time of the first and last alert.
+func summarize(entry *dedupEntry) *rule.WhizardEvent {
+
+	annotations := map[string]string{
+		AnnotationDuplicates: strconv.Itoa(entry.count),
+		AnnotationFirstSeen:  entry.firstSeen.Format(time.RFC3339),
+		AnnotationLastSeen:   entry.lastSeen.Format(time.RFC3339),
+	}
+
+	e := &rule.WhizardEvent{Kind: entry.last.Kind}
+	switch e.Kind {
+	case constant.Auditing:
+		a := *entry.last.Auditing
+		a.Annotations = mergeAnnotations(a.Annotations, annotations)
+		e.Auditing = &a
+	case constant.Event:
+		ev := *entry.last.Event
+		ev.Annotations = mergeAnnotations(ev.Annotations, annotations)
+		e.Event = &ev
+	case constant.Logging:
+		l := *entry.last.Logging
+		l.Annotations = mergeAnnotations(l.Annotations, annotations)
+		e.Logging = &l
+	}
+
+	return e
+}
+
+func mergeAnnotations(m1, m2 map[string]string) map[string]string {
+
+	m := make(map[string]string)
+	for k, v := range m1 {
+		m[k] = v
+	}
+	for k, v := range m2 {
+		m[k] = v
+	}
+
+	return m
+}
+
+// sendSummary add the summary to the queue, it is spooled if the queue is full.
+func (q *queue) sendSummary(e *rule.WhizardEvent) {
+
+	name := q.routing.Load().(*routing).name
+	glog.V(4).Infof("output summary of %s to(%s)", describe(e), name)
+	if !q.enqueue(e) {
+		glog.Errorf("output %s to(%s) error, queue is full", describe(e), name)
+		spoolAlert(name, e, fmt.Errorf("queue is full"))
+	}
+}
+
+// deduplicate return true if the alert is a duplicate and should not be sent to this receiver.
+func (q *queue) deduplicate(e *rule.WhizardEvent, labels map[string]string) bool {
+
+	r := q.routing.Load().(*routing)
+	if q.dedup.admit(e, labels, r.dedup) {
+		return false
+	}
+
+	metrics.AlertsDeduplicated.WithLabelValues(r.name).Inc()
+	return true
+}
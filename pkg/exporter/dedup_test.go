@@ -0,0 +1,217 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDedupAdmit(t *testing.T) {
+
+	type alert struct {
+		labels map[string]string
+		// The dedup of rule.
+		dedup *v1alpha1.Dedup
+	}
+	pod := func(namespace, pod string) map[string]string {
+		return map[string]string{"alertname": "delete", "namespace": namespace, "pod": pod}
+	}
+
+	tests := []struct {
+		name   string
+		dedup  *Dedup
+		alerts []alert
+		want   []bool
+	}{
+		{
+			name:   "no dedup",
+			alerts: []alert{{labels: pod("a", "1")}, {labels: pod("a", "1")}},
+			want:   []bool{true, true},
+		},
+		{
+			name:   "by rule name",
+			dedup:  &Dedup{Window: time.Hour},
+			alerts: []alert{{labels: pod("a", "1")}, {labels: pod("b", "2")}, {labels: map[string]string{"alertname": "create"}}},
+			want:   []bool{true, false, true},
+		},
+		{
+			name:   "by labels",
+			dedup:  &Dedup{Window: time.Hour, Labels: []string{"namespace"}},
+			alerts: []alert{{labels: pod("a", "1")}, {labels: pod("a", "2")}, {labels: pod("b", "1")}},
+			want:   []bool{true, false, true},
+		},
+		{
+			name:  "rule dedup without receiver dedup",
+			dedup: nil,
+			alerts: []alert{
+				{labels: pod("a", "1"), dedup: &v1alpha1.Dedup{Window: metav1.Duration{Duration: time.Hour}}},
+				{labels: pod("a", "1"), dedup: &v1alpha1.Dedup{Window: metav1.Duration{Duration: time.Hour}}},
+			},
+			want: []bool{true, false},
+		},
+		{
+			// The pods of the same namespace are duplicates by the receiver, but not by the rule.
+			name:  "rule dedup overrides receiver dedup",
+			dedup: &Dedup{Window: time.Hour, Labels: []string{"namespace"}},
+			alerts: []alert{
+				{labels: pod("a", "1"), dedup: &v1alpha1.Dedup{Window: metav1.Duration{Duration: time.Hour}, Labels: []string{"pod"}}},
+				{labels: pod("a", "2"), dedup: &v1alpha1.Dedup{Window: metav1.Duration{Duration: time.Hour}, Labels: []string{"pod"}}},
+				{labels: pod("b", "2"), dedup: &v1alpha1.Dedup{Window: metav1.Duration{Duration: time.Hour}, Labels: []string{"pod"}}},
+			},
+			want: []bool{true, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDeduplicator(func(e *rule.WhizardEvent) {})
+			defer d.close()
+
+			for i, a := range tt.alerts {
+				e := newAuditingAlert(t, "1")
+				e.Auditing.SetAlertDedup(a.dedup)
+				if got := d.admit(e, a.labels, tt.dedup); got != tt.want[i] {
+					t.Errorf("alert %d: got %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDedupFlush(t *testing.T) {
+
+	sent := make(chan *rule.WhizardEvent, 10)
+	d := newDeduplicator(func(e *rule.WhizardEvent) { sent <- e })
+	defer d.close()
+
+	dedup := &Dedup{Window: 100 * time.Millisecond}
+	labels := map[string]string{"alertname": "delete"}
+	start := time.Now().Truncate(time.Second)
+
+	// The window without duplicates closes without summary.
+	if !d.admit(newAuditingAlert(t, "0"), labels, dedup) {
+		t.Fatal("the first alert should be admitted")
+	}
+	select {
+	case e := <-sent:
+		t.Fatalf("got summary %s, want none", describe(e))
+	case <-time.After(3 * dedup.Window):
+	}
+
+	if !d.admit(newAuditingAlert(t, "1"), labels, dedup) {
+		t.Fatal("the first alert of the new window should be admitted")
+	}
+	last := newAuditingAlert(t, "3")
+	last.Auditing.Annotations = map[string]string{"owner": "ops"}
+	for _, e := range []*rule.WhizardEvent{newAuditingAlert(t, "2"), last} {
+		if d.admit(e, labels, dedup) {
+			t.Fatalf("the duplicate %s should not be admitted", describe(e))
+		}
+	}
+
+	var summary *rule.WhizardEvent
+	select {
+	case summary = <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the summary is not sent when the window closes")
+	}
+	end := time.Now()
+
+	if summary.Auditing.AuditID != "3" {
+		t.Errorf("summary of %s, want the last duplicate", describe(summary))
+	}
+	annotations := summary.Auditing.Annotations
+	if annotations[AnnotationDuplicates] != "2" || annotations["owner"] != "ops" {
+		t.Errorf("got annotations %v, want count 2 and the annotations of the alert", annotations)
+	}
+	firstSeen, err1 := time.Parse(time.RFC3339, annotations[AnnotationFirstSeen])
+	lastSeen, err2 := time.Parse(time.RFC3339, annotations[AnnotationLastSeen])
+	if err1 != nil || err2 != nil {
+		t.Fatalf("invalid times %v", annotations)
+	}
+	if firstSeen.Before(start) || lastSeen.Before(firstSeen) || lastSeen.After(end) {
+		t.Errorf("firstSeen %s and lastSeen %s are not in [%s, %s]", firstSeen, lastSeen, start, end)
+	}
+	if !reflect.DeepEqual(last.Auditing.Annotations, map[string]string{"owner": "ops"}) {
+		t.Errorf("the annotations of the alert are changed to %v", last.Auditing.Annotations)
+	}
+
+	// The next alert opens a new window.
+	if !d.admit(newAuditingAlert(t, "4"), labels, dedup) {
+		t.Error("the alert after the window should be admitted")
+	}
+}
+
+func TestDedupClose(t *testing.T) {
+
+	var sent []*rule.WhizardEvent
+	d := newDeduplicator(func(e *rule.WhizardEvent) { sent = append(sent, e) })
+
+	dedup := &Dedup{Window: time.Hour, Labels: []string{"namespace"}}
+	for _, ns := range []string{"a", "a", "a", "b"} {
+		d.admit(newAuditingAlert(t, ns), map[string]string{"alertname": "delete", "namespace": ns}, dedup)
+	}
+	d.close()
+
+	if len(sent) != 1 || sent[0].Auditing.Annotations[AnnotationDuplicates] != "2" {
+		t.Fatalf("got %d summaries, want the summary of namespace a with 2 duplicates", len(sent))
+	}
+}
+
+func TestSummarize(t *testing.T) {
+
+	first := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := first.Add(time.Minute)
+	want := map[string]string{
+		"owner":              "ops",
+		AnnotationDuplicates: "5",
+		AnnotationFirstSeen:  "2023-01-01T00:00:00Z",
+		AnnotationLastSeen:   "2023-01-01T00:01:00Z",
+	}
+
+	for _, e := range []*rule.WhizardEvent{
+		{Kind: constant.Auditing, Auditing: &rule.Auditing{Annotations: map[string]string{"owner": "ops"}}},
+		{Kind: constant.Event, Event: &rule.Event{Event: &corev1.Event{}, Annotations: map[string]string{"owner": "ops"}}},
+		{Kind: constant.Logging, Logging: &rule.Logging{Annotations: map[string]string{"owner": "ops"}}},
+	} {
+		s := summarize(&dedupEntry{count: 5, firstSeen: first, lastSeen: last, last: e})
+
+		var got map[string]string
+		switch s.Kind {
+		case constant.Auditing:
+			got = s.Auditing.Annotations
+		case constant.Event:
+			got = s.Event.Annotations
+		case constant.Logging:
+			got = s.Logging.Annotations
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got annotations %v, want %v", s.Kind, got, want)
+		}
+		if s.Auditing == e.Auditing && s.Event == e.Event && s.Logging == e.Logging {
+			t.Errorf("%s: the summary should be a copy", s.Kind)
+		}
+	}
+}
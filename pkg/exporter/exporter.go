@@ -19,6 +19,7 @@ package exporter
 import (
 	"fmt"
 	"github.com/golang/glog"
+	"whizard-telemetry-ruler/pkg/constant"
 	"whizard-telemetry-ruler/pkg/rule"
 
 	"sync"
@@ -42,11 +43,19 @@ type Exporters interface {
 	ExportAuditingAlerts(auditing *rule.Auditing) error
 	// Export events alert
 	ExportEventAlerts(events *rule.Event) error
+	// Export logging alert
+	ExportLoggingAlerts(logging *rule.Logging) error
 }
 
+// Lock the queues, it is not held when connecting the receivers.
 var mutex sync.Mutex
 var plugins map[string]Factory
-var exporters map[string]Exporters
+
+// Serialize the connecting of receivers.
+var connectMutex sync.Mutex
+
+// The delivery queues of receivers, the key is the name of exporter.
+var queues map[string]*queue
 
 // RegisterPlugin used to register a new type of export must.
 // Name is the type of receiver, factory must be return an
@@ -61,61 +70,135 @@ func RegisterPlugin(name string, factory Factory) {
 
 // Export will send alert to all receivers.
 func ExportAuditingAlerts(a *rule.Auditing) {
-
-	for _, exporter := range exporters {
-		err := exporter.ExportAuditingAlerts(a)
-		if err != nil {
-			glog.Errorf("output e(%s) to(%s) error, %s", a.AuditID, exporter.Name(), err)
-		}
-	}
-
-	return
+	export(&rule.WhizardEvent{
+		Kind:     constant.Auditing,
+		Auditing: a,
+	})
 }
 
 // Export will send alert to all receivers.
 func ExportEventAlerts(e *rule.Event) {
+	export(&rule.WhizardEvent{
+		Kind:  constant.Event,
+		Event: e,
+	})
+}
 
-	for _, exporter := range exporters {
-		err := exporter.ExportEventAlerts(e)
-		if err != nil {
-			glog.Errorf("output e(%s) to(%s) error, %s", e.Event.UID, exporter.Name(), err)
+// Export will send alert to all receivers.
+func ExportLoggingAlerts(l *rule.Logging) {
+	export(&rule.WhizardEvent{
+		Kind:    constant.Logging,
+		Logging: l,
+	})
+}
+
+// ExportAlert will send the alert to the receivers which it is routed to.
+func ExportAlert(e *rule.WhizardEvent) {
+	export(e)
+}
+
+// export add the alert to the delivery queue of every receiver which the alert
+// is routed to, it never blocks. The alert is enqueued with the lock of queues,
+// so it is not added to a queue which is stopped by Connect.
+func export(e *rule.WhizardEvent) {
+
+	labels, targets := routingLabels(e)
+	route := newRoute(e, labels, targets)
+	if name := silenced(e, labels); len(name) > 0 {
+		route.Silenced = name
+		glog.V(4).Info(route)
+		routes.add(route)
+		return
+	}
+
+	// The receivers whose queue is full.
+	var full []string
+	mutex.Lock()
+	for name, q := range queues {
+		if reason := q.route(labels, targets); len(reason) > 0 {
+			route.skip(name, reason)
+			continue
+		}
+
+		if q.deduplicate(e, labels) {
+			route.skip(name, "duplicate alert")
+			continue
+		}
+
+		route.Receivers = append(route.Receivers, name)
+		if !q.enqueue(e) {
+			full = append(full, name)
+		}
+	}
+
+	for _, target := range targets {
+		if _, ok := queues[target]; !ok {
+			route.skip(target, "receiver not found")
 		}
 	}
+	mutex.Unlock()
+
+	for _, name := range full {
+		glog.Errorf("output %s to(%s) error, queue is full", describe(e), name)
+		spoolAlert(name, e, fmt.Errorf("queue is full"))
+	}
 
-	return
+	if len(route.Receivers) == 0 {
+		glog.Warning(route)
+	} else {
+		glog.V(4).Info(route)
+	}
+	routes.add(route)
 }
 
 // Connect will structure exporters from receivers.
-// It will refactor all exporters from new receivers when
-// call this function when receivers changed.
+// The exporter of an unchanged receiver is kept, the exporter of a changed
+// receiver is reconnected, and the exporter of a removed receiver is stopped.
+// All receivers are validated first, the current exporters are kept if any
+// of the receivers is invalid. The alerts are exported to the current queues
+// while connecting, the lock of queues is held only when they are replaced.
 func Connect(receivers []Receiver) []error {
 
+	connectMutex.Lock()
+	defer connectMutex.Unlock()
+
+	if errs := Validate(receivers); len(errs) > 0 {
+		return errs
+	}
+
 	mutex.Lock()
-	defer mutex.Unlock()
+	current := queues
+	mutex.Unlock()
 
 	var errs []error
-	m := make(map[string]Exporters)
-	for _, receiver := range receivers {
-
-		// Reconnect if the exporter of this receiver exist.
-		exporter := getExporter(receiver)
-		if exporter != nil {
-			if err := exporter.Reconnect(&receiver); err != nil {
-				errs = append(errs, fmt.Errorf("receiver %s reconnect error, %s", exporter.Name(), err))
+	m := make(map[string]*queue)
+	used := make(map[*queue]bool)
+	for i := range receivers {
+		receiver := receivers[i]
+
+		name, q := getQueue(current, receiver)
+		if q != nil && !used[q] {
+			// Nothing changed, keep the exporter.
+			if q.unchanged(&receiver) {
+				used[q] = true
+				m[name] = q
 				continue
 			}
-			m[exporter.Name()] = exporter
-		}
 
-		// Get the factory of this receiver
-		factory, ok := plugins[receiver.ReceiverType]
-		if !ok {
-			errs = append(errs, fmt.Errorf("unregister plugin %s", receiver.ReceiverType))
-			continue
+			// Reconnect if the exporter of this receiver exist, the queue can not be resized.
+			if q.delivery().GetQueueSize() == receiver.Delivery.GetQueueSize() {
+				if err := q.reconnect(&receiver); err == nil {
+					used[q] = true
+					m[q.name()] = q
+					continue
+				} else {
+					errs = append(errs, fmt.Errorf("receiver %s reconnect error, %s", name, err))
+				}
+			}
 		}
 
 		// Structure exporter
-		exporter, err := factory(&receiver)
+		exporter, err := plugins[receiver.ReceiverType](&receiver)
 		if err != nil {
 			errs = append(errs, err)
 			continue
@@ -129,31 +212,145 @@ func Connect(receivers []Receiver) []error {
 		}
 
 		// Add the exporter to maps, key is the name of exporter
-		m[exporter.Name()] = exporter
+		m[exporter.Name()] = newQueue(exporter, &receiver)
+	}
+
+	mutex.Lock()
+	queues = m
+	mutex.Unlock()
+
+	// Stop the queues of the receivers which are removed or recreated,
+	// no alert is added to them after they are replaced.
+	for _, q := range current {
+		if !used[q] {
+			go q.stop()
+		}
 	}
 
-	exporters = m
 	return errs
 }
 
-// Get exporter by receiver
-func getExporter(receiver Receiver) Exporters {
+// NewExporter structure the exporter of the receiver and connect it, the alerts exported by it
+// are sent directly, without the delivery queue, routing, dedup and silences.
+func NewExporter(receiver *Receiver) (Exporters, error) {
+
+	mutex.Lock()
+	factory, ok := plugins[receiver.ReceiverType]
+	mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unregister plugin %s", receiver.ReceiverType)
+	}
+
+	exporter, err := factory(receiver)
+	if err != nil {
+		return nil, err
+	}
+	if err := exporter.Connect(); err != nil {
+		return nil, fmt.Errorf("connect to receiver %s error, %s", receiver.ReceiverName, err)
+	}
+
+	return exporter, nil
+}
+
+// Validate check whether the exporters can be created from the receivers.
+func Validate(receivers []Receiver) []error {
+
+	var errs []error
+	names := make(map[string]bool)
+	for i := range receivers {
+		receiver := receivers[i]
+
+		if len(receiver.ReceiverName) > 0 {
+			if names[receiver.ReceiverName] {
+				errs = append(errs, fmt.Errorf("duplicate receiver %s", receiver.ReceiverName))
+				continue
+			}
+			names[receiver.ReceiverName] = true
+		}
+
+		// Get the factory of this receiver
+		factory, ok := plugins[receiver.ReceiverType]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unregister plugin %s", receiver.ReceiverType))
+			continue
+		}
+
+		if _, err := factory(&receiver); err != nil {
+			errs = append(errs, fmt.Errorf("receiver %s is invalid, %s", receiver.ReceiverName, err))
+			continue
+		}
+
+		if _, err := newMatcher(receiver.Match); err != nil {
+			errs = append(errs, fmt.Errorf("receiver %s is invalid, %s", receiver.ReceiverName, err))
+			continue
+		}
+
+		if receiver.Dedup != nil && receiver.Dedup.Window <= 0 {
+			errs = append(errs, fmt.Errorf("receiver %s is invalid, the window of dedup must be greater than 0", receiver.ReceiverName))
+		}
+	}
+
+	return errs
+}
+
+// Close stop all delivery queues after the alerts in queues are sent.
+func Close() {
+
+	mutex.Lock()
+	qs := queues
+	queues = nil
+	mutex.Unlock()
+
+	for _, q := range qs {
+		q.stop()
+	}
+}
+
+// GetReceiverStatus return the delivery status of the receiver with the given name,
+// false is returned if the receiver is not connected.
+func GetReceiverStatus(name string) (ReceiverStatus, bool) {
+
+	q := getQueueByName(name)
+	if q == nil {
+		return ReceiverStatus{}, false
+	}
+
+	return q.getStatus(), true
+}
+
+// Get the delivery queue and exporter name by receiver
+func getQueue(qs map[string]*queue, receiver Receiver) (string, *queue) {
 
 	// Get exporter from maps with receiver name
-	exporter, ok := exporters[receiver.ReceiverName]
+	q, ok := qs[receiver.ReceiverName]
 	if ok {
-		return exporter
+		return receiver.ReceiverName, q
 	}
 
 	// If the exporter name is not same as receiver name, or receiver name
 	// changed, we will traversal the map to find the exporter.
-	for _, exp := range exporters {
-		if exp.Type() != receiver.ReceiverType {
-			continue
+	for name, q := range qs {
+		if q.sameExporter(&receiver) {
+			return name, q
 		}
+	}
+
+	return "", nil
+}
+
+// Get the delivery queue by the name of exporter
+func getQueueByName(name string) *queue {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if q, ok := queues[name]; ok {
+		return q
+	}
 
-		if exp.DeepEqual(&receiver) {
-			return exp
+	for _, q := range queues {
+		if q.name() == name {
+			return q
 		}
 	}
 
@@ -37,6 +37,8 @@ type NotificationManagerExporter struct {
 	name   string
 	URL    string
 	client *http.Client
+	// The receiver which this exporter created from.
+	receiver *Receiver
 }
 
 func init() {
@@ -62,84 +64,21 @@ func (nm *NotificationManagerExporter) Connect() error {
 }
 
 func (nm *NotificationManagerExporter) ExportAuditingAlerts(a *rule.Auditing) error {
+	return nm.export(auditingAlert(a))
+}
 
-	msg := a.Annotations
-	msgKey := "message"
-	msgValue := a.Message
-	if existingValue, exists := msg[msgKey]; exists {
-		fmt.Printf("Key '%s' already exists with value: %s,Please change the annotation field to another field \n", msg, existingValue)
-	} else {
-		msg[msgKey] = msgValue
-	}
-	data := template.Data{
-		Alerts: template.Alerts{
-			{
-				Labels: map[string]string{
-					"namespace":                a.ObjectRef.Namespace,
-					"resource":                 a.ObjectRef.Resource,
-					"name":                     a.ObjectRef.Name,
-					"user":                     a.User.Username,
-					"group":                    utils.OutputAsJson(a.User.Groups),
-					"verb":                     a.Verb,
-					"alerttype":                "auditing",
-					"alertname":                a.GetAlertRuleName(),
-					"requestReceivedTimestamp": a.RequestReceivedTimestamp.String(),
-				},
-				Annotations: msg,
-			},
-		},
-	}
-
-	s, err := utils.ToJsonString(data)
-	if err != nil {
-		return err
-	}
-
-	request, err := http.NewRequest(http.MethodPost, nm.URL, bytes.NewBuffer([]byte(s)))
-	if err != nil {
-		return err
-	}
-	request.Header.Set("Content-Type", "application/json")
-	response, err := nm.client.Do(request)
-	if err != nil {
-		return err
-	}
-
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("%s", response.Status)
-	}
-
-	// Discard the body
-	_, _ = io.Copy(ioutil.Discard, response.Body)
+func (nm *NotificationManagerExporter) ExportEventAlerts(e *rule.Event) error {
+	return nm.export(eventAlert(e))
+}
 
-	return nil
+func (nm *NotificationManagerExporter) ExportLoggingAlerts(l *rule.Logging) error {
+	return nm.export(loggingAlert(l))
 }
 
-func (nm *NotificationManagerExporter) ExportEventAlerts(e *rule.Event) error {
+func (nm *NotificationManagerExporter) export(alert template.Alert) error {
 
-	msg := e.Annotations
-	msgKey := "message"
-	msgValue := e.Message
-	if existingValue, exists := msg[msgKey]; exists {
-		fmt.Printf("Key '%s' already exists with value: %s,Please change the annotation field to another field \n", msg, existingValue)
-	} else {
-		msg[msgKey] = msgValue
-	}
 	data := template.Data{
-		Alerts: template.Alerts{
-			{
-				Labels: map[string]string{
-					"namespace": e.Event.Namespace,
-					"reason":    e.Event.Reason,
-					"name":      e.Event.Name,
-					"user":      e.Event.Source.Host,
-					"group":     utils.OutputAsJson(e.Event.Series),
-					"alerttype": "events",
-					"alertname": e.GetAlertRuleName(),
-				},
-				Annotations: msg,
-			},
-		},
+		Alerts: template.Alerts{alert},
 	}
 
 	s, err := utils.ToJsonString(data)
@@ -152,18 +91,20 @@ func (nm *NotificationManagerExporter) ExportEventAlerts(e *rule.Event) error {
 		return err
 	}
 	request.Header.Set("Content-Type", "application/json")
+	nm.receiver.ReceiverConfig.SetAuth(request)
 	response, err := nm.client.Do(request)
 	if err != nil {
 		return err
 	}
-
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("%s", response.Status)
-	}
+	defer response.Body.Close()
 
 	// Discard the body
 	_, _ = io.Copy(ioutil.Discard, response.Body)
 
+	if response.StatusCode != http.StatusOK {
+		return newStatusError(response)
+	}
+
 	return nil
 }
 
@@ -185,35 +126,21 @@ func (nm *NotificationManagerExporter) GetHttpConfig(receiver *Receiver) error {
 		return fmt.Errorf("no notification manager receiver config")
 	}
 
-	url := ""
-	if receiver.ReceiverConfig.URL != nil {
-		url = *receiver.ReceiverConfig.URL
-	} else if receiver.ReceiverConfig.Service != nil {
-		service := receiver.ReceiverConfig.Service
-		if len(receiver.ReceiverConfig.CABundle) > 0 {
-			url = fmt.Sprintf("https://%s.%s", service.Name, service.Namespace)
-		} else {
-			url = fmt.Sprintf("http://%s.%s", service.Name, service.Namespace)
-		}
-
-		if service.Port != nil {
-			url = fmt.Sprintf("%s:%d", url, *service.Port)
-		}
-
-		if service.Path != nil {
-			url = fmt.Sprintf("%s%s", url, *service.Path)
-		}
-	} else {
+	url, err := receiver.ReceiverConfig.GetURL()
+	if err != nil {
 		return fmt.Errorf("no notification manager receiver config")
 	}
 	nm.URL = url
 
+	nm.receiver = receiver.DeepCopy()
 	nm.name = receiver.ReceiverName
 	if len(nm.name) == 0 {
 		nm.name = nm.URL
 	}
 
-	nm.client = &http.Client{}
+	nm.client = &http.Client{
+		Timeout: receiver.Delivery.GetTimeout(),
+	}
 
 	return nil
 }
@@ -227,7 +154,6 @@ func (nm *NotificationManagerExporter) Type() string {
 	return constant.NotificationManagerReciver
 }
 
-func (nm *NotificationManagerExporter) DeepEqual(_ *Receiver) bool {
-
-	return false
+func (nm *NotificationManagerExporter) DeepEqual(receiver *Receiver) bool {
+	return receiverEqual(nm.receiver, receiver)
 }
@@ -0,0 +1,416 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/metrics"
+	"whizard-telemetry-ruler/pkg/rule"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	"github.com/golang/glog"
+)
+
+const (
+	DefaultTimeout    = 5 * time.Second
+	DefaultQueueSize  = 1000
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// DeliveryConfig controls how the alerts are delivered to a receiver.
+type DeliveryConfig struct {
+	// Timeout of every request sent to the receiver, default to 5s.
+	// +optional
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// The max number of alerts waiting to be sent to the receiver, default to 1000.
+	// The new alert will be dropped when the queue is full.
+	// +optional
+	QueueSize int `yaml:"queueSize,omitempty"`
+	// The max retry times of a failed alert, default to 3, negative number means no retry.
+	// +optional
+	MaxRetries int `yaml:"maxRetries,omitempty"`
+	// The backoff of the first retry, default to 500ms.
+	// +optional
+	MinBackoff time.Duration `yaml:"minBackoff,omitempty"`
+	// The max backoff between two retries, default to 30s.
+	// +optional
+	MaxBackoff time.Duration `yaml:"maxBackoff,omitempty"`
+}
+
+func (c DeliveryConfig) GetTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+func (c DeliveryConfig) GetQueueSize() int {
+	if c.QueueSize <= 0 {
+		return DefaultQueueSize
+	}
+	return c.QueueSize
+}
+
+func (c DeliveryConfig) GetMaxRetries() int {
+	if c.MaxRetries < 0 {
+		return 0
+	}
+	if c.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+	return c.MaxRetries
+}
+
+// backoff return the exponential backoff with jitter of the given retry.
+func (c DeliveryConfig) backoff(retry int) time.Duration {
+
+	min := c.MinBackoff
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	max := c.MaxBackoff
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	if max < min {
+		max = min
+	}
+
+	d := min
+	for i := 0; i < retry && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	// Half of the backoff is fixed, the other half is random.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// StatusError is returned by exporters when the receiver response with an unexpected status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func newStatusError(response *http.Response) error {
+	return &StatusError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+	}
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+// retryable return false if the request is rejected by the receiver, retry will not help.
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= http.StatusInternalServerError || se.StatusCode == http.StatusTooManyRequests
+	}
+
+	return true
+}
+
+// ReceiverStatus is the delivery status of a receiver.
+type ReceiverStatus struct {
+	// The error of the last failed delivery.
+	LastError string
+	// The time of the last failed delivery.
+	LastErrorTime time.Time
+	// The time of the last successful delivery.
+	LastDeliveryTime time.Time
+}
+
+// Failing return true if the last delivery failed.
+func (s ReceiverStatus) Failing() bool {
+	return s.LastErrorTime.After(s.LastDeliveryTime)
+}
+
+// queue holds the alerts waiting to be sent to a receiver, and a worker to send them.
+type queue struct {
+	// Lock the exporter, receiver and config when reading or reconnecting, it is not held when sending alert.
+	sync.Mutex
+	// Serialize the sending and reconnecting, the exporter is reset in place by reconnecting.
+	sendMutex sync.Mutex
+	exporter  Exporters
+	receiver  Receiver
+	config    DeliveryConfig
+	ch        chan *rule.WhizardEvent
+	stopCh    chan struct{}
+	done      chan struct{}
+
+	statusMutex sync.Mutex
+	status      ReceiverStatus
+
+	// The name and matcher of receiver used to route alerts,
+	// it is not guarded by the lock of exporter to avoid blocking the routing.
+	routing atomic.Value
+
+	// The open dedup windows, they are kept when reconnecting.
+	dedup *deduplicator
+}
+
+type routing struct {
+	name    string
+	matcher *matcher
+	dedup   *Dedup
+}
+
+func newQueue(exporter Exporters, receiver *Receiver) *queue {
+	q := &queue{
+		exporter: exporter,
+		receiver: *receiver.DeepCopy(),
+		config:   receiver.Delivery,
+		ch:       make(chan *rule.WhizardEvent, receiver.Delivery.GetQueueSize()),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	q.dedup = newDeduplicator(q.sendSummary)
+	q.setRouting(receiver)
+
+	go q.run()
+	return q
+}
+
+// enqueue add the alert to the queue, return false if the queue is full.
+func (q *queue) enqueue(e *rule.WhizardEvent) bool {
+	select {
+	case q.ch <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *queue) run() {
+	defer close(q.done)
+
+	for {
+		select {
+		case e := <-q.ch:
+			q.deliver(e)
+		case <-q.stopCh:
+			// Send the alerts left in queue without retry.
+			for {
+				select {
+				case e := <-q.ch:
+					if err := q.send(e); err != nil {
+						glog.Errorf("output %s to(%s) error, %s", describe(e), q.name(), err)
+						spoolAlert(q.name(), e, err)
+						continue
+					}
+					unspoolAlert(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver send the alert, and retry with backoff when failed.
+func (q *queue) deliver(e *rule.WhizardEvent) {
+
+	for retry := 0; ; retry++ {
+		err := q.send(e)
+		q.setStatus(err)
+		if err == nil {
+			unspoolAlert(e)
+			if deadLetter != nil {
+				deadLetter.recovered(q.name())
+			}
+			return
+		}
+
+		if !retryable(err) {
+			// Retry or replay will not help, so the alert is not spooled.
+			glog.Errorf("output %s to(%s) error, %s, rejected by the receiver", describe(e), q.name(), err)
+			metrics.AlertsDropped.WithLabelValues(q.name(), metrics.ReasonRejected).Inc()
+			unspoolAlert(e)
+			return
+		}
+
+		config := q.delivery()
+		if retry >= config.GetMaxRetries() {
+			glog.Errorf("output %s to(%s) error, %s, retried %d times", describe(e), q.name(), err, retry)
+			spoolAlert(q.name(), e, err)
+			return
+		}
+
+		glog.Warningf("output %s to(%s) error, %s, will retry", describe(e), q.name(), err)
+		select {
+		case <-time.After(config.backoff(retry)):
+		case <-q.stopCh:
+			glog.Errorf("output %s to(%s) error, %s, queue stopped", describe(e), q.name(), err)
+			spoolAlert(q.name(), e, err)
+			return
+		}
+	}
+}
+
+func (q *queue) send(e *rule.WhizardEvent) (err error) {
+	q.sendMutex.Lock()
+	defer q.sendMutex.Unlock()
+
+	name := q.name()
+	start := time.Now()
+	defer func() {
+		metrics.ExportAttempts.WithLabelValues(name).Inc()
+		metrics.ExportLatency.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.ExportFailures.WithLabelValues(name).Inc()
+		}
+	}()
+
+	switch e.Kind {
+	case constant.Auditing:
+		return q.exporter.ExportAuditingAlerts(e.Auditing)
+	case constant.Event:
+		return q.exporter.ExportEventAlerts(e.Event)
+	case constant.Logging:
+		return q.exporter.ExportLoggingAlerts(e.Logging)
+	default:
+		return fmt.Errorf("unknown kind %s", e.Kind)
+	}
+}
+
+// setStatus record the result of a delivery.
+func (q *queue) setStatus(err error) {
+	q.statusMutex.Lock()
+	defer q.statusMutex.Unlock()
+
+	if err == nil {
+		q.status.LastDeliveryTime = time.Now()
+		return
+	}
+
+	q.status.LastError = err.Error()
+	q.status.LastErrorTime = time.Now()
+}
+
+func (q *queue) getStatus() ReceiverStatus {
+	q.statusMutex.Lock()
+	defer q.statusMutex.Unlock()
+
+	return q.status
+}
+
+// reconnect reset the exporter with the new receiver, the alerts in queue are kept.
+func (q *queue) reconnect(receiver *Receiver) error {
+	q.sendMutex.Lock()
+	defer q.sendMutex.Unlock()
+	q.Lock()
+	defer q.Unlock()
+
+	if err := q.exporter.Reconnect(receiver); err != nil {
+		return err
+	}
+	q.receiver = *receiver.DeepCopy()
+	q.config = receiver.Delivery
+	q.setRouting(receiver)
+
+	return nil
+}
+
+func (q *queue) setRouting(receiver *Receiver) {
+	// The match has been validated.
+	mc, err := newMatcher(receiver.Match)
+	if err != nil {
+		glog.Errorf("receiver %s match error, %s", receiver.ReceiverName, err)
+		mc, _ = newMatcher(nil)
+	}
+
+	q.routing.Store(&routing{name: receiver.ReceiverName, matcher: mc, dedup: receiver.Dedup.DeepCopy()})
+}
+
+// route return the reason if the alert should not be sent to this receiver.
+// The alert is sent to the receiver if the receiver is one of the targets
+// named by the rule (or there is no target) and the match of receiver matches the labels.
+func (q *queue) route(labels map[string]string, targets []string) string {
+
+	r := q.routing.Load().(*routing)
+	if len(targets) > 0 && !utils.IsExist(targets, r.name) {
+		return "not a receiver of the rule"
+	}
+
+	return r.matcher.match(labels)
+}
+
+// unchanged return true if the receiver is same as the receiver of this queue.
+func (q *queue) unchanged(receiver *Receiver) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	return reflect.DeepEqual(q.receiver, *receiver)
+}
+
+// sameExporter return true if the exporter of this queue is of the receiver.
+func (q *queue) sameExporter(receiver *Receiver) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.exporter.Type() == receiver.ReceiverType && q.exporter.DeepEqual(receiver)
+}
+
+// delivery return the delivery config of the receiver.
+func (q *queue) delivery() DeliveryConfig {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.config
+}
+
+// stop the worker after the alerts in queue are sent.
+func (q *queue) stop() {
+	q.dedup.close()
+	close(q.stopCh)
+	<-q.done
+}
+
+func (q *queue) name() string {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.exporter.Name()
+}
+
+func describe(e *rule.WhizardEvent) string {
+	switch {
+	case e.Kind == constant.Auditing && e.Auditing != nil:
+		return fmt.Sprintf("auditing(%s)", e.Auditing.AuditID)
+	case e.Kind == constant.Event && e.Event != nil && e.Event.Event != nil:
+		return fmt.Sprintf("event(%s)", e.Event.Event.UID)
+	case e.Kind == constant.Logging && e.Logging != nil:
+		return fmt.Sprintf("log of pod(%s/%s)", e.Logging.Namespace(), e.Logging.Pod())
+	default:
+		return e.Kind
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/metrics"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const fakeType = "fake"
+
+// fakeExporter records the ids of the alerts exported, and returns the errors in order.
+type fakeExporter struct {
+	sync.Mutex
+	name string
+	// The endpoint of the fake receiver, which is the generatorURL of receiver.
+	url string
+	// The errors returned by the exports, nil is returned after they are used up.
+	errs       []error
+	sent       []string
+	attempts   int
+	reconnects int
+}
+
+func newFakeExporter(receiver *Receiver) (Exporters, error) {
+	return &fakeExporter{name: receiver.ReceiverName, url: receiver.GeneratorURL}, nil
+}
+
+func (f *fakeExporter) Connect() error { return nil }
+func (f *fakeExporter) Name() string   { return f.name }
+func (f *fakeExporter) Type() string   { return fakeType }
+
+func (f *fakeExporter) Reconnect(receiver *Receiver) error {
+	f.Lock()
+	defer f.Unlock()
+
+	f.name, f.url = receiver.ReceiverName, receiver.GeneratorURL
+	f.reconnects++
+	return nil
+}
+
+func (f *fakeExporter) DeepEqual(receiver *Receiver) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.url == receiver.GeneratorURL
+}
+
+func (f *fakeExporter) ExportAuditingAlerts(a *rule.Auditing) error {
+	return f.export(string(a.AuditID))
+}
+
+func (f *fakeExporter) ExportEventAlerts(e *rule.Event) error {
+	return f.export(string(e.Event.UID))
+}
+
+func (f *fakeExporter) ExportLoggingAlerts(l *rule.Logging) error {
+	return f.export(l.Content())
+}
+
+func (f *fakeExporter) export(id string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	f.attempts++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	f.sent = append(f.sent, id)
+	return nil
+}
+
+func (f *fakeExporter) getSent() []string {
+	f.Lock()
+	defer f.Unlock()
+
+	return append([]string(nil), f.sent...)
+}
+
+func (f *fakeExporter) getAttempts() (int, int) {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.attempts, f.reconnects
+}
+
+func TestBackoff(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		config DeliveryConfig
+		retry  int
+		// The backoff before jitter, the result is between half of it and it.
+		want time.Duration
+	}{
+		{name: "default first retry", retry: 0, want: DefaultMinBackoff},
+		{name: "default third retry", retry: 2, want: 4 * DefaultMinBackoff},
+		{name: "default max", retry: 20, want: DefaultMaxBackoff},
+		{name: "exponential", config: DeliveryConfig{MinBackoff: time.Second, MaxBackoff: time.Minute}, retry: 3, want: 8 * time.Second},
+		{name: "capped", config: DeliveryConfig{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}, retry: 3, want: 5 * time.Second},
+		{name: "max less than min", config: DeliveryConfig{MinBackoff: time.Second, MaxBackoff: time.Millisecond}, retry: 3, want: time.Second},
+		{name: "large retry", config: DeliveryConfig{MinBackoff: time.Second, MaxBackoff: time.Minute}, retry: 1000, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[time.Duration]bool)
+			for i := 0; i < 100; i++ {
+				d := tt.config.backoff(tt.retry)
+				if d < tt.want/2 || d > tt.want {
+					t.Fatalf("got %s, want between %s and %s", d, tt.want/2, tt.want)
+				}
+				seen[d] = true
+			}
+			if len(seen) < 2 {
+				t.Errorf("got the same backoff %v, want jitter", seen)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: &StatusError{StatusCode: http.StatusInternalServerError}, want: true},
+		{err: &StatusError{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{err: &StatusError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{err: &StatusError{StatusCode: http.StatusBadRequest}, want: false},
+		{err: &StatusError{StatusCode: http.StatusUnauthorized}, want: false},
+		{err: &StatusError{StatusCode: http.StatusNotFound}, want: false},
+		{err: fmt.Errorf("endpoint 1 failed, %w", &StatusError{StatusCode: http.StatusBadRequest}), want: false},
+		{err: fmt.Errorf("connection refused"), want: true},
+	}
+
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v): got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	badRequest := &StatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request"}
+
+	tests := []struct {
+		name       string
+		maxRetries int
+		errs       []error
+		attempts   int
+		sent       bool
+		spooled    bool
+		// The reason of the dropped alert, empty if it is not dropped.
+		dropped string
+	}{
+		{name: "delivered", attempts: 1, sent: true},
+		{name: "delivered after retries", maxRetries: 3, errs: []error{unavailable, unavailable}, attempts: 3, sent: true},
+		{name: "spooled after retries", maxRetries: 2, errs: []error{unavailable, unavailable, unavailable}, attempts: 3, spooled: true},
+		{name: "spooled without retry", maxRetries: -1, errs: []error{fmt.Errorf("connection refused")}, attempts: 1, spooled: true},
+		{name: "rejected", maxRetries: 3, errs: []error{badRequest}, attempts: 1, dropped: metrics.ReasonRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "deliver-" + tt.name
+			s := newTestSpool(t.TempDir(), 1<<20, time.Hour)
+			savedSpool := deadLetter
+			deadLetter = s
+			defer func() { deadLetter = savedSpool }()
+
+			fake := &fakeExporter{name: name, errs: tt.errs}
+			q := newQueue(fake, &Receiver{
+				ReceiverName: name,
+				ReceiverType: fakeType,
+				Delivery:     DeliveryConfig{MaxRetries: tt.maxRetries, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+			})
+			defer q.stop()
+
+			q.deliver(newAuditingAlert(t, "1"))
+
+			if attempts, _ := fake.getAttempts(); attempts != tt.attempts {
+				t.Errorf("attempts: got %d, want %d", attempts, tt.attempts)
+			}
+			if sent := len(fake.getSent()) == 1; sent != tt.sent {
+				t.Errorf("sent: got %v, want %v", sent, tt.sent)
+			}
+			if spooled := len(spooledIDs(s, name)) == 1; spooled != tt.spooled {
+				t.Errorf("spooled: got %v, want %v", spooled, tt.spooled)
+			}
+			for _, reason := range []string{metrics.ReasonRejected, metrics.ReasonUndelivered} {
+				want := 0.0
+				if reason == tt.dropped {
+					want = 1
+				}
+				if got := testutil.ToFloat64(metrics.AlertsDropped.WithLabelValues(name, reason)); got != want {
+					t.Errorf("dropped %s: got %v, want %v", reason, got, want)
+				}
+			}
+			if status := q.getStatus(); status.Failing() == tt.sent {
+				t.Errorf("status: got %+v, want failing %v", status, !tt.sent)
+			}
+		})
+	}
+}
+
+func TestConnect(t *testing.T) {
+
+	RegisterPlugin(fakeType, newFakeExporter)
+	mutex.Lock()
+	saved := queues
+	queues = nil
+	mutex.Unlock()
+	defer func() {
+		Close()
+		mutex.Lock()
+		queues = saved
+		mutex.Unlock()
+	}()
+
+	receiver := func(name, url string, queueSize int) Receiver {
+		return Receiver{ReceiverName: name, ReceiverType: fakeType, GeneratorURL: url, Delivery: DeliveryConfig{QueueSize: queueSize}}
+	}
+	current := func() map[string]*queue {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		m := make(map[string]*queue)
+		for name, q := range queues {
+			m[name] = q
+		}
+		return m
+	}
+	stopped := func(q *queue) bool {
+		select {
+		case <-q.done:
+			return true
+		case <-time.After(5 * time.Second):
+			return false
+		}
+	}
+
+	if errs := Connect([]Receiver{receiver("a", "a", 10), receiver("b", "b", 10), receiver("c", "c", 10)}); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	first := current()
+	if len(first) != 3 {
+		t.Fatalf("got queues %v, want a, b and c", first)
+	}
+
+	// a is kept, b is reconnected with the new url, and c is reconnected with the new name.
+	if errs := Connect([]Receiver{receiver("a", "a", 10), receiver("b", "b2", 10), receiver("d", "c", 10)}); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	second := current()
+	if second["a"] != first["a"] || second["b"] != first["b"] || second["d"] != first["c"] || len(second) != 3 {
+		t.Fatalf("got queues %v, want a and b kept and c renamed to d", second)
+	}
+	if _, reconnects := first["a"].exporter.(*fakeExporter).getAttempts(); reconnects != 0 {
+		t.Errorf("a reconnected %d times, want 0", reconnects)
+	}
+	for _, name := range []string{"b", "d"} {
+		if _, reconnects := second[name].exporter.(*fakeExporter).getAttempts(); reconnects != 1 {
+			t.Errorf("%s reconnected %d times, want 1", name, reconnects)
+		}
+	}
+
+	// The queue of b is recreated since it is resized, and d is stopped.
+	if errs := Connect([]Receiver{receiver("a", "a", 10), receiver("b", "b2", 20)}); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	third := current()
+	if third["a"] != first["a"] || third["b"] == second["b"] || len(third) != 2 {
+		t.Fatalf("got queues %v, want a kept and b recreated", third)
+	}
+	if !stopped(second["b"]) || !stopped(second["d"]) {
+		t.Error("the queues of the resized and removed receivers are not stopped")
+	}
+
+	// The current queues are kept if any receiver is invalid.
+	if errs := Connect([]Receiver{receiver("a", "a", 10), {ReceiverName: "e", ReceiverType: "unknown"}}); len(errs) == 0 {
+		t.Fatal("the unknown receiver type should be rejected")
+	}
+	if fourth := current(); fourth["a"] != third["a"] || fourth["b"] != third["b"] || len(fourth) != 2 {
+		t.Errorf("got queues %v, want the current queues kept", fourth)
+	}
+}
+
+func TestDescribeEmptyEvent(t *testing.T) {
+
+	events, err := rule.NewEvents([]byte(`[null, {}, {"Event": {"metadata": {"uid": "1"}}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want the empty items skipped", len(events))
+	}
+
+	for _, e := range []*rule.WhizardEvent{
+		{Kind: constant.Event, Event: events[0]},
+		{Kind: constant.Event},
+		{Kind: constant.Event, Event: &rule.Event{}},
+		{Kind: constant.Auditing},
+		{Kind: constant.Logging},
+	} {
+		if describe(e) == "" {
+			t.Errorf("%+v is not described", e)
+		}
+	}
+}
@@ -16,6 +16,13 @@ limitations under the License.
 
 package exporter
 
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+)
+
 type Sink struct {
 	// The alert which receivers config.
 	Receivers []Receiver
@@ -32,6 +39,30 @@ type Receiver struct {
 	// ClientConfig holds the connection parameters for the webhook
 	// +optional
 	ReceiverConfig WebhookClientConfig `yaml:"config,omitempty" protobuf:"bytes,8,opt,name=config"`
+	// The schema of payload sent to webhook, alertmanager or notificationmanager.
+	// Default to alertmanager, which is same as the Alertmanager webhook payload.
+	// +optional
+	PayloadSchema string `yaml:"payloadSchema,omitempty"`
+	// Endpoints are the additional Alertmanager instances which the alert will be sent to,
+	// it used to send alert to all instances of a Alertmanager cluster.
+	// +optional
+	Endpoints []WebhookClientConfig `yaml:"endpoints,omitempty"`
+	// GeneratorURL is the url which set to the generatorURL of the alert sent to Alertmanager.
+	// +optional
+	GeneratorURL string `yaml:"generatorURL,omitempty"`
+	// ResolveTimeout is the duration after which the alert sent to Alertmanager will be resolved.
+	// Default to 5m.
+	// +optional
+	ResolveTimeout time.Duration `yaml:"resolveTimeout,omitempty"`
+	// Delivery controls the timeout, retry and queue size when sending alert to the receiver.
+	// +optional
+	Delivery DeliveryConfig `yaml:"delivery,omitempty"`
+	// Match selects the alerts which will be sent to this receiver, all alerts are sent if it is not set.
+	// +optional
+	Match *Match `yaml:"match,omitempty"`
+	// Dedup suppresses the duplicate alerts sent to this receiver, it is overridden by the dedup of rule.
+	// +optional
+	Dedup *Dedup `yaml:"dedup,omitempty"`
 }
 
 // WebhookClientConfig contains the information to make a connection with the webhook
@@ -77,6 +108,123 @@ type WebhookClientConfig struct {
 	// If unspecified, system trust roots on the apiserver are used.
 	// +optional
 	CABundle []byte `yaml:"caBundle,omitempty" protobuf:"bytes,3,opt,name=caBundle"`
+
+	// `bearerToken` is set to the Authorization header of the request.
+	// +optional
+	BearerToken string `yaml:"bearerToken,omitempty"`
+
+	// `basicAuth` is the basic authentication of the request, it is ignored when the bearerToken is set.
+	// +optional
+	BasicAuth *BasicAuth `yaml:"basicAuth,omitempty"`
+}
+
+// BasicAuth is the username and password of the basic authentication.
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// DeepCopy return a copy of the receiver.
+func (r *Receiver) DeepCopy() *Receiver {
+	if r == nil {
+		return nil
+	}
+
+	out := *r
+	out.ReceiverConfig = *r.ReceiverConfig.DeepCopy()
+	out.Endpoints = nil
+	for _, e := range r.Endpoints {
+		out.Endpoints = append(out.Endpoints, *e.DeepCopy())
+	}
+	out.Match = r.Match.DeepCopy()
+	out.Dedup = r.Dedup.DeepCopy()
+
+	return &out
+}
+
+// receiverEqual compare the two receivers except the name.
+func receiverEqual(r1, r2 *Receiver) bool {
+	if r1 == nil || r2 == nil {
+		return r1 == r2
+	}
+
+	c1, c2 := *r1, *r2
+	c1.ReceiverName, c2.ReceiverName = "", ""
+	return reflect.DeepEqual(c1, c2)
+}
+
+// DeepCopy return a copy of the config.
+func (c *WebhookClientConfig) DeepCopy() *WebhookClientConfig {
+	out := *c
+	if c.URL != nil {
+		u := *c.URL
+		out.URL = &u
+	}
+	if c.Service != nil {
+		service := *c.Service
+		if c.Service.Path != nil {
+			path := *c.Service.Path
+			service.Path = &path
+		}
+		if c.Service.Port != nil {
+			port := *c.Service.Port
+			service.Port = &port
+		}
+		out.Service = &service
+	}
+	if c.CABundle != nil {
+		out.CABundle = append([]byte{}, c.CABundle...)
+	}
+	if c.BasicAuth != nil {
+		basicAuth := *c.BasicAuth
+		out.BasicAuth = &basicAuth
+	}
+
+	return &out
+}
+
+// SetAuth set the Authorization header of the request.
+func (c *WebhookClientConfig) SetAuth(request *http.Request) {
+
+	if len(c.BearerToken) > 0 {
+		request.Header.Set("Authorization", "Bearer "+c.BearerToken)
+		return
+	}
+
+	if c.BasicAuth != nil {
+		request.SetBasicAuth(c.BasicAuth.Username, c.BasicAuth.Password)
+	}
+}
+
+// GetURL return the url of the webhook, it is built from the service when the url is not set.
+// The scheme is https if the caBundle is set.
+func (c *WebhookClientConfig) GetURL() (string, error) {
+
+	if c.URL != nil {
+		return *c.URL, nil
+	}
+
+	if c.Service == nil {
+		return "", fmt.Errorf("one of url or service must be specified")
+	}
+
+	url := ""
+	service := c.Service
+	if len(c.CABundle) > 0 {
+		url = fmt.Sprintf("https://%s.%s", service.Name, service.Namespace)
+	} else {
+		url = fmt.Sprintf("http://%s.%s", service.Name, service.Namespace)
+	}
+
+	if service.Port != nil {
+		url = fmt.Sprintf("%s:%d", url, *service.Port)
+	}
+
+	if service.Path != nil {
+		url = fmt.Sprintf("%s%s", url, *service.Path)
+	}
+
+	return url, nil
 }
 
 // ServiceReference holds a reference to Service.legacy.k8s.io
@@ -0,0 +1,267 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/rule"
+	"whizard-telemetry-ruler/pkg/utils"
+)
+
+const (
+	// The label of the rule group, it is only used to route alert.
+	LabelRuleGroup = "rulegroup"
+)
+
+var (
+	routeHistorySize int
+	routes           = &routeHistory{}
+)
+
+func init() {
+	flag.IntVar(&routeHistorySize, "route-history-size", 100, "The number of the recent alert routes kept for inspection")
+}
+
+// Match selects the alerts which will be sent to a receiver, an empty field matches all alerts.
+type Match struct {
+	// The severities of alert, INFO, WARNING, ERROR or CRITICAL.
+	// +optional
+	Severities []string `yaml:"severities,omitempty"`
+	// The types of alert, auditing, events or logging.
+	// +optional
+	Types []string `yaml:"types,omitempty"`
+	// The names of rule group.
+	// +optional
+	Groups []string `yaml:"groups,omitempty"`
+	// The names of rule.
+	// +optional
+	Rules []string `yaml:"rules,omitempty"`
+	// The labels of alert, the value is an anchored regular expression.
+	// +optional
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// DeepCopy return a copy of the match.
+func (m *Match) DeepCopy() *Match {
+	if m == nil {
+		return nil
+	}
+
+	out := &Match{
+		Severities: append([]string(nil), m.Severities...),
+		Types:      append([]string(nil), m.Types...),
+		Groups:     append([]string(nil), m.Groups...),
+		Rules:      append([]string(nil), m.Rules...),
+	}
+	if m.Labels != nil {
+		out.Labels = make(map[string]string)
+		for k, v := range m.Labels {
+			out.Labels[k] = v
+		}
+	}
+
+	return out
+}
+
+// matcher is the compiled Match.
+type matcher struct {
+	// The allowed values of labels.
+	values map[string][]string
+	// The regular expressions of labels.
+	regexps map[string]*regexp.Regexp
+}
+
+func newMatcher(m *Match) (*matcher, error) {
+
+	mc := &matcher{
+		values:  make(map[string][]string),
+		regexps: make(map[string]*regexp.Regexp),
+	}
+	if m == nil {
+		return mc, nil
+	}
+
+	for label, values := range map[string][]string{
+		"severity":     m.Severities,
+		"alerttype":    m.Types,
+		LabelRuleGroup: m.Groups,
+		"alertname":    m.Rules,
+	} {
+		if len(values) > 0 {
+			mc.values[label] = values
+		}
+	}
+
+	for label, expr := range m.Labels {
+		regex, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression of label %s, %s", label, err)
+		}
+		mc.regexps[label] = regex
+	}
+
+	return mc, nil
+}
+
+// match return the reason if the labels are not matched.
+func (mc *matcher) match(labels map[string]string) string {
+
+	for label, values := range mc.values {
+		if !utils.IsExist(values, labels[label]) {
+			return fmt.Sprintf("%s %q not in %v", label, labels[label], values)
+		}
+	}
+
+	for label, regex := range mc.regexps {
+		if !regex.MatchString(labels[label]) {
+			return fmt.Sprintf("%s %q not match %s", label, labels[label], regex)
+		}
+	}
+
+	return ""
+}
+
+// Route records which receivers an alert is sent to.
+type Route struct {
+	Time  time.Time `json:"time"`
+	Alert string    `json:"alert"`
+	// The labels used to route the alert.
+	Labels map[string]string `json:"labels"`
+	// The receivers named by the rule or the rule group.
+	Targets []string `json:"targets,omitempty"`
+	// The receivers which the alert is sent to.
+	Receivers []string `json:"receivers"`
+	// The receivers which the alert is not sent to, and the reason.
+	Skipped map[string]string `json:"skipped,omitempty"`
+	// The silence which suppresses the alert.
+	Silenced string `json:"silenced,omitempty"`
+}
+
+// routeHistory is a ring buffer of the recent routes.
+type routeHistory struct {
+	sync.Mutex
+	routes []*Route
+	next   int
+}
+
+func (h *routeHistory) add(r *Route) {
+	h.Lock()
+	defer h.Unlock()
+
+	if routeHistorySize <= 0 {
+		return
+	}
+
+	if len(h.routes) < routeHistorySize {
+		h.routes = append(h.routes, r)
+		return
+	}
+
+	h.routes[h.next%len(h.routes)] = r
+	h.next = (h.next + 1) % len(h.routes)
+}
+
+// list return the routes from the newest to the oldest.
+func (h *routeHistory) list() []*Route {
+	h.Lock()
+	defer h.Unlock()
+
+	var rs []*Route
+	for i := len(h.routes) - 1; i >= 0; i-- {
+		rs = append(rs, h.routes[(h.next+i)%len(h.routes)])
+	}
+
+	return rs
+}
+
+// GetRoutes return the recent routes from the newest to the oldest,
+// filtered by the receiver which the alert was sent to and the rule name.
+func GetRoutes(receiver, ruleName string) []*Route {
+
+	rs := make([]*Route, 0)
+	for _, r := range routes.list() {
+		if len(receiver) > 0 && !utils.IsExist(r.Receivers, receiver) {
+			continue
+		}
+		if len(ruleName) > 0 && r.Labels["alertname"] != ruleName {
+			continue
+		}
+		rs = append(rs, r)
+	}
+
+	return rs
+}
+
+// routingLabels return the labels used to route the alert, and the receivers named by the rule.
+func routingLabels(e *rule.WhizardEvent) (map[string]string, []string) {
+
+	var labels map[string]string
+	var group string
+	var targets []string
+	switch e.Kind {
+	case constant.Auditing:
+		labels = auditingAlert(e.Auditing).Labels
+		group, targets = e.Auditing.GetAlertRuleGroup(), e.Auditing.GetAlertReceivers()
+	case constant.Event:
+		labels = eventAlert(e.Event).Labels
+		group, targets = e.Event.GetAlertRuleGroup(), e.Event.GetAlertReceivers()
+	case constant.Logging:
+		labels = loggingAlert(e.Logging).Labels
+		group, targets = e.Logging.GetAlertRuleGroup(), e.Logging.GetAlertReceivers()
+	default:
+		labels = make(map[string]string)
+	}
+	labels[LabelRuleGroup] = group
+
+	return labels, targets
+}
+
+func newRoute(e *rule.WhizardEvent, labels map[string]string, targets []string) *Route {
+	return &Route{
+		Time:      time.Now(),
+		Alert:     describe(e),
+		Labels:    labels,
+		Targets:   targets,
+		Receivers: make([]string, 0),
+		Skipped:   make(map[string]string),
+	}
+}
+
+// skip record the receiver which the alert is not sent to.
+func (r *Route) skip(receiver, reason string) {
+	r.Skipped[receiver] = reason
+}
+
+func (r *Route) String() string {
+	if len(r.Silenced) > 0 {
+		return fmt.Sprintf("%s is suppressed by silence %s", r.Alert, r.Silenced)
+	}
+
+	if len(r.Receivers) == 0 {
+		return fmt.Sprintf("%s is not routed to any receiver", r.Alert)
+	}
+
+	sort.Strings(r.Receivers)
+	return fmt.Sprintf("%s is routed to %s", r.Alert, strings.Join(r.Receivers, ","))
+}
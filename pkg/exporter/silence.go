@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+	"whizard-telemetry-ruler/pkg/rule"
+)
+
+var (
+	// The compiled silences, they are replaced as a whole when reloading.
+	silences atomic.Value
+
+	suppressedMutex sync.Mutex
+	// The alerts suppressed since the last TakeSuppressed, by silence.
+	suppressed = make(map[string]*Suppressed)
+)
+
+// Silence suppresses the alerts matched by all matchers between startsAt and endsAt.
+type Silence struct {
+	Name     string
+	Matchers []SilenceMatcher
+	StartsAt time.Time
+	EndsAt   time.Time
+}
+
+// SilenceMatcher matches a label of alert or a field of event.
+type SilenceMatcher struct {
+	Label   string
+	Field   string
+	Value   string
+	IsRegex bool
+}
+
+// Suppressed is the number of alerts suppressed by a silence and the time of the last one.
+type Suppressed struct {
+	Count int64
+	Last  time.Time
+}
+
+type silence struct {
+	name     string
+	startsAt time.Time
+	endsAt   time.Time
+	matchers []*silenceMatcher
+}
+
+type silenceMatcher struct {
+	label string
+	field string
+	value string
+	regex *regexp.Regexp
+}
+
+func compileSilence(s *Silence) (*silence, error) {
+
+	if len(s.Matchers) == 0 {
+		return nil, fmt.Errorf("at least one matcher is required")
+	}
+
+	c := &silence{name: s.Name, startsAt: s.StartsAt, endsAt: s.EndsAt}
+	for _, m := range s.Matchers {
+		if (len(m.Label) == 0) == (len(m.Field) == 0) {
+			return nil, fmt.Errorf("exactly one of label or field must be specified")
+		}
+
+		mc := &silenceMatcher{label: m.Label, field: m.Field, value: m.Value}
+		if m.IsRegex {
+			regex, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %s, %s", m.Value, err)
+			}
+			mc.regex = regex
+		}
+		c.matchers = append(c.matchers, mc)
+	}
+
+	return c, nil
+}
+
+// ValidateSilence return the reason if the silence is invalid.
+func ValidateSilence(s *Silence) error {
+	_, err := compileSilence(s)
+	return err
+}
+
+// SetSilences replace the silences, the invalid silences are skipped.
+func SetSilences(ss []Silence) {
+
+	var cs []*silence
+	for i := range ss {
+		c, err := compileSilence(&ss[i])
+		if err != nil {
+			continue
+		}
+		cs = append(cs, c)
+	}
+
+	silences.Store(cs)
+}
+
+// TakeSuppressed return the alerts suppressed since the last call, by silence.
+func TakeSuppressed() map[string]*Suppressed {
+	suppressedMutex.Lock()
+	defer suppressedMutex.Unlock()
+
+	s := suppressed
+	suppressed = make(map[string]*Suppressed)
+	return s
+}
+
+// silenced return the name of the silence which suppresses the alert, or empty if the alert is not silenced.
+func silenced(e *rule.WhizardEvent, labels map[string]string) string {
+
+	cs, _ := silences.Load().([]*silence)
+	if len(cs) == 0 {
+		return ""
+	}
+
+	now := time.Now()
+	var fields rule.Fields
+	for _, c := range cs {
+		if now.Before(c.startsAt) || !now.Before(c.endsAt) {
+			continue
+		}
+
+		matched := true
+		for _, m := range c.matchers {
+			value := labels[m.label]
+			if len(m.field) > 0 {
+				if fields == nil {
+					fields = e.Fields()
+				}
+				if v := fields.Get(m.field); v != nil {
+					value = fmt.Sprint(v)
+				} else {
+					value = ""
+				}
+			}
+			if !m.match(value) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		suppressedMutex.Lock()
+		s, ok := suppressed[c.name]
+		if !ok {
+			s = &Suppressed{}
+			suppressed[c.name] = s
+		}
+		s.Count++
+		s.Last = now
+		suppressedMutex.Unlock()
+
+		return c.name
+	}
+
+	return ""
+}
+
+func (m *silenceMatcher) match(value string) bool {
+	if m.regex != nil {
+		return m.regex.MatchString(value)
+	}
+
+	return m.value == value
+}
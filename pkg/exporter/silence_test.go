@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/rule"
+)
+
+func TestSilenced(t *testing.T) {
+
+	now := time.Now()
+	active := func(matchers ...SilenceMatcher) Silence {
+		return Silence{Name: "s", Matchers: matchers, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}
+	}
+	labels := map[string]string{"alertname": "delete-pods", "namespace": "kube-system"}
+
+	tests := []struct {
+		name    string
+		silence Silence
+		want    bool
+	}{
+		{name: "label", silence: active(SilenceMatcher{Label: "namespace", Value: "kube-system"}), want: true},
+		{name: "label not matched", silence: active(SilenceMatcher{Label: "namespace", Value: "default"})},
+		{name: "missing label matches empty", silence: active(SilenceMatcher{Label: "pod", Value: ""}), want: true},
+		{name: "field", silence: active(SilenceMatcher{Field: "ObjectRef.Resource", Value: "pods"}), want: true},
+		{name: "field not matched", silence: active(SilenceMatcher{Field: "ObjectRef.Resource", Value: "secrets"})},
+		{name: "missing field matches empty", silence: active(SilenceMatcher{Field: "ObjectRef.Subresource", Value: ""}), want: true},
+		{
+			name: "all matchers",
+			silence: active(
+				SilenceMatcher{Label: "namespace", Value: "kube-system"},
+				SilenceMatcher{Field: "Verb", Value: "delete"},
+			),
+			want: true,
+		},
+		{
+			name: "one matcher not matched",
+			silence: active(
+				SilenceMatcher{Label: "namespace", Value: "kube-system"},
+				SilenceMatcher{Field: "Verb", Value: "create"},
+			),
+		},
+		{name: "regex", silence: active(SilenceMatcher{Label: "namespace", Value: "kube-.*", IsRegex: true}), want: true},
+		{name: "regex anchored at start", silence: active(SilenceMatcher{Label: "namespace", Value: "system", IsRegex: true})},
+		{name: "regex anchored at end", silence: active(SilenceMatcher{Label: "namespace", Value: "kube", IsRegex: true})},
+		{name: "regex alternation anchored", silence: active(SilenceMatcher{Label: "namespace", Value: "default|kube", IsRegex: true})},
+		{name: "regex alternation", silence: active(SilenceMatcher{Label: "namespace", Value: "default|kube-system", IsRegex: true}), want: true},
+		{name: "pending", silence: Silence{Name: "s", Matchers: []SilenceMatcher{{Label: "namespace", Value: "kube-system"}},
+			StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)}},
+		{name: "expired", silence: Silence{Name: "s", Matchers: []SilenceMatcher{{Label: "namespace", Value: "kube-system"}},
+			StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)}},
+	}
+
+	defer SetSilences(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSilence(&tt.silence); err != nil {
+				t.Fatal(err)
+			}
+			SetSilences([]Silence{tt.silence})
+			TakeSuppressed()
+
+			audits, err := rule.NewAuditing([]byte(`[{"auditID": "1", "verb": "delete", "objectRef": {"resource": "pods"}}]`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := &rule.WhizardEvent{Kind: constant.Auditing, Auditing: audits[0]}
+
+			got := silenced(e, labels) == "s"
+			if got != tt.want {
+				t.Errorf("silenced: got %v, want %v", got, tt.want)
+			}
+
+			s := TakeSuppressed()["s"]
+			if tt.want && (s == nil || s.Count != 1) {
+				t.Errorf("got suppressed %+v, want 1", s)
+			}
+			if !tt.want && s != nil {
+				t.Errorf("got suppressed %+v, want none", s)
+			}
+		})
+	}
+}
+
+func TestValidateSilence(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		matchers []SilenceMatcher
+		valid    bool
+	}{
+		{name: "no matcher"},
+		{name: "both label and field", matchers: []SilenceMatcher{{Label: "namespace", Field: "Verb", Value: "a"}}},
+		{name: "neither label nor field", matchers: []SilenceMatcher{{Value: "a"}}},
+		{name: "invalid regex", matchers: []SilenceMatcher{{Label: "namespace", Value: "(", IsRegex: true}}},
+		{name: "valid", matchers: []SilenceMatcher{{Label: "namespace", Value: "kube-.*", IsRegex: true}}, valid: true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateSilence(&Silence{Name: "s", Matchers: tt.matchers})
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,668 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/metrics"
+	"whizard-telemetry-ruler/pkg/rule"
+
+	"github.com/golang/glog"
+)
+
+const (
+	spoolFileSuffix = ".json"
+)
+
+var (
+	spoolDir            string
+	spoolMaxSize        int64
+	spoolMaxAge         time.Duration
+	spoolReplayInterval time.Duration
+
+	deadLetter *spool
+)
+
+func init() {
+	flag.StringVar(&spoolDir, "spool-dir", "", "The directory to persist the alerts which failed to deliver, disabled if empty")
+	flag.Int64Var(&spoolMaxSize, "spool-max-size", 100*1024*1024, "The max bytes of the alerts persisted in spool")
+	flag.DurationVar(&spoolMaxAge, "spool-max-age", 24*time.Hour, "The alerts persisted in spool longer than this will be deleted")
+	flag.DurationVar(&spoolReplayInterval, "spool-replay-interval", time.Minute, "The interval to check whether the receivers with spooled alerts recovered")
+}
+
+// SpoolRecord is an alert persisted in the spool because it could not be delivered.
+type SpoolRecord struct {
+	ID        string          `json:"id"`
+	Receiver  string          `json:"receiver"`
+	Kind      string          `json:"kind"`
+	RuleName  string          `json:"ruleName,omitempty"`
+	RuleGroup string          `json:"ruleGroup,omitempty"`
+	Severity  string          `json:"severity,omitempty"`
+	Receivers []string        `json:"receivers,omitempty"`
+	Dedup     *v1alpha1.Dedup `json:"dedup,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	SpooledAt time.Time       `json:"spooledAt"`
+	Auditing  *rule.Auditing  `json:"auditing,omitempty"`
+	Event     *rule.Event     `json:"event,omitempty"`
+	Logging   *rule.Logging   `json:"logging,omitempty"`
+
+	size int64
+}
+
+func newSpoolRecord(receiver string, e *rule.WhizardEvent, err error) *SpoolRecord {
+	r := &SpoolRecord{
+		Receiver:  receiver,
+		Kind:      e.Kind,
+		SpooledAt: time.Now(),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	switch e.Kind {
+	case constant.Auditing:
+		r.Auditing = e.Auditing
+		r.RuleName = e.Auditing.GetAlertRuleName()
+		r.Severity = e.Auditing.GetAlertSeverity()
+		r.RuleGroup = e.Auditing.GetAlertRuleGroup()
+		r.Receivers = e.Auditing.GetAlertReceivers()
+		r.Dedup = e.Auditing.GetAlertDedup()
+	case constant.Event:
+		r.Event = e.Event
+		r.RuleName = e.Event.GetAlertRuleName()
+		r.Severity = e.Event.GetAlertSeverity()
+		r.RuleGroup = e.Event.GetAlertRuleGroup()
+		r.Receivers = e.Event.GetAlertReceivers()
+		r.Dedup = e.Event.GetAlertDedup()
+	case constant.Logging:
+		r.Logging = e.Logging
+		r.RuleName = e.Logging.GetAlertRuleName()
+		r.Severity = e.Logging.GetAlertSeverity()
+		r.RuleGroup = e.Logging.GetAlertRuleGroup()
+		r.Receivers = e.Logging.GetAlertReceivers()
+		r.Dedup = e.Logging.GetAlertDedup()
+	}
+
+	return r
+}
+
+// whizardEvent restore the alert from the record.
+func (r *SpoolRecord) whizardEvent() *rule.WhizardEvent {
+	e := &rule.WhizardEvent{
+		Kind:     r.Kind,
+		Auditing: r.Auditing,
+		Event:    r.Event,
+		Logging:  r.Logging,
+	}
+
+	switch {
+	case r.Auditing != nil:
+		r.Auditing.SetAlertRuleName(r.RuleName)
+		r.Auditing.SetAlertSeverity(r.Severity)
+		r.Auditing.SetAlertRuleGroup(r.RuleGroup)
+		r.Auditing.SetAlertReceivers(r.Receivers)
+		r.Auditing.SetAlertDedup(r.Dedup)
+	case r.Event != nil:
+		r.Event.SetAlertRuleName(r.RuleName)
+		r.Event.SetAlertSeverity(r.Severity)
+		r.Event.SetAlertRuleGroup(r.RuleGroup)
+		r.Event.SetAlertReceivers(r.Receivers)
+		r.Event.SetAlertDedup(r.Dedup)
+	case r.Logging != nil:
+		r.Logging.SetAlertRuleName(r.RuleName)
+		r.Logging.SetAlertSeverity(r.Severity)
+		r.Logging.SetAlertRuleGroup(r.RuleGroup)
+		r.Logging.SetAlertReceivers(r.Receivers)
+		r.Logging.SetAlertDedup(r.Dedup)
+	}
+
+	return e
+}
+
+// spool persists the alerts which could not be delivered on disk, one file per alert,
+// in the sub directory of the receiver. The records are indexed in memory, so evicting
+// and expiring them do not read the directory.
+type spool struct {
+	sync.Mutex
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	seq     uint64
+	// The total bytes of the records.
+	size int64
+	// The records of every receiver, sorted from oldest to newest.
+	index map[string][]*spoolEntry
+	// The entries of the records which are replayed and waiting to be delivered, by the replayed alerts.
+	// The records are removed after the alerts are delivered, and kept if the alerts fail again.
+	queued map[*rule.WhizardEvent]*spoolEntry
+	// The receivers which are replaying.
+	replaying sync.Map
+}
+
+// spoolEntry is the index of a record, the record is read from disk only when it is listed or replayed.
+type spoolEntry struct {
+	id        string
+	receiver  string
+	size      int64
+	spooledAt time.Time
+	// Whether the record is replayed and waiting to be delivered, it is not replayed again until the delivery fails.
+	queued bool
+}
+
+// InitSpool create the spool if the spool dir is set, and start the loop to
+// replay the spooled alerts when the receivers recover.
+func InitSpool() error {
+
+	if len(spoolDir) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return err
+	}
+
+	s := &spool{
+		dir:     spoolDir,
+		maxSize: spoolMaxSize,
+		maxAge:  spoolMaxAge,
+		index:   make(map[string][]*spoolEntry),
+		queued:  make(map[*rule.WhizardEvent]*spoolEntry),
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	deadLetter = s
+	go s.loop()
+
+	return nil
+}
+
+// load build the index from the names and sizes of the files in the spool dir.
+func (s *spool) load() error {
+
+	dirs, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		name, err := base64.RawURLEncoding.DecodeString(d.Name())
+		if err != nil {
+			glog.Errorf("spool dir %s is not of a receiver, %s", d.Name(), err)
+			continue
+		}
+		receiver := string(name)
+
+		fs, err := ioutil.ReadDir(filepath.Join(s.dir, d.Name()))
+		if err != nil {
+			return err
+		}
+		for _, f := range fs {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), spoolFileSuffix) {
+				continue
+			}
+			id := strings.TrimSuffix(f.Name(), spoolFileSuffix)
+			s.add(&spoolEntry{id: id, receiver: receiver, size: f.Size(), spooledAt: spoolTime(id, f.ModTime())})
+		}
+	}
+
+	return nil
+}
+
+// spoolTime return the time when the record is spooled, which is the prefix of its id.
+func spoolTime(id string, modTime time.Time) time.Time {
+
+	ns, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return modTime
+	}
+
+	return time.Unix(0, ns)
+}
+
+func (s *spool) receiverDir(receiver string) string {
+	return filepath.Join(s.dir, base64.RawURLEncoding.EncodeToString([]byte(receiver)))
+}
+
+func (s *spool) path(e *spoolEntry) string {
+	return filepath.Join(s.receiverDir(e.receiver), e.id+spoolFileSuffix)
+}
+
+func (s *spool) put(receiver string, e *rule.WhizardEvent, cause error) error {
+
+	r := newSpoolRecord(receiver, e, cause)
+	r.ID = fmt.Sprintf("%020d-%d", r.SpooledAt.UnixNano(), atomic.AddUint64(&s.seq, 1))
+
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if int64(len(bs)) > s.maxSize {
+		return fmt.Errorf("alert size %d is larger than the spool size %d", len(bs), s.maxSize)
+	}
+
+	if s.size+int64(len(bs)) > s.maxSize {
+		s.evict(s.size + int64(len(bs)) - s.maxSize)
+	}
+
+	dir := s.receiverDir(receiver)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, the record will not be broken if crashed.
+	entry := &spoolEntry{id: r.ID, receiver: receiver, size: int64(len(bs)), spooledAt: r.SpooledAt}
+	path := s.path(entry)
+	if err := ioutil.WriteFile(path+".tmp", bs, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	s.add(entry)
+	return nil
+}
+
+// add the entry to the index. Must be called with lock held.
+func (s *spool) add(e *spoolEntry) {
+
+	entries := s.index[e.receiver]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].id >= e.id })
+	entries = append(entries, nil)
+	copy(entries[i+1:], entries[i:])
+	entries[i] = e
+
+	s.index[e.receiver] = entries
+	s.size += e.size
+}
+
+// entries return the entries of the receiver, all entries if the receiver is empty,
+// sorted from oldest to newest. Must be called with lock held.
+func (s *spool) entries(receiver string) []*spoolEntry {
+
+	if len(receiver) > 0 {
+		return append([]*spoolEntry(nil), s.index[receiver]...)
+	}
+
+	var entries []*spoolEntry
+	for _, es := range s.index {
+		entries = append(entries, es...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+
+	return entries
+}
+
+// read the record of the entry, the broken record is removed. Must be called with lock held.
+func (s *spool) read(e *spoolEntry) (*SpoolRecord, error) {
+
+	path := s.path(e)
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.remove(e)
+		}
+		return nil, fmt.Errorf("read spooled alert %s error, %s", path, err)
+	}
+
+	r := &SpoolRecord{}
+	if err := json.Unmarshal(bs, r); err != nil {
+		s.remove(e)
+		return nil, fmt.Errorf("spooled alert %s is broken, %s", path, err)
+	}
+	r.size = e.size
+
+	return r, nil
+}
+
+// scan read the records of the receiver, all records if the receiver is empty.
+// The records are sorted from oldest to newest. Must be called with lock held.
+func (s *spool) scan(receiver string) []*SpoolRecord {
+
+	var records []*SpoolRecord
+	for _, e := range s.entries(receiver) {
+		r, err := s.read(e)
+		if err != nil {
+			glog.Error(err)
+			continue
+		}
+		records = append(records, r)
+	}
+
+	return records
+}
+
+// remove delete the record of the entry, and remove the entry from the index. Must be called with lock held.
+func (s *spool) remove(e *spoolEntry) {
+
+	path := s.path(e)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		glog.Errorf("remove spooled alert %s error, %s", path, err)
+		return
+	}
+
+	entries := s.index[e.receiver]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].id >= e.id })
+	if i == len(entries) || entries[i] != e {
+		return
+	}
+	entries = append(entries[:i], entries[i+1:]...)
+	if len(entries) == 0 {
+		delete(s.index, e.receiver)
+	} else {
+		s.index[e.receiver] = entries
+	}
+	s.size -= e.size
+}
+
+// oldest return the oldest entry of all receivers, nil if the spool is empty. Must be called with lock held.
+func (s *spool) oldest() *spoolEntry {
+
+	var oldest *spoolEntry
+	for _, entries := range s.index {
+		if oldest == nil || entries[0].id < oldest.id {
+			oldest = entries[0]
+		}
+	}
+
+	return oldest
+}
+
+// evict delete the oldest records until n bytes are freed. Must be called with lock held.
+func (s *spool) evict(n int64) {
+
+	var freed int64
+	for freed < n {
+		e := s.oldest()
+		if e == nil {
+			return
+		}
+		glog.Warningf("spool is full, drop the alert %s of receiver %s", e.id, e.receiver)
+		size := s.size
+		s.remove(e)
+		if s.size == size {
+			// The record could not be removed.
+			return
+		}
+		metrics.AlertsDropped.WithLabelValues(e.receiver, metrics.ReasonEvicted).Inc()
+		freed += e.size
+	}
+}
+
+// expire delete the records older than the max age.
+func (s *spool) expire() {
+	s.Lock()
+	defer s.Unlock()
+
+	var expired []*spoolEntry
+	for _, entries := range s.index {
+		for _, e := range entries {
+			if time.Since(e.spooledAt) <= s.maxAge {
+				break
+			}
+			expired = append(expired, e)
+		}
+	}
+
+	for _, e := range expired {
+		glog.Warningf("drop the expired alert %s of receiver %s", e.id, e.receiver)
+		s.remove(e)
+		metrics.AlertsDropped.WithLabelValues(e.receiver, metrics.ReasonExpired).Inc()
+	}
+}
+
+// loop periodically delete the expired records, and probe the receivers which
+// have spooled alerts by sending the oldest one. All records will be replayed
+// once the probe is delivered.
+func (s *spool) loop() {
+
+	ticker := time.NewTicker(spoolReplayInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.expire()
+
+		s.Lock()
+		var receivers []string
+		for receiver := range s.index {
+			receivers = append(receivers, receiver)
+		}
+		s.Unlock()
+
+		for _, receiver := range receivers {
+			if _, err := s.replay(receiver, 1); err != nil {
+				glog.Errorf("replay spooled alerts of receiver %s error, %s", receiver, err)
+			}
+		}
+	}
+}
+
+// replay add at most limit records of the receiver to its delivery queue,
+// all records if limit is not positive, return the number of replayed records.
+// The records are kept until the replayed alerts are delivered.
+func (s *spool) replay(receiver string, limit int) (int, error) {
+
+	q := getQueueByName(receiver)
+	if q == nil {
+		return 0, fmt.Errorf("receiver %s not found", receiver)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	n := 0
+	for _, e := range s.entries(receiver) {
+		if limit > 0 && n >= limit {
+			break
+		}
+		if e.queued {
+			continue
+		}
+
+		r, err := s.read(e)
+		if err != nil {
+			glog.Error(err)
+			continue
+		}
+		we := r.whizardEvent()
+		e.queued = true
+		s.queued[we] = e
+		if !q.enqueue(we) {
+			e.queued = false
+			delete(s.queued, we)
+			break
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// drop remove the record which the alert is replayed from, it does nothing if the alert is not replayed.
+func (s *spool) drop(e *rule.WhizardEvent) {
+	s.Lock()
+	defer s.Unlock()
+
+	entry, ok := s.queued[e]
+	if !ok {
+		return
+	}
+	delete(s.queued, e)
+	s.remove(entry)
+}
+
+// release keep the record which the alert is replayed from after the alert failed again, so it is replayed
+// later with the id and spooled time of the record. Return false if the alert is not replayed.
+func (s *spool) release(e *rule.WhizardEvent) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	entry, ok := s.queued[e]
+	if !ok {
+		return false
+	}
+	delete(s.queued, e)
+	entry.queued = false
+
+	return true
+}
+
+// recovered is called when an alert is delivered to the receiver,
+// the spooled alerts of the receiver will be replayed.
+func (s *spool) recovered(receiver string) {
+
+	s.Lock()
+	pending := len(s.index[receiver])
+	s.Unlock()
+	if pending == 0 {
+		return
+	}
+
+	if _, loaded := s.replaying.LoadOrStore(receiver, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer s.replaying.Delete(receiver)
+
+		n, err := s.replay(receiver, 0)
+		if err != nil {
+			glog.Errorf("replay spooled alerts of receiver %s error, %s", receiver, err)
+			return
+		}
+		glog.Infof("receiver %s recovered, replay %d spooled alerts", receiver, n)
+	}()
+}
+
+func (s *spool) purge(receiver string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	entries := s.entries(receiver)
+	for _, e := range entries {
+		s.remove(e)
+	}
+
+	return len(entries), nil
+}
+
+// spoolAlert persist the alert which could not be delivered, the alert is dropped if the spool is disabled.
+// The replayed alert is not persisted again, its record is kept.
+func spoolAlert(receiver string, e *rule.WhizardEvent, cause error) {
+
+	if deadLetter == nil {
+		metrics.AlertsDropped.WithLabelValues(receiver, metrics.ReasonUndelivered).Inc()
+		return
+	}
+	if deadLetter.release(e) {
+		return
+	}
+
+	if err := deadLetter.put(receiver, e, cause); err != nil {
+		glog.Errorf("spool %s of receiver %s error, %s", describe(e), receiver, err)
+		metrics.AlertsDropped.WithLabelValues(receiver, metrics.ReasonUndelivered).Inc()
+	}
+}
+
+// unspoolAlert remove the spooled record of the alert if it is replayed, after the alert is delivered
+// or rejected by the receiver.
+func unspoolAlert(e *rule.WhizardEvent) {
+
+	if deadLetter == nil {
+		return
+	}
+
+	deadLetter.drop(e)
+}
+
+// ListSpooledAlerts return the spooled alerts of the receiver, all spooled alerts if the receiver is empty.
+func ListSpooledAlerts(receiver string) ([]*SpoolRecord, error) {
+
+	if deadLetter == nil {
+		return nil, fmt.Errorf("spool is disabled")
+	}
+
+	deadLetter.Lock()
+	defer deadLetter.Unlock()
+
+	return deadLetter.scan(receiver), nil
+}
+
+// ReplaySpooledAlerts send the spooled alerts of the receiver, all receivers if the receiver is empty.
+func ReplaySpooledAlerts(receiver string) (int, error) {
+
+	if deadLetter == nil {
+		return 0, fmt.Errorf("spool is disabled")
+	}
+
+	var receivers []string
+	if len(receiver) > 0 {
+		receivers = append(receivers, receiver)
+	} else {
+		deadLetter.Lock()
+		for r := range deadLetter.index {
+			receivers = append(receivers, r)
+		}
+		deadLetter.Unlock()
+	}
+
+	total := 0
+	for _, r := range receivers {
+		n, err := deadLetter.replay(r, 0)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// PurgeSpooledAlerts delete the spooled alerts of the receiver, all spooled alerts if the receiver is empty.
+func PurgeSpooledAlerts(receiver string) (int, error) {
+
+	if deadLetter == nil {
+		return 0, fmt.Errorf("spool is disabled")
+	}
+
+	return deadLetter.purge(receiver)
+}
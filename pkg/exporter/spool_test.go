@@ -0,0 +1,248 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exporter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/rule"
+)
+
+func newAuditingAlert(t *testing.T, id string) *rule.WhizardEvent {
+	audits, err := rule.NewAuditing([]byte(fmt.Sprintf(`[{"auditID":%q,"verb":"delete"}]`, id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audits[0].SetAlertRuleName("rule")
+	audits[0].SetAlertRuleGroup("group")
+
+	return &rule.WhizardEvent{Kind: constant.Auditing, Auditing: audits[0]}
+}
+
+func newTestSpool(dir string, maxSize int64, maxAge time.Duration) *spool {
+	return &spool{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		index:   make(map[string][]*spoolEntry),
+		queued:  make(map[*rule.WhizardEvent]*spoolEntry),
+	}
+}
+
+// spooledIDs return the ids of the alerts spooled for the receiver, which are read from the records.
+func spooledIDs(s *spool, receiver string) []string {
+	s.Lock()
+	defer s.Unlock()
+
+	var ids []string
+	for _, r := range s.scan(receiver) {
+		ids = append(ids, string(r.Auditing.AuditID))
+	}
+	return ids
+}
+
+func files(t *testing.T, s *spool, receiver string) int {
+	fs, err := ioutil.ReadDir(s.receiverDir(receiver))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(fs)
+}
+
+func TestSpoolPutAndLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	s := newTestSpool(dir, 1<<20, time.Hour)
+	for _, c := range []struct{ receiver, id string }{{"a", "1"}, {"b", "2"}, {"a", "3"}} {
+		if err := s.put(c.receiver, newAuditingAlert(t, c.id), fmt.Errorf("failed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := fmt.Sprint(spooledIDs(s, "a")); got != "[1 3]" {
+		t.Errorf("receiver a: got %s, want [1 3]", got)
+	}
+	if got := fmt.Sprint(spooledIDs(s, "")); got != "[1 2 3]" {
+		t.Errorf("all receivers: got %s, want [1 2 3]", got)
+	}
+
+	// The index is rebuilt from the files after restarting.
+	loaded := newTestSpool(dir, 1<<20, time.Hour)
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.size != s.size {
+		t.Errorf("size: got %d, want %d", loaded.size, s.size)
+	}
+	for receiver, entries := range s.index {
+		got := loaded.index[receiver]
+		if len(got) != len(entries) {
+			t.Fatalf("receiver %s: got %d entries, want %d", receiver, len(got), len(entries))
+		}
+		for i, e := range entries {
+			if got[i].id != e.id || got[i].size != e.size || !got[i].spooledAt.Equal(e.spooledAt) {
+				t.Errorf("receiver %s: got entry %+v, want %+v", receiver, *got[i], *e)
+			}
+		}
+	}
+
+	records := loaded.scan("a")
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	r := records[0]
+	if r.Receiver != "a" || r.RuleName != "rule" || r.RuleGroup != "group" || r.Error != "failed" {
+		t.Errorf("got record %+v", r)
+	}
+	if e := r.whizardEvent(); e.Auditing.GetAlertRuleName() != "rule" {
+		t.Errorf("restored rule name: got %q, want rule", e.Auditing.GetAlertRuleName())
+	}
+}
+
+func TestSpoolEvict(t *testing.T) {
+
+	s := newTestSpool(t.TempDir(), 1<<20, time.Hour)
+	if err := s.put("a", newAuditingAlert(t, "1"), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Room for two records.
+	s.maxSize = s.size*2 + s.size/2
+
+	for _, id := range []string{"2", "3"} {
+		if err := s.put("a", newAuditingAlert(t, id), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := fmt.Sprint(spooledIDs(s, "a")); got != "[2 3]" {
+		t.Errorf("got %s, want [2 3]", got)
+	}
+	if n := files(t, s, "a"); n != 2 {
+		t.Errorf("got %d files, want 2", n)
+	}
+	if s.size > s.maxSize {
+		t.Errorf("size %d is larger than %d", s.size, s.maxSize)
+	}
+
+	s.maxSize = 1
+	if err := s.put("a", newAuditingAlert(t, "4"), nil); err == nil {
+		t.Error("the alert larger than the spool should not be spooled")
+	}
+}
+
+func TestSpoolExpire(t *testing.T) {
+
+	s := newTestSpool(t.TempDir(), 1<<20, 50*time.Millisecond)
+	for _, id := range []string{"1", "2"} {
+		if err := s.put("a", newAuditingAlert(t, id), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := s.put("a", newAuditingAlert(t, "3"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expire()
+	if got := fmt.Sprint(spooledIDs(s, "a")); got != "[3]" {
+		t.Errorf("got %s, want [3]", got)
+	}
+	if n := files(t, s, "a"); n != 1 {
+		t.Errorf("got %d files, want 1", n)
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+
+	s := newTestSpool(t.TempDir(), 1<<20, time.Hour)
+	fake := &fakeExporter{name: "a", errs: []error{fmt.Errorf("unavailable")}}
+	q := newQueue(fake, &Receiver{ReceiverName: "a", ReceiverType: fakeType, Delivery: DeliveryConfig{MaxRetries: -1}})
+
+	mutex.Lock()
+	saved, savedSpool := queues, deadLetter
+	queues, deadLetter = map[string]*queue{"a": q}, s
+	mutex.Unlock()
+	defer func() {
+		q.stop()
+		mutex.Lock()
+		queues, deadLetter = saved, savedSpool
+		mutex.Unlock()
+	}()
+
+	for _, id := range []string{"1", "2"} {
+		if err := s.put("a", newAuditingAlert(t, id), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Lock()
+	first := *s.index["a"][0]
+	s.Unlock()
+
+	// The probe fails, the record is kept with its id and spooled time.
+	if n, err := s.replay("a", 1); err != nil || n != 1 {
+		t.Fatalf("replay: got %d, %v, want 1", n, err)
+	}
+	waitFor(t, func() bool {
+		s.Lock()
+		defer s.Unlock()
+		return len(s.queued) == 0
+	})
+	s.Lock()
+	entries := append([]*spoolEntry(nil), s.index["a"]...)
+	s.Unlock()
+	if len(entries) != 2 || entries[0].id != first.id || !entries[0].spooledAt.Equal(first.spooledAt) || entries[0].queued {
+		t.Fatalf("got entries %+v, want the first one kept", entries)
+	}
+	if n := files(t, s, "a"); n != 2 {
+		t.Fatalf("got %d files, want 2", n)
+	}
+
+	// The probe is delivered, the records are removed, and the others are replayed.
+	if n, err := s.replay("a", 1); err != nil || n != 1 {
+		t.Fatalf("replay: got %d, %v, want 1", n, err)
+	}
+	waitFor(t, func() bool { return len(fake.getSent()) == 2 })
+	waitFor(t, func() bool {
+		s.Lock()
+		defer s.Unlock()
+		return len(s.index) == 0 && len(s.queued) == 0
+	})
+	if got := fmt.Sprint(fake.getSent()); got != "[1 2]" {
+		t.Errorf("sent: got %s, want [1 2]", got)
+	}
+	if n := files(t, s, "a"); n != 0 {
+		t.Errorf("got %d files, want 0", n)
+	}
+	if s.size != 0 {
+		t.Errorf("size: got %d, want 0", s.size)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -22,8 +22,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"github.com/golang/glog"
-	alertType "github.com/prometheus/alertmanager/types"
-	"github.com/prometheus/common/model"
+	"github.com/prometheus/alertmanager/template"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -49,6 +48,10 @@ type WebhookExporter struct {
 	Client   http.Client
 	URL      string
 	CABundle []byte
+	// The schema of payload, alertmanager or notificationmanager.
+	PayloadSchema string
+	// The receiver which this exporter created from.
+	receiver *Receiver
 }
 
 func init() {
@@ -74,96 +77,79 @@ func (wh *WebhookExporter) Connect() error {
 }
 
 func (wh *WebhookExporter) ExportAuditingAlerts(a *rule.Auditing) error {
-	msg := a.Annotations
-	msgKey := "message"
-	msgValue := a.Message
-	if existingValue, exists := msg[msgKey]; exists {
-		fmt.Printf("Key '%s' already exists with value: %s,Please change the annotation field to another field \n", msg, existingValue)
-	} else {
-		msg[msgKey] = msgValue
-	}
-	var alert alertType.Alert
-	msgSet := make(model.LabelSet)
-	for k, v := range msg {
-		msgSet[model.LabelName(k)] = model.LabelValue(v)
+	return wh.export(auditingAlert(a))
+}
+
+func (wh *WebhookExporter) ExportEventAlerts(e *rule.Event) error {
+	return wh.export(eventAlert(e))
+}
+
+func (wh *WebhookExporter) ExportLoggingAlerts(l *rule.Logging) error {
+	return wh.export(loggingAlert(l))
+}
+
+func (wh *WebhookExporter) export(alert template.Alert) error {
+
+	var payload interface{}
+	switch wh.PayloadSchema {
+	case PayloadSchemaNotificationManager:
+		payload = template.Data{
+			Alerts: template.Alerts{alert},
+		}
+	default:
+		payload = newWebhookMessage(wh.name, alert)
 	}
-	alert.Annotations = msgSet
-	alert.Labels = map[model.LabelName]model.LabelValue{
-		"namespace":                model.LabelValue(a.ObjectRef.Namespace),
-		"resource":                 model.LabelValue(a.ObjectRef.Resource),
-		"name":                     model.LabelValue(a.ObjectRef.Name),
-		"user":                     model.LabelValue(a.User.Username),
-		"group":                    model.LabelValue(utils.OutputAsJson(a.User.Groups)),
-		"verb":                     model.LabelValue(a.Verb),
-		"alerttype":                "auditing",
-		"alertname":                model.LabelValue(a.GetAlertRuleName()),
-		"requestReceivedTimestamp": model.LabelValue(a.RequestReceivedTimestamp.String()),
+
+	s, err := utils.ToJsonString(payload)
+	if err != nil {
+		return err
 	}
 
-	request, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewBuffer([]byte(alert.String())))
+	request, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewBuffer([]byte(s)))
 	if err != nil {
 		return err
 	}
 	request.Header.Set("Content-Type", "application/json")
+	wh.receiver.ReceiverConfig.SetAuth(request)
 	response, err := wh.Client.Do(request)
 	if err != nil {
 		return err
 	}
-
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("%s", response.Status)
-	}
+	defer response.Body.Close()
 
 	// Discard the body
 	_, _ = io.Copy(ioutil.Discard, response.Body)
 
+	if response.StatusCode/100 != 2 {
+		return newStatusError(response)
+	}
+
 	return nil
 }
 
-func (wh *WebhookExporter) ExportEventAlerts(e *rule.Event) error {
+// NewHttpClient create a http client, the caBundle is used to validate the server
+// certificate when the url is https.
+func NewHttpClient(url string, caBundle []byte, timeout time.Duration) http.Client {
 
-	msg := e.Annotations
-	msgKey := "message"
-	msgValue := e.Message
-	if existingValue, exists := msg[msgKey]; exists {
-		fmt.Printf("Key '%s' already exists with value: %s,Please change the annotation field to another field \n", msg, existingValue)
-	} else {
-		msg[msgKey] = msgValue
-	}
-	var alert alertType.Alert
-	msgSet := make(model.LabelSet)
-	for k, v := range msg {
-		msgSet[model.LabelName(k)] = model.LabelValue(v)
-	}
-	alert.Annotations = msgSet
-	alert.Labels = map[model.LabelName]model.LabelValue{
-		"namespace": model.LabelValue(e.Event.Namespace),
-		"reason":    model.LabelValue(e.Event.Reason),
-		"name":      model.LabelValue(e.Event.Name),
-		"user":      model.LabelValue(e.Event.Source.Host),
-		"group":     model.LabelValue(utils.OutputAsJson(e.Event.Series)),
-		"alerttype": "events",
-		"alertname": model.LabelValue(e.GetAlertRuleName()),
+	transport := &http.Transport{
+		MaxIdleConns:        MaxIdleConns,
+		MaxConnsPerHost:     MaxConnsPerHost,
+		MaxIdleConnsPerHost: MaxIdleConnsPerHost,
+		IdleConnTimeout:     IdleConnTimeout,
 	}
 
-	request, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewBuffer([]byte(alert.String())))
-	if err != nil {
-		return err
-	}
-	request.Header.Set("Content-Type", "application/json")
-	response, err := wh.Client.Do(request)
-	if err != nil {
-		return err
+	if strings.HasPrefix(url, "https") {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(caBundle)
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs: pool,
+		}
 	}
 
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("%s", response.Status)
+	return http.Client{
+		Transport: transport,
+		Timeout:   timeout,
 	}
-
-	// Discard the body
-	_, _ = io.Copy(ioutil.Discard, response.Body)
-
-	return nil
 }
 
 // Reconnect only reset the webhook url and ca.
@@ -186,61 +172,28 @@ func (wh *WebhookExporter) GetHttpConfig(receiver *Receiver) error {
 
 	wh.CABundle = receiver.ReceiverConfig.CABundle
 
-	url := ""
-	if receiver.ReceiverConfig.URL != nil {
-		url = *receiver.ReceiverConfig.URL
-	} else if receiver.ReceiverConfig.Service != nil {
-		service := receiver.ReceiverConfig.Service
-		if len(receiver.ReceiverConfig.CABundle) > 0 {
-			url = fmt.Sprintf("https://%s.%s", service.Name, service.Namespace)
-		} else {
-			url = fmt.Sprintf("http://%s.%s", service.Name, service.Namespace)
-		}
-
-		if service.Port != nil {
-			url = fmt.Sprintf("%s:%d", url, *service.Port)
-		}
+	switch receiver.PayloadSchema {
+	case "":
+		wh.PayloadSchema = PayloadSchemaAlertmanager
+	case PayloadSchemaAlertmanager, PayloadSchemaNotificationManager:
+		wh.PayloadSchema = receiver.PayloadSchema
+	default:
+		return fmt.Errorf("unsupported payload schema %s", receiver.PayloadSchema)
+	}
 
-		if service.Path != nil {
-			url = fmt.Sprintf("%s%s", url, *service.Path)
-		}
-	} else {
+	url, err := receiver.ReceiverConfig.GetURL()
+	if err != nil {
 		return fmt.Errorf("no webhook receiver config")
 	}
 	wh.URL = url
 
+	wh.receiver = receiver.DeepCopy()
 	wh.name = receiver.ReceiverName
 	if len(wh.name) == 0 {
 		wh.name = wh.URL
 	}
 
-	if strings.HasPrefix(url, "https") {
-		pool := x509.NewCertPool()
-		pool.AppendCertsFromPEM(wh.CABundle)
-
-		wh.Client = http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					RootCAs: pool,
-				},
-				MaxIdleConns:        MaxIdleConns,
-				MaxConnsPerHost:     MaxConnsPerHost,
-				MaxIdleConnsPerHost: MaxIdleConnsPerHost,
-				IdleConnTimeout:     IdleConnTimeout,
-			},
-			Timeout: time.Second,
-		}
-	} else {
-		wh.Client = http.Client{
-			Transport: &http.Transport{
-				MaxIdleConns:        MaxIdleConns,
-				MaxConnsPerHost:     MaxConnsPerHost,
-				MaxIdleConnsPerHost: MaxIdleConnsPerHost,
-				IdleConnTimeout:     IdleConnTimeout,
-			},
-			Timeout: time.Second,
-		}
-	}
+	wh.Client = NewHttpClient(url, wh.CABundle, receiver.Delivery.GetTimeout())
 
 	return nil
 }
@@ -254,7 +207,6 @@ func (wh *WebhookExporter) Type() string {
 	return constant.WebhookReceiver
 }
 
-func (wh *WebhookExporter) DeepEqual(_ *Receiver) bool {
-
-	return false
+func (wh *WebhookExporter) DeepEqual(receiver *Receiver) bool {
+	return receiverEqual(wh.receiver, receiver)
 }
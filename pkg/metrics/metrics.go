@@ -0,0 +1,198 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "whizard_telemetry_ruler"
+)
+
+// The reasons why an event is rejected or dropped.
+const (
+	ReasonReadError     = "read_error"
+	ReasonDecodeError   = "decode_error"
+	ReasonWorkerTimeout = "worker_timeout"
+	ReasonMatchTimeout  = "match_timeout"
+)
+
+// The reasons why an alert is dropped.
+const (
+	// The receiver rejects the alert with a status which retry will not help.
+	ReasonRejected = "rejected"
+	// The alert could not be delivered and the spool is disabled or failed to persist it.
+	ReasonUndelivered = "undelivered"
+	// The alert is evicted from the full spool.
+	ReasonEvicted = "evicted"
+	// The alert is spooled longer than the max age.
+	ReasonExpired = "expired"
+)
+
+var (
+	// EventsReceived is the number of events accepted by the webhooks.
+	EventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_received_total",
+		Help:      "The number of events received, by kind.",
+	}, []string{"kind"})
+
+	// EventsRejected is the number of events rejected by the webhooks, a payload
+	// which could not be read or decoded counts as one.
+	EventsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_rejected_total",
+		Help:      "The number of events rejected, by kind and reason, a payload which could not be decoded counts as one.",
+	}, []string{"kind", "reason"})
+
+	// EventsDropped is the number of events dropped before or during matching.
+	EventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dropped_total",
+		Help:      "The number of events dropped because no worker was available or matching timed out, by kind and reason.",
+	}, []string{"kind", "reason"})
+
+	// WorkersBusy is the number of workers which are matching events.
+	WorkersBusy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_busy",
+		Help:      "The number of workers which are matching events.",
+	})
+
+	// WorkersMax is the max number of workers.
+	WorkersMax = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_max",
+		Help:      "The max number of workers.",
+	})
+
+	// RuleEvaluations is the number of times a rule is evaluated.
+	RuleEvaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_evaluations_total",
+		Help:      "The number of rule evaluations, by group and rule.",
+	}, []string{"group", "rule"})
+
+	// RuleEvaluationErrors is the number of failed rule evaluations.
+	RuleEvaluationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_evaluation_errors_total",
+		Help:      "The number of failed rule evaluations, by group and rule.",
+	}, []string{"group", "rule"})
+
+	// RuleMatches is the number of events matched by a rule.
+	RuleMatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_matches_total",
+		Help:      "The number of events matched, by group and rule.",
+	}, []string{"group", "rule"})
+
+	// RuleLoadErrors is the number of failed rule reloads, such as the rule groups could not be listed.
+	RuleLoadErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_load_errors_total",
+		Help:      "The number of failed rule reloads.",
+	})
+
+	// RulesInvalid is the number of invalid rules which are dropped by the last load.
+	RulesInvalid = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rules_invalid",
+		Help:      "The number of invalid rules which are dropped by the last load.",
+	})
+
+	// RuleReloads is the number of successful rule reloads.
+	RuleReloads = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_reloads_total",
+		Help:      "The number of successful rule reloads.",
+	})
+
+	// ExportAttempts is the number of attempts to send alert to a receiver, the retries are included.
+	ExportAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "export_attempts_total",
+		Help:      "The number of attempts to send alert, by receiver.",
+	}, []string{"receiver"})
+
+	// ExportFailures is the number of failed attempts to send alert to a receiver.
+	ExportFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "export_failures_total",
+		Help:      "The number of failed attempts to send alert, by receiver.",
+	}, []string{"receiver"})
+
+	// ExportLatency is the latency of sending alert to a receiver.
+	ExportLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "export_duration_seconds",
+		Help:      "The latency of sending alert, by receiver.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"receiver"})
+
+	// AlertsDropped is the number of alerts which are never delivered to a receiver.
+	AlertsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_dropped_total",
+		Help:      "The number of alerts which are not delivered, by receiver and reason.",
+	}, []string{"receiver", "reason"})
+
+	// AlertsDeduplicated is the number of duplicate alerts suppressed before sending to a receiver.
+	AlertsDeduplicated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_deduplicated_total",
+		Help:      "The number of duplicate alerts suppressed, by receiver.",
+	}, []string{"receiver"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		EventsReceived,
+		EventsRejected,
+		EventsDropped,
+		WorkersBusy,
+		WorkersMax,
+		RuleEvaluations,
+		RuleEvaluationErrors,
+		RuleMatches,
+		RuleLoadErrors,
+		RulesInvalid,
+		RuleReloads,
+		ExportAttempts,
+		ExportFailures,
+		ExportLatency,
+		AlertsDropped,
+		AlertsDeduplicated,
+	)
+}
+
+// RegisterChannel register the gauges of the depth and capacity of the event channel.
+func RegisterChannel(depth, capacity func() float64) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "event_channel_depth",
+			Help:      "The number of events waiting in the channel to be matched.",
+		}, depth),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "event_channel_capacity",
+			Help:      "The capacity of the event channel.",
+		}, capacity),
+	)
+}
@@ -17,7 +17,10 @@ limitations under the License.
 package rule
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
 	"whizard-telemetry-ruler/pkg/utils"
 
 	"strings"
@@ -37,22 +40,67 @@ type Auditing struct {
 	Message string
 	// name of rule which triggered alert.
 	alertRuleName string
+	// severity of rule which triggered alert.
+	alertSeverity string
+	// group of rule which triggered alert.
+	alertRuleGroup string
+	// the receivers which the alert is routed to, empty means all receivers.
+	alertReceivers []string
+	// the dedup of rule which triggered alert, nil means the dedup of receivers.
+	alertDedup *v1alpha1.Dedup
 	//custom message
 	Annotations map[string]string
 }
 
+const (
+	EventListKind = "EventList"
+)
+
+// The api versions of EventList which the audit webhook backend of kube-apiserver sent.
+var auditAPIVersions = []string{
+	"audit.k8s.io/v1",
+	"audit.k8s.io/v1beta1",
+}
+
+// EventList is the body which the audit webhook backend of kube-apiserver sent.
+type EventList struct {
+	Kind       string      `json:"kind,omitempty"`
+	APIVersion string      `json:"apiVersion,omitempty"`
+	Items      []*Auditing `json:"items"`
+}
+
+// NewAuditing parse the auditing events, the body can be an EventList sent by
+// the audit webhook backend of kube-apiserver, or an array of events.
 func NewAuditing(data []byte) ([]*Auditing, error) {
 
 	var auditingList []*Auditing
 
-	err := json.Unmarshal(data, &auditingList)
-	if err != nil {
-		glog.Errorf("unmarshal failed with:%v,body is: %s", err, string(data))
-		return nil, err
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		el := &EventList{}
+		if err := json.Unmarshal(data, el); err != nil {
+			glog.Errorf("unmarshal failed with:%v,body is: %s", err, string(data))
+			return nil, err
+		}
+
+		if el.Kind != EventListKind || !utils.IsExist(auditAPIVersions, el.APIVersion) {
+			glog.Errorf("unsupported kind %s of %s", el.Kind, el.APIVersion)
+			return nil, fmt.Errorf("unsupported kind %s of %s", el.Kind, el.APIVersion)
+		}
+		auditingList = el.Items
+	} else {
+		err := json.Unmarshal(data, &auditingList)
+		if err != nil {
+			glog.Errorf("unmarshal failed with:%v,body is: %s", err, string(data))
+			return nil, err
+		}
 	}
 
 	var es []*Auditing
 	for _, event := range auditingList {
+		if event == nil {
+			continue
+		}
 		e := event
 		e.Verb = strings.ToLower(e.Verb)
 		es = append(es, e)
@@ -118,6 +166,12 @@ func (a *Auditing) ToString() string {
 	return s
 }
 
+// Fields return the fields of the audit event which rules match, the request and response
+// objects are only decoded when they are read.
+func (a *Auditing) Fields() Fields {
+	return utils.NewFieldAccessor(&a.Event)
+}
+
 func (a *Auditing) GetAlertRuleName() string {
 	return a.alertRuleName
 }
@@ -125,3 +179,35 @@ func (a *Auditing) GetAlertRuleName() string {
 func (a *Auditing) SetAlertRuleName(n string) {
 	a.alertRuleName = n
 }
+
+func (a *Auditing) GetAlertSeverity() string {
+	return a.alertSeverity
+}
+
+func (a *Auditing) SetAlertSeverity(s string) {
+	a.alertSeverity = s
+}
+
+func (a *Auditing) GetAlertRuleGroup() string {
+	return a.alertRuleGroup
+}
+
+func (a *Auditing) SetAlertRuleGroup(g string) {
+	a.alertRuleGroup = g
+}
+
+func (a *Auditing) GetAlertReceivers() []string {
+	return a.alertReceivers
+}
+
+func (a *Auditing) SetAlertReceivers(rs []string) {
+	a.alertReceivers = rs
+}
+
+func (a *Auditing) GetAlertDedup() *v1alpha1.Dedup {
+	return a.alertDedup
+}
+
+func (a *Auditing) SetAlertDedup(d *v1alpha1.Dedup) {
+	a.alertDedup = d
+}
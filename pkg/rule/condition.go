@@ -0,0 +1,686 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+	"github.com/kubesphere/event-rule-engine/visitor/parser"
+)
+
+const (
+	arrayOperatorAny = 1
+	arrayOperatorAll = 2
+)
+
+var likeRegex = regexp.MustCompile("(\\*)+")
+
+// Fields gives the fields of event with the dotted names, such as `ObjectRef.Resource`,
+// the names and values are same as the flattened map of the JSON of event.
+type Fields interface {
+	// Get return the value of field, nil if the field does not exist or it is an object.
+	Get(name string) interface{}
+	// Exists return true if the field has a value, or it is an object which has any field with value.
+	Exists(name string) bool
+}
+
+// MapFields is the Fields of a flattened map.
+type MapFields map[string]interface{}
+
+func (m MapFields) Get(name string) interface{} {
+	return m[name]
+}
+
+func (m MapFields) Exists(name string) bool {
+	if m[name] != nil {
+		return true
+	}
+
+	// The field is an object which has been flattened.
+	prefix := name + "."
+	for k, v := range m {
+		if strings.HasPrefix(k, prefix) && v != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evaluator evaluates a compiled expression with the fields of event.
+type evaluator func(f Fields) (bool, error)
+
+// Condition is the compiled condition of a rule, it has the same semantics as
+// the event-rule-engine visitor, but the condition is only parsed once.
+// A Condition is immutable and safe for concurrent use.
+type Condition struct {
+	expr string
+	eval evaluator
+}
+
+// CompileCondition parse the condition, and compile it to a Condition.
+func CompileCondition(expr string) (*Condition, error) {
+
+	tree, err := parseCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	eval, err := compile(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Condition{expr: expr, eval: eval}, nil
+}
+
+// parseCondition parse the condition to a syntax tree.
+func parseCondition(expr string) (antlr.ParseTree, error) {
+
+	errs := &syntaxErrors{}
+	lexer := parser.NewEventRuleLexer(antlr.NewInputStream(expr))
+	lexer.RemoveErrorListeners()
+	lexer.AddErrorListener(errs)
+	p := parser.NewEventRuleParser(antlr.NewCommonTokenStream(lexer, antlr.TokenDefaultChannel))
+	p.RemoveErrorListeners()
+	p.AddErrorListener(errs)
+
+	tree := p.Start()
+	if len(errs.msgs) > 0 {
+		return nil, fmt.Errorf("syntax error, %s", strings.Join(errs.msgs, "; "))
+	}
+
+	return tree, nil
+}
+
+// conditionFields return the field paths which the condition reads, the selectors of arrays are kept.
+func conditionFields(expr string) ([]string, error) {
+
+	tree, err := parseCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	var walk func(t antlr.Tree)
+	walk = func(t antlr.Tree) {
+		if n, ok := t.(antlr.TerminalNode); ok {
+			if n.GetSymbol().GetTokenType() == parser.EventRuleParserVAR {
+				fields = append(fields, n.GetText())
+			}
+			return
+		}
+		for _, c := range t.GetChildren() {
+			walk(c)
+		}
+	}
+	walk(tree)
+
+	return fields, nil
+}
+
+// Evaluate return true if the fields match the condition.
+func (c *Condition) Evaluate(f Fields) (bool, error) {
+	return c.eval(f)
+}
+
+func (c *Condition) String() string {
+	return c.expr
+}
+
+type syntaxErrors struct {
+	*antlr.DefaultErrorListener
+	msgs []string
+}
+
+func (s *syntaxErrors) SyntaxError(_ antlr.Recognizer, _ interface{}, line, column int, msg string, _ antlr.RecognitionException) {
+	s.msgs = append(s.msgs, fmt.Sprintf("%d:%d %s", line, column, msg))
+}
+
+func compile(tree antlr.ParseTree) (evaluator, error) {
+
+	switch ctx := tree.(type) {
+	case *parser.StartContext:
+		return compile(ctx.Expression())
+	case *parser.ParenthesisContext:
+		return compile(ctx.Expression())
+	case *parser.NotContext:
+		e, err := compile(ctx.Expression())
+		if err != nil {
+			return nil, err
+		}
+		return func(f Fields) (bool, error) {
+			ok, err := e(f)
+			return !ok, err
+		}, nil
+	case *parser.AndOrContext:
+		return compileAndOr(ctx)
+	case *parser.CompareContext:
+		return compileCompare(ctx)
+	case *parser.BoolCompareContext:
+		return compileBoolCompare(ctx)
+	case *parser.ContainsOrNotContext:
+		return compileContainsOrNot(ctx)
+	case *parser.InOrNotContext:
+		return compileInOrNot(ctx)
+	case *parser.RegexOrNotContext:
+		return compileRegexOrNot(ctx)
+	case *parser.ExistsOrNotContext:
+		return compileExistsOrNot(ctx)
+	case *parser.VariableContext:
+		return compileVariable(ctx.VAR().GetText(), true)
+	case *parser.NotVariableContext:
+		return compileVariable(ctx.VAR().GetText(), false)
+	default:
+		return nil, fmt.Errorf("unsupported expression %s", tree.GetText())
+	}
+}
+
+func compileAndOr(ctx *parser.AndOrContext) (evaluator, error) {
+
+	left, err := compile(ctx.Expression(0))
+	if err != nil {
+		return nil, err
+	}
+	right, err := compile(ctx.Expression(1))
+	if err != nil {
+		return nil, err
+	}
+
+	switch ctx.GetOp().GetTokenType() {
+	case parser.EventRuleParserAND:
+		return func(f Fields) (bool, error) {
+			ok, err := left(f)
+			if err != nil || !ok {
+				return false, err
+			}
+			return right(f)
+		}, nil
+	case parser.EventRuleParserOR:
+		return func(f Fields) (bool, error) {
+			ok, err := left(f)
+			if err != nil || ok {
+				return ok, err
+			}
+			return right(f)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported operator %s", ctx.GetOp().GetText())
+	}
+}
+
+// compileVar compile the match of a variable. If the variable is an array
+// such as `a.b[*].c`, the match is applied to the elements of array.
+func compileVar(name string, tokenType int, match func(value interface{}) (bool, error)) (evaluator, error) {
+
+	if !strings.Contains(name, "[") {
+		return func(f Fields) (bool, error) {
+			return match(f.Get(name))
+		}, nil
+	}
+
+	a, err := compileArray(name, tokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(f Fields) (bool, error) {
+		return a.match(f, match)
+	}, nil
+}
+
+func trimQuote(s string) string {
+	return strings.Trim(s, `"`)
+}
+
+func compileCompare(ctx *parser.CompareContext) (evaluator, error) {
+
+	tokenType := ctx.GetOp().GetTokenType()
+	var match func(value interface{}) (bool, error)
+	if ctx.STRING() != nil {
+		str := trimQuote(ctx.STRING().GetText())
+		match = func(value interface{}) (bool, error) {
+			if value == nil {
+				return false, nil
+			}
+
+			s := fmt.Sprint(value)
+			switch tokenType {
+			case parser.EventRuleParserEQU:
+				return s == str, nil
+			case parser.EventRuleParserNEQ:
+				return s != str, nil
+			case parser.EventRuleParserGT:
+				return s > str, nil
+			case parser.EventRuleParserLT:
+				return s < str, nil
+			case parser.EventRuleParserGTE:
+				return s >= str, nil
+			case parser.EventRuleParserLTE:
+				return s <= str, nil
+			}
+			return false, nil
+		}
+	} else {
+		num, err := strconv.ParseFloat(ctx.NUMBER().GetText(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not number", ctx.NUMBER().GetText())
+		}
+
+		match = func(value interface{}) (bool, error) {
+			if value == nil {
+				return false, nil
+			}
+
+			v, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+			if err != nil {
+				return false, fmt.Errorf("%s is not number", value)
+			}
+
+			switch tokenType {
+			case parser.EventRuleParserEQU:
+				return v == num, nil
+			case parser.EventRuleParserNEQ:
+				return v != num, nil
+			case parser.EventRuleParserGT:
+				return v > num, nil
+			case parser.EventRuleParserLT:
+				return v < num, nil
+			case parser.EventRuleParserGTE:
+				return v >= num, nil
+			case parser.EventRuleParserLTE:
+				return v <= num, nil
+			}
+			return false, nil
+		}
+	}
+
+	return compileVar(ctx.VAR().GetText(), tokenType, match)
+}
+
+func compileBoolCompare(ctx *parser.BoolCompareContext) (evaluator, error) {
+
+	b, err := strconv.ParseBool(ctx.BOOLEAN().GetText())
+	if err != nil {
+		return nil, fmt.Errorf("%s is not bool", ctx.BOOLEAN().GetText())
+	}
+
+	tokenType := ctx.GetOp().GetTokenType()
+	return compileVar(ctx.VAR().GetText(), tokenType, func(value interface{}) (bool, error) {
+		if value == nil {
+			return false, nil
+		}
+
+		v, err := strconv.ParseBool(fmt.Sprint(value))
+		if err != nil {
+			return false, fmt.Errorf("%s is not bool", value)
+		}
+
+		if tokenType == parser.EventRuleParserNEQ {
+			return v != b, nil
+		}
+		return v == b, nil
+	})
+}
+
+func compileContainsOrNot(ctx *parser.ContainsOrNotContext) (evaluator, error) {
+
+	var str string
+	if ctx.STRING() != nil {
+		str = trimQuote(ctx.STRING().GetText())
+	} else {
+		str = ctx.NUMBER().GetText()
+	}
+
+	name := ctx.VAR().GetText()
+	// The element of array is always compared with its string format, even if it is nil.
+	isArray := strings.Contains(name, "[")
+	not := ctx.GetOp().GetTokenType() == parser.EventRuleParserNOTCONTAINS
+	return compileVar(name, ctx.GetOp().GetTokenType(), func(value interface{}) (bool, error) {
+		if value == nil && !isArray {
+			return false, nil
+		}
+
+		return strings.Contains(fmt.Sprint(value), str) != not, nil
+	})
+}
+
+func compileInOrNot(ctx *parser.InOrNotContext) (evaluator, error) {
+
+	values := make(map[string]bool)
+	for _, n := range ctx.AllNUMBER() {
+		values[n.GetText()] = true
+	}
+	for _, s := range ctx.AllSTRING() {
+		values[trimQuote(s.GetText())] = true
+	}
+
+	not := ctx.GetOp().GetTokenType() == parser.EventRuleParserNOTIN
+	return compileVar(ctx.VAR().GetText(), ctx.GetOp().GetTokenType(), func(value interface{}) (bool, error) {
+		if value == nil {
+			return false, nil
+		}
+
+		return values[fmt.Sprint(value)] != not, nil
+	})
+}
+
+func compileRegexOrNot(ctx *parser.RegexOrNotContext) (evaluator, error) {
+
+	tokenType := ctx.GetOp().GetTokenType()
+	pattern := trimQuote(ctx.STRING().GetText())
+	if tokenType == parser.EventRuleLexerLIKE || tokenType == parser.EventRuleLexerNOTLIKE {
+		pattern = strings.ReplaceAll(pattern, "?", ".")
+		pattern = likeRegex.ReplaceAllString(pattern, "(.*)")
+	}
+
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	not := tokenType == parser.EventRuleLexerNOTLIKE || tokenType == parser.EventRuleLexerNOTREGEX
+	return compileVar(ctx.VAR().GetText(), tokenType, func(value interface{}) (bool, error) {
+		if value == nil {
+			return false, nil
+		}
+
+		return regex.MatchString(fmt.Sprint(value)) != not, nil
+	})
+}
+
+func compileExistsOrNot(ctx *parser.ExistsOrNotContext) (evaluator, error) {
+
+	name := ctx.VAR().GetText()
+	not := ctx.GetOp().GetTokenType() == parser.EventRuleParserNOTEXISTS
+	if strings.Contains(name, "[") {
+		return compileVar(name, ctx.GetOp().GetTokenType(), func(value interface{}) (bool, error) {
+			return (value != nil) != not, nil
+		})
+	}
+
+	return func(f Fields) (bool, error) {
+		return f.Exists(name) != not, nil
+	}, nil
+}
+
+func compileVariable(name string, flag bool) (evaluator, error) {
+
+	variable := func(f Fields) (bool, error) {
+		value := f.Get(name)
+		if value == nil {
+			return false, nil
+		}
+
+		b, err := strconv.ParseBool(fmt.Sprint(value))
+		if err != nil {
+			return false, fmt.Errorf("%s is not bool", value)
+		}
+		return b == flag, nil
+	}
+
+	if !strings.Contains(name, "[") {
+		return variable, nil
+	}
+
+	a, err := compileArray(name, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(f Fields) (bool, error) {
+		return a.match(f, func(_ interface{}) (bool, error) {
+			return variable(f)
+		})
+	}, nil
+}
+
+// selector selects the elements of array, such as `[*]`, `[1]` and `[1:3]`.
+type selector struct {
+	all        bool
+	isRange    bool
+	start, end int
+	hasStart   bool
+	hasEnd     bool
+	index      int
+}
+
+func newSelector(s string) (*selector, error) {
+
+	s = s[strings.Index(s, "["):]
+	s = strings.TrimPrefix(s, "[")
+	s = strings.TrimSuffix(s, "]")
+
+	if s == "*" {
+		return &selector{all: true}, nil
+	}
+
+	var err error
+	sel := &selector{}
+	if strings.Contains(s, ":") {
+		sel.isRange = true
+		ns := strings.Split(s, ":")
+		if len(ns[0]) > 0 {
+			sel.hasStart = true
+			if sel.start, err = strconv.Atoi(ns[0]); err != nil {
+				return nil, err
+			}
+		}
+		if len(ns[1]) > 0 {
+			sel.hasEnd = true
+			if sel.end, err = strconv.Atoi(ns[1]); err != nil {
+				return nil, err
+			}
+		}
+		return sel, nil
+	}
+
+	if sel.index, err = strconv.Atoi(s); err != nil {
+		return nil, err
+	}
+
+	return sel, nil
+}
+
+// apply return the selected elements and the array operator.
+func (s *selector) apply(value []interface{}) ([]interface{}, int, error) {
+
+	if s.all {
+		return value, arrayOperatorAny, nil
+	}
+
+	if s.isRange {
+		start := 0
+		if s.hasStart {
+			start = s.start
+			if start < 0 {
+				start = 0
+			}
+			if start > len(value) {
+				start = len(value)
+			}
+		}
+		end := len(value)
+		if s.hasEnd {
+			end = s.end
+			if end < 0 {
+				return nil, 0, fmt.Errorf("array out of bound end %d", end)
+			}
+			if end > len(value) {
+				end = len(value)
+			}
+		}
+		if start > end {
+			return nil, 0, fmt.Errorf("wrong array range start %d, end %d", start, end)
+		}
+
+		return value[start:end], arrayOperatorAll, nil
+	}
+
+	var cv []interface{}
+	if s.index >= 0 && s.index < len(value) {
+		cv = append(cv, value[s.index])
+	}
+
+	return cv, arrayOperatorAll, nil
+}
+
+type segment struct {
+	key      string
+	selector *selector
+}
+
+// array is a compiled array variable, such as `a.b[*].c[0].d`.
+type array struct {
+	// The flattened key of the first array, `a.b`.
+	key      string
+	selector *selector
+	// The path after the first array, `c[0].d`.
+	path []segment
+}
+
+func compileArray(name string, tokenType int) (*array, error) {
+
+	if strings.HasSuffix(name, "]") &&
+		tokenType != parser.EventRuleParserNOTCONTAINS &&
+		tokenType != parser.EventRuleParserCONTAINS {
+		return nil, fmt.Errorf("array only support contains or not contains method")
+	}
+
+	ss := strings.Split(name, ".")
+	a := &array{}
+	var prefix []string
+	for i, s := range ss {
+		if !strings.Contains(s, "[") {
+			prefix = append(prefix, s)
+			continue
+		}
+
+		prefix = append(prefix, s[0:strings.Index(s, "[")])
+		sel, err := newSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		a.selector = sel
+
+		for _, s := range ss[i+1:] {
+			seg := segment{key: s}
+			if strings.Contains(s, "[") {
+				seg.key = s[0:strings.Index(s, "[")]
+				if seg.selector, err = newSelector(s); err != nil {
+					return nil, err
+				}
+			}
+			a.path = append(a.path, seg)
+		}
+		break
+	}
+	a.key = strings.Join(prefix, ".")
+
+	return a, nil
+}
+
+func (a *array) match(f Fields, match func(value interface{}) (bool, error)) (bool, error) {
+
+	v := f.Get(a.key)
+	if v == nil {
+		return false, nil
+	}
+
+	value, ok := v.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("%s is not array", a.key)
+	}
+	if len(value) == 0 {
+		return false, nil
+	}
+
+	child, op, err := a.selector.apply(value)
+	if err != nil {
+		return false, err
+	}
+	if len(child) == 0 {
+		return false, nil
+	}
+
+	return arrayMatch(op, child, a.path, match)
+}
+
+func arrayMatch(op int, values []interface{}, path []segment, match func(value interface{}) (bool, error)) (bool, error) {
+
+	var err error
+	b := false
+	result := false
+	for _, v := range values {
+		if len(path) == 0 {
+			if b, err = match(v); err != nil {
+				return false, err
+			}
+		} else {
+			mv, ok := v.(map[string]interface{})
+			if !ok {
+				return false, fmt.Errorf("the value not a map")
+			}
+
+			s := path[0]
+			subValue, ok := mv[s.key]
+			if !ok && op == arrayOperatorAll {
+				return false, nil
+			}
+
+			cop := arrayOperatorAny
+			var child []interface{}
+			if s.selector != nil {
+				arr, ok := subValue.([]interface{})
+				if !ok {
+					return false, fmt.Errorf("the value not a array")
+				}
+
+				if child, cop, err = s.selector.apply(arr); err != nil {
+					return false, err
+				}
+				if len(child) == 0 {
+					return false, nil
+				}
+			} else {
+				child = append(child, subValue)
+			}
+
+			if b, err = arrayMatch(cop, child, path[1:], match); err != nil {
+				return false, err
+			}
+		}
+
+		switch op {
+		case arrayOperatorAny:
+			if b {
+				return true, nil
+			}
+		case arrayOperatorAll:
+			if !b {
+				return false, nil
+			}
+			result = true
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	"github.com/kubesphere/event-rule-engine/visitor"
+)
+
+const testConditionEvent = `{
+	"Verb": "create",
+	"RequestURI": "/api/v1/namespaces/default/pods",
+	"User": {"username": "admin", "groups": ["system:authenticated", "system:masters"]},
+	"ObjectRef": {"Resource": "pods", "Namespace": "default", "Name": "nginx", "Subresource": ""},
+	"ResponseStatus": {"code": 201, "metadata": {}},
+	"RequestObject": {
+		"kind": "Pod",
+		"spec": {
+			"hostNetwork": true,
+			"privileged": false,
+			"containers": [
+				{"name": "nginx", "ports": [{"containerPort": 80, "hostPort": 0}, {"containerPort": 443, "hostPort": 8443}]},
+				{"name": "sidecar", "ports": []}
+			]
+		}
+	},
+	"Annotations": {"authorization.k8s.io/decision": "allow"}
+}`
+
+// TestConditionSameAsVisitor evaluate the conditions with the compiled Condition and the event-rule-engine visitor,
+// and expect the same results for the events.
+func TestConditionSameAsVisitor(t *testing.T) {
+
+	m := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(testConditionEvent), &m); err != nil {
+		t.Fatal(err)
+	}
+	events := map[string]map[string]interface{}{
+		"pod":   utils.Flatten(m),
+		"empty": {},
+	}
+
+	conditions := []string{
+		// Compare.
+		`Verb = "create"`,
+		`Verb != "create"`,
+		`Verb = "delete"`,
+		`Verb > "c"`,
+		`Verb < "c"`,
+		`ResponseStatus.code = 201`,
+		`ResponseStatus.code != 201`,
+		`ResponseStatus.code > 200`,
+		`ResponseStatus.code >= 201`,
+		`ResponseStatus.code < 201`,
+		`ResponseStatus.code <= 200`,
+		`ResponseStatus.code = "201"`,
+		`ResponseStatus.code > 200.5`,
+		`Verb > 1`,
+		`RequestObject.spec.hostNetwork = true`,
+		`RequestObject.spec.hostNetwork = false`,
+		`RequestObject.spec.hostNetwork != true`,
+		`RequestObject.spec.privileged = FALSE`,
+		// In.
+		`Verb in ("create", "update")`,
+		`Verb in ("delete")`,
+		`Verb not in ("create", "update")`,
+		`Verb not in ("delete")`,
+		`ResponseStatus.code in (200, 201)`,
+		`ResponseStatus.code not in (200, 201)`,
+		`User.groups in ("system:masters")`,
+		// Like and regex.
+		`ObjectRef.Name like "ng*"`,
+		`ObjectRef.Name like "*inx"`,
+		`ObjectRef.Name like "ng"`,
+		`ObjectRef.Name not like "ng*"`,
+		`ObjectRef.Name regex "^ng.*x$"`,
+		`ObjectRef.Name regex "^x"`,
+		`ObjectRef.Name not regex "^x"`,
+		`RequestURI regex "/namespaces/[a-z]+/pods$"`,
+		// Contains.
+		`RequestURI contains "pods"`,
+		`RequestURI not contains "pods"`,
+		`User.groups contains "system:masters"`,
+		`User.groups not contains "system:masters"`,
+		`User.groups contains "system:anonymous"`,
+		`Verb contains "rea"`,
+		// Exists and variables.
+		`ObjectRef.Subresource exists`,
+		`ObjectRef.Subresource not exists`,
+		`ObjectRef exists`,
+		`Annotations.authorization exists`,
+		`RequestObject.spec.hostNetwork`,
+		`not RequestObject.spec.hostNetwork`,
+		`!RequestObject.spec.privileged`,
+		// Arrays.
+		`RequestObject.spec.containers[*].name = "nginx"`,
+		`RequestObject.spec.containers[0].name = "nginx"`,
+		`RequestObject.spec.containers[1].name = "nginx"`,
+		`RequestObject.spec.containers[*].ports[*].hostPort > 0`,
+		`RequestObject.spec.containers[*].ports[*].hostPort > 9000`,
+		`RequestObject.spec.containers[0].ports[1].containerPort = 443`,
+		`RequestObject.spec.containers[*].name in ("sidecar")`,
+		`RequestObject.spec.containers[0:1].name = "sidecar"`,
+		// Nested and, or and not.
+		`Verb = "create" and ObjectRef.Resource = "pods"`,
+		`Verb = "create" and ObjectRef.Resource = "services"`,
+		`Verb = "delete" or ObjectRef.Resource = "pods"`,
+		`Verb = "create" and (ObjectRef.Resource = "services" or ObjectRef.Resource = "pods") and not ObjectRef.Namespace = "kube-system"`,
+		`Verb = "delete" or Verb = "create" and ObjectRef.Resource = "secrets"`,
+		`(Verb = "delete" or Verb = "create") and ObjectRef.Resource = "secrets"`,
+		`not (Verb = "create" and ObjectRef.Resource = "pods")`,
+		`Verb in ("create") and RequestObject.spec.containers[*].ports[*].hostPort > 0 or Missing exists`,
+		// Missing fields.
+		`Missing = "x"`,
+		`Missing != "x"`,
+		`Missing > 1`,
+		`Missing = true`,
+		`Missing in ("x")`,
+		`Missing not in ("x")`,
+		`Missing contains "x"`,
+		`Missing not contains "x"`,
+		`Missing like "x*"`,
+		`Missing not like "x*"`,
+		`Missing regex "x"`,
+		`Missing exists`,
+		`Missing not exists`,
+		`Missing`,
+		`not Missing`,
+		`Missing.items[*].name = "x"`,
+	}
+
+	for _, c := range conditions {
+		compiled, err := CompileCondition(c)
+		if err != nil {
+			t.Errorf("%s: compile error %s", c, err)
+			continue
+		}
+
+		for name, event := range events {
+			want, err := visitorEvaluate(event, c)
+			got, gotErr := compiled.Evaluate(MapFields(event))
+			if (err != nil) != (gotErr != nil) {
+				t.Errorf("%s with %s: got error %v, want error %v", c, name, gotErr, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("%s with %s: got %t, want %t", c, name, got, want)
+			}
+		}
+	}
+}
+
+// visitorEvaluate evaluate the condition with the visitor, its panic is returned as an error, such as
+// the one of comparing a string with a number, which the recover of visitor could not handle.
+func visitorEvaluate(m map[string]interface{}, c string) (ok bool, err error) {
+
+	defer func() {
+		if i := recover(); i != nil {
+			ok, err = false, fmt.Errorf("%v", i)
+		}
+	}()
+
+	err, ok = visitor.EventRuleEvaluate(m, c)
+	return ok, err
+}
+
+// TestConditionSyntaxErrors expect the malformed conditions to be rejected. Some of them are accepted by the
+// event-rule-engine visitor, which recovers from the syntax errors and evaluates the rest of the condition.
+func TestConditionSyntaxErrors(t *testing.T) {
+
+	tests := []struct {
+		condition string
+		// Whether the visitor accepts the condition.
+		visitorAccepts bool
+	}{
+		{condition: ``},
+		{condition: `and`},
+		{condition: `Verb =`},
+		{condition: `Verb = create`},
+		{condition: `Verb == "create"`},
+		{condition: `(Verb = "create"`, visitorAccepts: true},
+		{condition: `Verb = "create")`, visitorAccepts: true},
+		{condition: `Verb = "create" and`},
+		{condition: `Verb = "create" Verb = "delete"`, visitorAccepts: true},
+		{condition: `Verb in "create"`, visitorAccepts: true},
+		{condition: `Verb like 1`, visitorAccepts: true},
+	}
+
+	for _, tt := range tests {
+		if _, err := CompileCondition(tt.condition); err == nil {
+			t.Errorf("%q: expect a syntax error", tt.condition)
+		}
+
+		_, err := visitor.CheckRule(tt.condition)
+		if got := err == nil; got != tt.visitorAccepts {
+			t.Errorf("%q: the visitor accepts it %t, want %t", tt.condition, got, tt.visitorAccepts)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+)
+
+// Evaluation is the result of a rule evaluated with an event.
+type Evaluation struct {
+	Rule *Rule
+	// Whether the condition matches the event, or the sequence is completed by the event.
+	Matched bool
+	// Whether the rule raises an alert, it is selected by the match mode and its threshold is reached.
+	Fired bool
+	// The alert raised by the rule, nil if the rule does not fire.
+	Alert *WhizardEvent
+	// The error of evaluating.
+	Err error
+}
+
+// alertTarget is implemented by the events which carry the alert of a rule.
+type alertTarget interface {
+	SetAlertRuleName(n string)
+	SetAlertSeverity(s string)
+	SetAlertRuleGroup(g string)
+	SetAlertReceivers(rs []string)
+	SetAlertDedup(d *v1alpha1.Dedup)
+}
+
+// EvaluateEvent evaluate the event at the time with the rules of its type in byType, which are selected
+// by the match mode, and advance the sequence rules. The rules which can not be selected are not evaluated,
+// see MatchRules. It return an alert for every rule fired, in the order of the rules and then the sequences,
+// and report is called with every rule evaluated if it is not nil.
+func EvaluateEvent(byType map[string][]*Rule, sequences []*Rule, e *WhizardEvent, now time.Time, report func(ev *Evaluation)) []*WhizardEvent {
+
+	f := e.Fields()
+	rs := byType[typeOfKind(e.Kind)]
+
+	evs := make(map[*Rule]*Evaluation)
+	fs := make(map[*Rule]Fields)
+	selected := MatchRules(rs, func(r *Rule) bool {
+		ev := &Evaluation{Rule: r}
+		evs[r] = ev
+		ev.Matched, ev.Err = r.Evaluate(f)
+		if !ev.Matched {
+			return false
+		}
+
+		rf, ok := r.Observe(f, now)
+		if ok {
+			fs[r] = rf
+		}
+		return ok
+	})
+
+	var alerts []*WhizardEvent
+	for _, r := range selected {
+		ev := evs[r]
+		ev.Fired, ev.Alert = true, r.newAlert(e, fs[r])
+		alerts = append(alerts, ev.Alert)
+	}
+	if report != nil {
+		for _, r := range rs {
+			if ev, ok := evs[r]; ok {
+				report(ev)
+			}
+		}
+	}
+
+	for _, r := range sequences {
+		ev := &Evaluation{Rule: r}
+		sf, ok, err := r.Advance(e, f, now)
+		ev.Matched, ev.Fired, ev.Err = ok, ok, err
+		if ok {
+			ev.Alert = r.newAlert(e, sf)
+			alerts = append(alerts, ev.Alert)
+		}
+		if report != nil {
+			report(ev)
+		}
+	}
+
+	return alerts
+}
+
+// AlertMessage return the alert message and annotations of the rule for the event, the fields are
+// returned by the evaluation of rule, which include the params of threshold and sequence.
+func (r *Rule) AlertMessage(e *WhizardEvent, f Fields) (string, map[string]string) {
+
+	if r.IsSequence() {
+		return r.GetSequenceAlertMessage(f)
+	}
+
+	switch e.Kind {
+	case constant.Auditing:
+		return r.GetAuditingAlertMessage(e.Auditing, f)
+	case constant.Event:
+		return r.GetEventAlertMessage(e.Event, f)
+	case constant.Logging:
+		return r.GetLoggingAlertMessage(e.Logging, f)
+	default:
+		return "", r.copyAnnotations()
+	}
+}
+
+// newAlert return a copy of the event with the alert of rule.
+func (r *Rule) newAlert(e *WhizardEvent, f Fields) *WhizardEvent {
+
+	msg, annotations := r.AlertMessage(e, f)
+
+	alert := &WhizardEvent{Kind: e.Kind}
+	var target alertTarget
+	switch e.Kind {
+	case constant.Auditing:
+		a := *e.Auditing
+		a.Message, a.Annotations = msg, annotations
+		alert.Auditing, target = &a, &a
+	case constant.Event:
+		ev := *e.Event
+		ev.Message, ev.Annotations = msg, annotations
+		alert.Event, target = &ev, &ev
+	case constant.Logging:
+		l := *e.Logging
+		l.Message, l.Annotations = msg, annotations
+		alert.Logging, target = &l, &l
+	default:
+		return alert
+	}
+
+	target.SetAlertRuleName(r.Name)
+	target.SetAlertSeverity(r.Alerts.Severity)
+	target.SetAlertRuleGroup(r.Group)
+	target.SetAlertReceivers(r.GetReceivers())
+	target.SetAlertDedup(r.Dedup)
+	return alert
+}
+
+// Message return the alert message of the event.
+func (e *WhizardEvent) Message() string {
+	switch e.Kind {
+	case constant.Auditing:
+		return e.Auditing.Message
+	case constant.Event:
+		return e.Event.Message
+	case constant.Logging:
+		return e.Logging.Message
+	default:
+		return ""
+	}
+}
+
+// Annotations return the alert annotations of the event.
+func (e *WhizardEvent) Annotations() map[string]string {
+	switch e.Kind {
+	case constant.Auditing:
+		return e.Auditing.Annotations
+	case constant.Event:
+		return e.Event.Annotations
+	case constant.Logging:
+		return e.Logging.Annotations
+	default:
+		return nil
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
 	"whizard-telemetry-ruler/pkg/utils"
 )
 
@@ -33,6 +34,14 @@ type Event struct {
 	Annotations map[string]string
 	// name of rule which triggered alert.
 	alertRuleName string
+	// severity of rule which triggered alert.
+	alertSeverity string
+	// group of rule which triggered alert.
+	alertRuleGroup string
+	// the receivers which the alert is routed to, empty means all receivers.
+	alertReceivers []string
+	// the dedup of rule which triggered alert, nil means the dedup of receivers.
+	alertDedup *v1alpha1.Dedup
 }
 
 func NewEvents(data []byte) ([]*Event, error) {
@@ -45,7 +54,16 @@ func NewEvents(data []byte) ([]*Event, error) {
 		return nil, err
 	}
 
-	return eventList, nil
+	// The items without the kubernetes event, such as null or {}, are skipped.
+	var es []*Event
+	for _, e := range eventList {
+		if e == nil || e.Event == nil {
+			continue
+		}
+		es = append(es, e)
+	}
+
+	return es, nil
 }
 
 func (e *Event) ToString() string {
@@ -59,6 +77,11 @@ func (e *Event) ToString() string {
 	return s
 }
 
+// Fields return the fields of the kubernetes event which rules match.
+func (e *Event) Fields() Fields {
+	return utils.NewFieldAccessor(e.Event)
+}
+
 func (e *Event) GetAlertRuleName() string {
 	return e.alertRuleName
 }
@@ -66,3 +89,35 @@ func (e *Event) GetAlertRuleName() string {
 func (e *Event) SetAlertRuleName(n string) {
 	e.alertRuleName = n
 }
+
+func (e *Event) GetAlertSeverity() string {
+	return e.alertSeverity
+}
+
+func (e *Event) SetAlertSeverity(s string) {
+	e.alertSeverity = s
+}
+
+func (e *Event) GetAlertRuleGroup() string {
+	return e.alertRuleGroup
+}
+
+func (e *Event) SetAlertRuleGroup(g string) {
+	e.alertRuleGroup = g
+}
+
+func (e *Event) GetAlertReceivers() []string {
+	return e.alertReceivers
+}
+
+func (e *Event) SetAlertReceivers(rs []string) {
+	e.alertReceivers = rs
+}
+
+func (e *Event) GetAlertDedup() *v1alpha1.Dedup {
+	return e.alertDedup
+}
+
+func (e *Event) SetAlertDedup(d *v1alpha1.Dedup) {
+	e.alertDedup = d
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"fmt"
+	"strings"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	"github.com/kubesphere/event-rule-engine/visitor"
+)
+
+// The checks of Lint.
+const (
+	CheckUnresolvedReference = "unresolved-reference"
+	CheckUnusedDefinition    = "unused-definition"
+	CheckDuplicateName       = "duplicate-name"
+	CheckInvalidCondition    = "invalid-condition"
+	CheckDisabledReferenced  = "disabled-referenced"
+	CheckUnknownSeverity     = "unknown-severity"
+	CheckUnknownPlaceholder  = "unknown-placeholder"
+	CheckUnknownField        = "unknown-field"
+)
+
+// The levels of problems.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+)
+
+// LintCheck describes a check of Lint.
+type LintCheck struct {
+	ID          string `json:"id"`
+	Level       string `json:"level"`
+	Description string `json:"description"`
+}
+
+// LintChecks are the checks of Lint.
+var LintChecks = []LintCheck{
+	{CheckUnresolvedReference, LevelError, "A ${} reference of a condition is not a macro, list or alias which the rule can use."},
+	{CheckUnusedDefinition, LevelWarning, "A macro, list or alias is not used by any rule."},
+	{CheckDuplicateName, LevelError, "Several rules of a group have the same name."},
+	{CheckInvalidCondition, LevelError, "A condition is not grammatical after the references are expanded."},
+	{CheckDisabledReferenced, LevelWarning, "A disabled rule, macro, list or alias is referenced by a condition."},
+	{CheckUnknownSeverity, LevelError, "The severity is not one of INFO, WARNING, ERROR or CRITICAL."},
+	{CheckUnknownPlaceholder, LevelError, "A message placeholder is neither an alias, a field of event nor a param of the rule."},
+	{CheckUnknownField, LevelWarning, "A field path is not in the schema of auditing or events."},
+}
+
+// Problem is a problem found by Lint.
+type Problem struct {
+	// The name of ClusterRuleGroup, or namespace/name of RuleGroup.
+	Group   string `json:"group"`
+	Rule    string `json:"rule,omitempty"`
+	Check   string `json:"check"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+type linter struct {
+	rules    map[string]Rule
+	used     map[string]bool
+	problems []Problem
+}
+
+// Lint analyse the rules of the groups statically, and return the problems in the order of the groups and rules.
+func Lint(groups []v1alpha1.ClusterRuleGroup, namespaced []v1alpha1.RuleGroup) []Problem {
+
+	sources := ruleSources(groups, namespaced)
+	l := &linter{rules: make(map[string]Rule), used: make(map[string]bool)}
+	for _, item := range sources {
+		for _, pr := range item.spec.Rules {
+			r := Rule{Rule: pr, Group: item.name, Namespace: item.namespace, whizardEventType: item.spec.Type}
+			l.rules[fmt.Sprintf("%s.%s", r.Group, r.Name)] = r
+		}
+	}
+
+	for _, item := range sources {
+		names := make(map[string]bool)
+		for _, pr := range item.spec.Rules {
+			if names[pr.Name] {
+				l.report(item.name, pr.Name, CheckDuplicateName, "the name is used by several rules of the group")
+			}
+			names[pr.Name] = true
+
+			r := Rule{Rule: pr, Group: item.name, Namespace: item.namespace, whizardEventType: item.spec.Type}
+			l.lintRule(&r)
+		}
+	}
+
+	// The definitions are reported after all rules are linted, they can be used by the rules of other groups.
+	for _, item := range sources {
+		for _, pr := range item.spec.Rules {
+			switch pr.Expr.Kind {
+			case KindMacro, KindList, KindAlias:
+				if !l.used[fmt.Sprintf("%s.%s", item.name, pr.Name)] {
+					l.report(item.name, pr.Name, CheckUnusedDefinition, fmt.Sprintf("the %s is not used by any rule", pr.Expr.Kind))
+				}
+			}
+		}
+	}
+
+	return l.problems
+}
+
+func (l *linter) report(group, rule, check, msg string) {
+
+	level := LevelError
+	for _, c := range LintChecks {
+		if c.ID == check {
+			level = c.Level
+		}
+	}
+
+	l.problems = append(l.problems, Problem{Group: group, Rule: rule, Check: check, Level: level, Message: msg})
+}
+
+func (l *linter) lintRule(r *Rule) {
+
+	switch r.Expr.Kind {
+	case KindRule:
+		if l.lintReferences(r, "condition", r.Expr.Condition) {
+			l.lintCondition(r, "condition", r.Expr.Condition, r.whizardEventType)
+		}
+		if r.Threshold != nil {
+			for _, path := range r.Threshold.GroupBy {
+				l.lintField(r, "threshold.groupBy", path, r.whizardEventType)
+			}
+		}
+	case KindSequence:
+		if r.Sequence != nil {
+			for i, s := range r.Sequence.Steps {
+				eventType := s.Type
+				if len(eventType) == 0 {
+					eventType = r.whizardEventType
+				}
+				where := fmt.Sprintf("step %d", i+1)
+				if l.lintReferences(r, where, s.Condition) {
+					l.lintCondition(r, where, s.Condition, eventType)
+				}
+				joinBy := s.JoinBy
+				if len(joinBy) == 0 {
+					joinBy = r.Sequence.JoinBy
+				}
+				if len(joinBy) > 0 {
+					l.lintField(r, where+" joinBy", joinBy, eventType)
+				}
+			}
+		}
+	case KindAlias:
+		l.lintField(r, "alias", r.Expr.Alias, r.whizardEventType)
+		return
+	default:
+		return
+	}
+
+	if len(r.Alerts.Severity) > 0 && !utils.IsExist(severities, r.Alerts.Severity) {
+		l.report(r.Group, r.Name, CheckUnknownSeverity, fmt.Sprintf("unknown severity %q, must be one of %s", r.Alerts.Severity, strings.Join(severities, ", ")))
+	}
+
+	for _, err := range r.validatePlaceholders(l.rules) {
+		l.report(r.Group, r.Name, CheckUnknownPlaceholder, err.Error())
+	}
+	// The aliases in message are used.
+	for _, s := range placeholderRegex.FindAllStringSubmatch(r.Alerts.Message, -1) {
+		if r.isAlias(s[1], l.rules) {
+			if mr, ok := r.lookup(s[1], l.rules); ok {
+				l.used[fmt.Sprintf("%s.%s", mr.Group, mr.Name)] = true
+			}
+		}
+	}
+}
+
+// lintReferences check the ${} references of the condition, and return true if all of them are resolved.
+func (l *linter) lintReferences(r *Rule, where, c string) bool {
+
+	resolved := true
+	for _, s := range placeholderRegex.FindAllStringSubmatch(c, -1) {
+		mr, ok := r.lookup(s[1], l.rules)
+		if !ok {
+			l.report(r.Group, r.Name, CheckUnresolvedReference, fmt.Sprintf("%s references %s, which is not found", where, s[0]))
+			resolved = false
+			continue
+		}
+
+		l.used[fmt.Sprintf("%s.%s", mr.Group, mr.Name)] = true
+		switch mr.Expr.Kind {
+		case KindMacro, KindList, KindAlias:
+			if mr.disabled() {
+				l.report(r.Group, r.Name, CheckDisabledReferenced, fmt.Sprintf("%s references %s, which is a disabled %s", where, s[0], mr.Expr.Kind))
+				l.report(r.Group, r.Name, CheckUnresolvedReference, fmt.Sprintf("%s references %s, which is disabled and not expanded", where, s[0]))
+				resolved = false
+			}
+		case KindRule, KindSequence:
+			if !mr.enabled() {
+				l.report(r.Group, r.Name, CheckDisabledReferenced, fmt.Sprintf("%s references %s, which is a disabled rule", where, s[0]))
+			}
+			l.report(r.Group, r.Name, CheckUnresolvedReference, fmt.Sprintf("%s references %s, which is a %s, not a macro, list or alias", where, s[0], mr.Expr.Kind))
+			resolved = false
+		default:
+			l.report(r.Group, r.Name, CheckUnresolvedReference, fmt.Sprintf("%s references %s, which has unknown kind %q", where, s[0], mr.Expr.Kind))
+			resolved = false
+		}
+	}
+
+	return resolved
+}
+
+// lintCondition check the expanded condition is grammatical, and the fields it reads are in the schema of event type.
+func (l *linter) lintCondition(r *Rule, where, c, eventType string) {
+
+	expanded, err := r.expandCondition(c, l.rules)
+	if err != nil {
+		l.report(r.Group, r.Name, CheckUnresolvedReference, fmt.Sprintf("%s, %s", where, err))
+		return
+	}
+
+	if _, err := visitor.CheckRule(expanded); err != nil {
+		l.report(r.Group, r.Name, CheckInvalidCondition, fmt.Sprintf("%s (%s) is not grammatical, %s", where, expanded, err))
+		return
+	}
+	// The ruler compiles the condition, which is stricter than the visitor, such as the operators of arrays.
+	if _, err := CompileCondition(expanded); err != nil {
+		l.report(r.Group, r.Name, CheckInvalidCondition, fmt.Sprintf("%s (%s) could not be compiled, %s", where, expanded, err))
+		return
+	}
+	fields, err := conditionFields(expanded)
+	if err != nil {
+		return
+	}
+	for _, f := range fields {
+		l.lintField(r, where, f, eventType)
+	}
+}
+
+func (l *linter) lintField(r *Rule, where, path, eventType string) {
+
+	t := eventTypes[eventType]
+	if t == nil || utils.FieldPathValid(t, path) {
+		return
+	}
+
+	l.report(r.Group, r.Name, CheckUnknownField, fmt.Sprintf("%s reads %s, which is not a field of %s", where, path, eventType))
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+
+	"k8s.io/utils/pointer"
+)
+
+func TestLint(t *testing.T) {
+
+	macro := func(name, macro string) v1alpha1.Rule {
+		return v1alpha1.Rule{Name: name, Expr: v1alpha1.Expr{Kind: KindMacro, Macro: macro}}
+	}
+	disabled := func(r v1alpha1.Rule) v1alpha1.Rule {
+		r.Enable = pointer.Bool(false)
+		return r
+	}
+	alerting := func(r v1alpha1.Rule, severity, message string) v1alpha1.Rule {
+		r.Alerts = v1alpha1.Alerts{Severity: severity, Message: message}
+		return r
+	}
+
+	tests := []struct {
+		name  string
+		rules []v1alpha1.Rule
+		// The problems as rule:check.
+		want []string
+	}{
+		{
+			name:  "no problem",
+			rules: []v1alpha1.Rule{macro("deleting", `Verb = "delete"`), newConditionRule("r", "${deleting}")},
+		},
+		{
+			name:  CheckUnresolvedReference,
+			rules: []v1alpha1.Rule{newConditionRule("r", "${missing}")},
+			want:  []string{"r:" + CheckUnresolvedReference},
+		},
+		{
+			name:  CheckUnusedDefinition,
+			rules: []v1alpha1.Rule{macro("deleting", `Verb = "delete"`), newConditionRule("r", `Verb = "get"`)},
+			want:  []string{"deleting:" + CheckUnusedDefinition},
+		},
+		{
+			name:  CheckDuplicateName,
+			rules: []v1alpha1.Rule{newConditionRule("r", `Verb = "get"`), newConditionRule("r", `Verb = "delete"`)},
+			want:  []string{"r:" + CheckDuplicateName},
+		},
+		{
+			name:  CheckInvalidCondition,
+			rules: []v1alpha1.Rule{newConditionRule("r", `Verb = `)},
+			want:  []string{"r:" + CheckInvalidCondition},
+		},
+		{
+			name:  CheckDisabledReferenced + " rule",
+			rules: []v1alpha1.Rule{disabled(newConditionRule("get", `Verb = "get"`)), newConditionRule("r", "${get}")},
+			want:  []string{"r:" + CheckDisabledReferenced, "r:" + CheckUnresolvedReference},
+		},
+		{
+			name:  CheckDisabledReferenced + " macro",
+			rules: []v1alpha1.Rule{disabled(macro("deleting", `Verb = "delete"`)), newConditionRule("r", "${deleting}")},
+			want:  []string{"r:" + CheckDisabledReferenced, "r:" + CheckUnresolvedReference},
+		},
+		{
+			name: CheckDisabledReferenced + " list",
+			rules: []v1alpha1.Rule{
+				disabled(v1alpha1.Rule{Name: "verbs", Expr: v1alpha1.Expr{Kind: KindList, List: []string{"delete"}}}),
+				newConditionRule("r", "Verb in ${verbs}"),
+			},
+			want: []string{"r:" + CheckDisabledReferenced, "r:" + CheckUnresolvedReference},
+		},
+		{
+			name: CheckDisabledReferenced + " alias",
+			rules: []v1alpha1.Rule{
+				disabled(v1alpha1.Rule{Name: "verb", Expr: v1alpha1.Expr{Kind: KindAlias, Alias: "Verb"}}),
+				newConditionRule("r", `${verb} = "delete"`),
+			},
+			want: []string{"r:" + CheckDisabledReferenced, "r:" + CheckUnresolvedReference},
+		},
+		{
+			name:  CheckUnknownSeverity,
+			rules: []v1alpha1.Rule{alerting(newConditionRule("r", `Verb = "get"`), "FATAL", "get")},
+			want:  []string{"r:" + CheckUnknownSeverity},
+		},
+		{
+			name:  CheckUnknownPlaceholder,
+			rules: []v1alpha1.Rule{alerting(newConditionRule("r", `Verb = "get"`), "INFO", "${missing}")},
+			want:  []string{"r:" + CheckUnknownPlaceholder},
+		},
+		{
+			name:  CheckUnknownField,
+			rules: []v1alpha1.Rule{newConditionRule("r", `Missing = "get"`)},
+			want:  []string{"r:" + CheckUnknownField},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := Lint([]v1alpha1.ClusterRuleGroup{newClusterRuleGroup("g", AuditingType, tt.rules...)}, nil)
+
+			var got []string
+			for _, p := range problems {
+				if p.Group != "g" {
+					t.Errorf("group: got %q, want g", p.Group)
+				}
+				got = append(got, fmt.Sprintf("%s:%s", p.Rule, p.Check))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v, problems: %+v", got, tt.want, problems)
+			}
+		})
+	}
+}
+
+func TestDisabledDefinition(t *testing.T) {
+
+	rules, results := buildRules([]v1alpha1.ClusterRuleGroup{newClusterRuleGroup("g", AuditingType,
+		v1alpha1.Rule{Name: "deleting", Enable: pointer.Bool(false), Expr: v1alpha1.Expr{Kind: KindMacro, Macro: `Verb = "delete"`}},
+		newConditionRule("r", "${deleting}"),
+	)}, nil)
+
+	if len(RulesByType(rules)[AuditingType]) != 0 {
+		t.Error("the rule referencing a disabled macro should not be loaded")
+	}
+	for _, r := range results["g"].Rules {
+		if r.Name != "r" {
+			continue
+		}
+		if r.Valid {
+			t.Error("the rule referencing a disabled macro should be invalid")
+		}
+		return
+	}
+	t.Errorf("no result of rule r, results = %+v", results["g"])
+}
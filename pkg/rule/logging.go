@@ -0,0 +1,200 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// The key of log content in the record sent by Fluent Bit.
+	LogKey = "log"
+	// The key of kubernetes metadata added by the Fluent Bit kubernetes filter.
+	KubernetesKey = "kubernetes"
+)
+
+type Logging struct {
+	// The log record, usually generated by Fluent Bit.
+	Log map[string]interface{}
+	// The message send to user,formatted by th rule output.
+	Message string
+	// The workspace which this log happened.
+	Workspace string
+	//custom message
+	Annotations map[string]string
+	// name of rule which triggered alert.
+	alertRuleName string
+	// severity of rule which triggered alert.
+	alertSeverity string
+	// group of rule which triggered alert.
+	alertRuleGroup string
+	// the receivers which the alert is routed to, empty means all receivers.
+	alertReceivers []string
+	// the dedup of rule which triggered alert, nil means the dedup of receivers.
+	alertDedup *v1alpha1.Dedup
+}
+
+// NewLogging parse the body sent by the Fluent Bit http output, both the json
+// and json_lines format are supported.
+func NewLogging(data []byte) ([]*Logging, error) {
+
+	var records []map[string]interface{}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &records); err != nil {
+			glog.Errorf("unmarshal failed with:%v,body is: %s", err, string(data))
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var record map[string]interface{}
+			if err := json.Unmarshal(line, &record); err != nil {
+				glog.Errorf("unmarshal failed with:%v,body is: %s", err, string(line))
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var ls []*Logging
+	for _, record := range records {
+		if record == nil {
+			continue
+		}
+		ls = append(ls, &Logging{Log: record})
+	}
+
+	return ls, nil
+}
+
+// Content return the log content of the record.
+func (l *Logging) Content() string {
+	v, ok := l.Log[LogKey]
+	if !ok || v == nil {
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+// Namespace return the namespace of the container which output this log.
+func (l *Logging) Namespace() string {
+	return l.kubernetes("namespace_name")
+}
+
+// Pod return the pod name of the container which output this log.
+func (l *Logging) Pod() string {
+	return l.kubernetes("pod_name")
+}
+
+// Container return the name of the container which output this log.
+func (l *Logging) Container() string {
+	return l.kubernetes("container_name")
+}
+
+// Node return the node which the container running on.
+func (l *Logging) Node() string {
+	return l.kubernetes("host")
+}
+
+func (l *Logging) kubernetes(key string) string {
+	k8s, ok := l.Log[KubernetesKey].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	v, ok := k8s[key]
+	if !ok || v == nil {
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+func (l *Logging) ToString() string {
+
+	s, err := utils.ToJsonString(l)
+	if err != nil {
+		glog.Error(err)
+		return ""
+	}
+
+	return s
+}
+
+// Fields return the fields of the log which rules match.
+func (l *Logging) Fields() Fields {
+	return utils.NewFieldAccessor(l.Log)
+}
+
+func (l *Logging) GetAlertRuleName() string {
+	return l.alertRuleName
+}
+
+func (l *Logging) SetAlertRuleName(n string) {
+	l.alertRuleName = n
+}
+
+func (l *Logging) GetAlertSeverity() string {
+	return l.alertSeverity
+}
+
+func (l *Logging) SetAlertSeverity(s string) {
+	l.alertSeverity = s
+}
+
+func (l *Logging) GetAlertRuleGroup() string {
+	return l.alertRuleGroup
+}
+
+func (l *Logging) SetAlertRuleGroup(g string) {
+	l.alertRuleGroup = g
+}
+
+func (l *Logging) GetAlertReceivers() []string {
+	return l.alertReceivers
+}
+
+func (l *Logging) SetAlertReceivers(rs []string) {
+	l.alertReceivers = rs
+}
+
+func (l *Logging) GetAlertDedup() *v1alpha1.Dedup {
+	return l.alertDedup
+}
+
+func (l *Logging) SetAlertDedup(d *v1alpha1.Dedup) {
+	l.alertDedup = d
+}
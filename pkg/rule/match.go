@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"flag"
+	"fmt"
+)
+
+// The modes to select the rules which raise alerts when several rules match an event.
+const (
+	// MatchModeFirst raises the alert of the first matched rule.
+	MatchModeFirst = "first-match"
+	// MatchModeHighestSeverity raises the alert of the matched rule with the highest severity.
+	MatchModeHighestSeverity = "highest-severity"
+	// MatchModeAll raises an alert for every matched rule.
+	MatchModeAll = "all-matches"
+)
+
+var matchMode string
+
+func init() {
+	flag.StringVar(&matchMode, "match-mode", MatchModeHighestSeverity, "The mode to select the alerts when several rules match an event, "+
+		"first-match, highest-severity or all-matches, the rule groups with matchMode are selected by their own mode")
+}
+
+// ValidateMatchMode return error if the match mode is unknown, empty is valid.
+func ValidateMatchMode(mode string) error {
+	switch mode {
+	case "", MatchModeFirst, MatchModeHighestSeverity, MatchModeAll:
+		return nil
+	default:
+		return fmt.Errorf("unknown match mode %s, it should be %s, %s or %s", mode, MatchModeFirst, MatchModeHighestSeverity, MatchModeAll)
+	}
+}
+
+// GlobalMatchMode return the match mode of the rule groups without matchMode.
+func GlobalMatchMode() string {
+	return matchMode
+}
+
+// GetMatchMode return the match mode of the group of rule, empty if the group uses the global match mode.
+func (r *Rule) GetMatchMode() string {
+	return r.matchMode
+}
+
+// MatchRules return the rules which raise alerts for an event, evaluate is called to decide
+// whether a rule matches, the rules that can not be selected are not evaluated, except the
+// threshold rules which count every matched event. A threshold rule which fires is always
+// selected, since the window of its group is reset and the alert could not be raised later.
+//
+// The rules of a group with matchMode are selected within the group by its mode, the rules of
+// the other groups are selected together by the global match mode. The rules must be in the
+// order of RulesByType, and when several matched rules have the same severity, the first one
+// wins, so the tie-breaking is the same for all types of events.
+func MatchRules(rs []*Rule, evaluate func(r *Rule) bool) []*Rule {
+
+	type scope struct {
+		mode    string
+		matched []*Rule
+	}
+
+	// The key is the group name for the groups with matchMode and the RuleGroups, and empty for the others.
+	// The RuleGroup is always selected by itself, so that its rules could not suppress the other rules.
+	scopes := make(map[string]*scope)
+	selected := make(map[*Rule]bool)
+	for _, r := range rs {
+		key, mode := "", matchMode
+		if len(r.matchMode) > 0 {
+			key, mode = r.Group, r.matchMode
+		} else if len(r.Namespace) > 0 {
+			key = r.Group
+		}
+
+		s, ok := scopes[key]
+		if !ok {
+			s = &scope{mode: mode}
+			scopes[key] = s
+		}
+
+		skip := false
+		switch s.mode {
+		case MatchModeAll:
+		case MatchModeFirst:
+			skip = len(s.matched) > 0
+		default:
+			skip = len(s.matched) > 0 && !r.SeverityHigherThan(s.matched[0].Alerts.Severity)
+		}
+
+		if skip {
+			// The threshold rule counts the matched events even if it can not be selected,
+			// and its alert is kept if it fires.
+			if r.HasThreshold() && evaluate(r) {
+				selected[r] = true
+			}
+			continue
+		}
+
+		if !evaluate(r) {
+			continue
+		}
+
+		if s.mode != MatchModeAll {
+			for _, m := range s.matched {
+				// The threshold rule which fired is not replaced.
+				if !m.HasThreshold() {
+					delete(selected, m)
+				}
+			}
+			s.matched = s.matched[:0]
+		}
+		s.matched = append(s.matched, r)
+		selected[r] = true
+	}
+
+	var matched []*Rule
+	for _, r := range rs {
+		if selected[r] {
+			matched = append(matched, r)
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestMatchRulesWithThreshold(t *testing.T) {
+
+	threshold := &v1alpha1.Threshold{Count: 2, Window: metav1.Duration{Duration: time.Minute}}
+	newRule := func(name, severity string, threshold *v1alpha1.Threshold) v1alpha1.Rule {
+		return v1alpha1.Rule{
+			Name:      name,
+			Enable:    pointer.Bool(true),
+			Expr:      v1alpha1.Expr{Kind: KindRule, Condition: `Verb = "delete"`},
+			Alerts:    v1alpha1.Alerts{Severity: severity},
+			Threshold: threshold,
+		}
+	}
+
+	tests := []struct {
+		mode string
+		// The rules selected for every event.
+		want [][]string
+	}{
+		{
+			mode: MatchModeAll,
+			want: [][]string{
+				{"b-info", "c-critical"},
+				{"a-threshold", "b-info", "c-critical", "d-threshold"},
+				{"b-info", "c-critical"},
+			},
+		},
+		{
+			// The threshold rules after the first matched rule are counted, and kept when they fire.
+			mode: MatchModeFirst,
+			want: [][]string{
+				{"b-info"},
+				{"a-threshold", "d-threshold"},
+				{"b-info"},
+			},
+		},
+		{
+			// The threshold rule which fired is not replaced by the rule with a higher severity.
+			mode: MatchModeHighestSeverity,
+			want: [][]string{
+				{"c-critical"},
+				{"a-threshold", "c-critical", "d-threshold"},
+				{"c-critical"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			group := v1alpha1.ClusterRuleGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: v1alpha1.ClusterRuleGroupRuleSpec{
+					Type:      AuditingType,
+					MatchMode: tt.mode,
+					Rules: []v1alpha1.Rule{
+						newRule("a-threshold", constant.Warning, threshold),
+						newRule("b-info", constant.Info, nil),
+						newRule("c-critical", constant.CRITICAL, nil),
+						newRule("d-threshold", constant.CRITICAL, threshold),
+					},
+				},
+			}
+			rs := RulesByType(BuildRules([]v1alpha1.ClusterRuleGroup{group}, nil))[AuditingType]
+
+			now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+			for i, want := range tt.want {
+				at := now.Add(time.Duration(i) * time.Second)
+				fields := MapFields{"Verb": "delete"}
+				var got []string
+				for _, r := range MatchRules(rs, func(r *Rule) bool {
+					ok, err := r.Evaluate(fields)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !ok {
+						return false
+					}
+					_, fired := r.Observe(fields, at)
+					return fired
+				}) {
+					got = append(got, r.Name)
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("event %d: got %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchRulesTieBreak(t *testing.T) {
+
+	types := []struct {
+		eventType, condition, body string
+	}{
+		{AuditingType, `Verb = "delete"`, `[{"Verb":"delete"}]`},
+		{EventsType, `reason = "BackOff"`, `[{"Event":{"reason":"BackOff"}}]`},
+		{LoggingType, `log contains "panic"`, `[{"log":"panic"}]`},
+	}
+
+	tests := []struct {
+		name string
+		mode string
+		// The severities of the rules a, b, c and d.
+		severities []string
+		// The rules fired, the first one is the winner.
+		want []string
+	}{
+		{"first-match", MatchModeFirst, []string{constant.Warning, constant.CRITICAL, constant.CRITICAL, constant.Warning}, []string{"a"}},
+		{"highest-severity", MatchModeHighestSeverity, []string{constant.Warning, constant.CRITICAL, constant.CRITICAL, constant.Warning}, []string{"b"}},
+		{"all-matches", MatchModeAll, []string{constant.Warning, constant.CRITICAL, constant.CRITICAL, constant.Warning}, []string{"a", "b", "c", "d"}},
+		{"first-match of equal severities", MatchModeFirst, []string{constant.Info, constant.Info, constant.Info, constant.Info}, []string{"a"}},
+		{"highest-severity of equal severities", MatchModeHighestSeverity, []string{constant.Info, constant.Info, constant.Info, constant.Info}, []string{"a"}},
+		{"all-matches of equal severities", MatchModeAll, []string{constant.Info, constant.Info, constant.Info, constant.Info}, []string{"a", "b", "c", "d"}},
+		{"global match mode", "", []string{constant.Warning, constant.CRITICAL, constant.CRITICAL, constant.Warning}, []string{"b"}},
+	}
+
+	for _, typ := range types {
+		for _, tt := range tests {
+			t.Run(typ.eventType+"/"+tt.name, func(t *testing.T) {
+				// The rules are declared in the reverse order, the ties are broken by the order of names.
+				var rules []v1alpha1.Rule
+				for i := len(tt.severities) - 1; i >= 0; i-- {
+					r := newConditionRule(string(rune('a'+i)), typ.condition)
+					r.Alerts.Severity = tt.severities[i]
+					rules = append(rules, r)
+				}
+				group := newClusterRuleGroup("test", typ.eventType, rules...)
+				group.Spec.MatchMode = tt.mode
+
+				es, err := DecodeEvents(typ.eventType, []byte(typ.body))
+				if err != nil || len(es) != 1 {
+					t.Fatalf("decode %s: %d events, %v", typ.body, len(es), err)
+				}
+
+				// The result is the same however the rules are built.
+				for n := 0; n < 10; n++ {
+					rs := BuildRules([]v1alpha1.ClusterRuleGroup{group}, nil)
+					var got []string
+					EvaluateEvent(RulesByType(rs), Sequences(rs), es[0], time.Now(), func(ev *Evaluation) {
+						if ev.Err != nil {
+							t.Fatal(ev.Err)
+						}
+						if ev.Fired {
+							got = append(got, ev.Rule.Name)
+						}
+					})
+					if !reflect.DeepEqual(got, tt.want) {
+						t.Fatalf("got %v, want %v", got, tt.want)
+					}
+				}
+			})
+		}
+	}
+}
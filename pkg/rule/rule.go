@@ -23,14 +23,15 @@ import (
 	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
 	"whizard-telemetry-ruler/pkg/cache"
 	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/metrics"
 	"whizard-telemetry-ruler/pkg/utils"
 
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/golang/glog"
-	"github.com/kubesphere/event-rule-engine/visitor"
 )
 
 const (
@@ -38,6 +39,7 @@ const (
 	KindMacro    = "macro"
 	KindList     = "list"
 	KindAlias    = "alias"
+	KindSequence = "sequence"
 	AuditingType = "auditing"
 	EventsType   = "events"
 	LoggingType  = "logging"
@@ -47,6 +49,16 @@ type WhizardEvent struct {
 	Kind     string
 	Event    *Event
 	Auditing *Auditing
+	Logging  *Logging
+	// Done is called when the event is processed or dropped by the workers, it may be nil.
+	Done func()
+}
+
+// Processed call Done of the event.
+func (e *WhizardEvent) Processed() {
+	if e.Done != nil {
+		e.Done()
+	}
 }
 
 type Group struct {
@@ -57,13 +69,25 @@ type Group struct {
 }
 
 type Rule struct {
-	// The name of group which this rule in.
+	// The name of group which this rule in, it is namespace/name for the RuleGroup.
 	Group string
+	// The namespace of RuleGroup which this rule in, empty for the ClusterRuleGroup.
+	Namespace string
 	v1alpha1.Rule
 	labels      map[string]string
 	whizardEventType string
 	format      string
 	params      []string
+	// The names of receivers which the alert will be sent to.
+	receivers []string
+	// The compiled condition.
+	condition *Condition
+	// The match mode of the group, empty means the global match mode.
+	matchMode string
+	// The window to count the matched events, nil if the rule has no threshold.
+	window *window
+	// The compiled sequence, nil if the kind of rule is not sequence.
+	sequence *sequence
 }
 
 var resourceInWorkSpace = []string{
@@ -75,11 +99,14 @@ var resourceInWorkSpace = []string{
 	"workspacemembers",
 }
 
-func (r *Rule) GetAuditingAlertMessage(a *Auditing, m map[string]interface{}, rs map[string]Rule) (string, map[string]string) {
+func (r *Rule) GetAuditingAlertMessage(a *Auditing, f Fields) (string, map[string]string) {
 
 	var msg string
 	if len(r.Rule.Alerts.Message) == 0 {
-		if len(a.Workspace) > 0 && utils.IsExist(resourceInWorkSpace, a.ObjectRef.Resource) {
+		if a.ObjectRef == nil {
+			// The non-resource requests, such as /healthz.
+			msg = fmt.Sprintf("%s %s %s", a.User.Username, a.Verb, a.RequestURI)
+		} else if len(a.Workspace) > 0 && utils.IsExist(resourceInWorkSpace, a.ObjectRef.Resource) {
 			msg = fmt.Sprintf("%s %s %s '%s' in Workspace %s", a.User.Username, a.Verb, a.ObjectRef.Resource, a.ObjectRef.Name, a.Workspace)
 		} else if len(a.Devops) > 0 {
 			msg = fmt.Sprintf("%s %s %s '%s' in Devops %s", a.User.Username, a.Verb, a.ObjectRef.Resource, a.ObjectRef.Name, a.Devops)
@@ -89,89 +116,110 @@ func (r *Rule) GetAuditingAlertMessage(a *Auditing, m map[string]interface{}, rs
 			msg = fmt.Sprintf("%s %s %s '%s'", a.User.Username, a.Verb, a.ObjectRef.Resource, a.ObjectRef.Name)
 		}
 	} else {
-		var ps []interface{}
-		for _, p := range r.params {
-			if strings.HasPrefix(p, "$") {
-				index, err := strconv.Atoi(p[1:])
-				if err != nil {
-					glog.Error(err)
-					ps = append(ps, "")
-				}
-
-				ss := strings.Split(m["ObjectRef.Name"].(string), ":")
-				if index-1 < len(ss) {
-					ps = append(ps, ss[index-1])
-				} else {
-					ps = append(ps, "")
-				}
-			} else {
-				key := p
-				mr, ok := rs[fmt.Sprintf("%s.%s", r.Group, p)]
-				if !ok || mr.Expr.Kind != KindAlias {
-					mr, ok = rs[key]
-				}
-				if ok && mr.Expr.Kind == KindAlias {
-					key = mr.Expr.Alias
-				}
-				ps = append(ps, m[key])
-			}
-		}
-		msg = fmt.Sprintf(r.format, ps...)
+		name, _ := f.Get("ObjectRef.Name").(string)
+		msg = r.formatMessage(f, name)
 	}
 
-	an := make(map[string]string)
-	for k, v := range r.Alerts.Annotations {
-		an[k] = v
-	}
-	return msg, an
+	return msg, r.copyAnnotations()
 }
 
-func (r *Rule) GetEventAlertMessage(e *Event, m map[string]interface{}, rs map[string]Rule) (string, map[string]string) {
+func (r *Rule) GetEventAlertMessage(e *Event, f Fields) (string, map[string]string) {
 
 	var msg string
 	if len(r.Alerts.Message) == 0 {
 		msg = fmt.Sprintf("%s'", e.Event.Message)
 	} else {
-		var ps []interface{}
-		for _, p := range r.params {
-			if strings.HasPrefix(p, "$") {
-				index, err := strconv.Atoi(p[1:])
-				if err != nil {
-					glog.Error(err)
-					ps = append(ps, "")
-				}
+		name, _ := f.Get("involvedObject.name").(string)
+		msg = r.formatMessage(f, name)
+	}
 
-				ss := strings.Split(m["involvedObject.Name"].(string), ":")
-				if index-1 < len(ss) {
-					ps = append(ps, ss[index-1])
-				} else {
-					ps = append(ps, "")
-				}
+	return msg, r.copyAnnotations()
+}
+
+func (r *Rule) GetLoggingAlertMessage(l *Logging, f Fields) (string, map[string]string) {
+
+	var msg string
+	if len(r.Alerts.Message) == 0 {
+		if len(l.Namespace()) > 0 {
+			msg = fmt.Sprintf("%s/%s %s: %s", l.Namespace(), l.Pod(), l.Container(), l.Content())
+		} else {
+			msg = l.Content()
+		}
+	} else {
+		msg = r.formatMessage(f, l.Pod())
+	}
+
+	return msg, r.copyAnnotations()
+}
+
+// formatMessage render the message with the fields, the param `$n` is the nth part of the name split by ':'.
+func (r *Rule) formatMessage(f Fields, name string) string {
+
+	var ps []interface{}
+	for _, p := range r.params {
+		if strings.HasPrefix(p, "$") {
+			// The params of threshold and sequence rule, such as `$count`.
+			if v := f.Get(p); v != nil {
+				ps = append(ps, v)
+				continue
+			}
+
+			index, err := strconv.Atoi(p[1:])
+			if err != nil {
+				glog.Error(err)
+				ps = append(ps, "")
+				continue
+			}
+
+			ss := strings.Split(name, ":")
+			if index > 0 && index-1 < len(ss) {
+				ps = append(ps, ss[index-1])
 			} else {
-				key := p
-				mr, ok := rs[fmt.Sprintf("%s.%s", r.Group, p)]
-				if !ok || mr.Expr.Kind != KindAlias {
-					mr, ok = rs[key]
-				}
-				if ok && mr.Expr.Kind == KindAlias {
-					key = mr.Expr.Alias
-				}
-				ps = append(ps, m[key])
+				ps = append(ps, "")
 			}
+		} else {
+			ps = append(ps, f.Get(p))
 		}
-		msg = fmt.Sprintf(r.format, ps...)
 	}
 
+	return fmt.Sprintf(r.format, ps...)
+}
+
+// paramFields adds the params which are not the fields of event, such as `$count`, to the fields.
+type paramFields struct {
+	Fields
+	values map[string]interface{}
+}
+
+func (f *paramFields) Get(name string) interface{} {
+	if v, ok := f.values[name]; ok {
+		return v
+	}
+	return f.Fields.Get(name)
+}
+
+func (f *paramFields) Exists(name string) bool {
+	if _, ok := f.values[name]; ok {
+		return true
+	}
+	return f.Fields.Exists(name)
+}
+
+func (r *Rule) copyAnnotations() map[string]string {
 	an := make(map[string]string)
 	for k, v := range r.Alerts.Annotations {
 		an[k] = v
 	}
-	return msg, an
+	return an
 }
 
 func (r *Rule) GetCondition(rs map[string]Rule) (string, error) {
+	return r.expandCondition(r.Rule.Expr.Condition, rs)
+}
+
+// expandCondition replace the macros, lists and aliases referenced by the condition.
+func (r *Rule) expandCondition(c string, rs map[string]Rule) (string, error) {
 
-	c := r.Rule.Expr.Condition
 	regex, err := regexp.Compile("\\${(.*?)}")
 	if err != nil {
 		return c, err
@@ -185,9 +233,9 @@ func (r *Rule) GetCondition(rs map[string]Rule) (string, error) {
 	for _, s := range ss {
 		key := strings.TrimPrefix(s, "${")
 		key = strings.TrimSuffix(key, "}")
-		rule, ok := rs[fmt.Sprintf("%s.%s", r.Group, key)]
-		if !ok {
-			rule, ok = rs[key]
+		rule, ok := r.lookup(key, rs)
+		if ok && rule.disabled() {
+			return c, fmt.Errorf("rule %s not correct, %s is disabled", r.Name, key)
 		}
 		if ok {
 			switch rule.Expr.Kind {
@@ -217,6 +265,30 @@ func (r *Rule) GetCondition(rs map[string]Rule) (string, error) {
 	return c, nil
 }
 
+// lookup return the rule referenced by the name, the rule of the same group is preferred.
+func (r *Rule) lookup(name string, rs map[string]Rule) (Rule, bool) {
+
+	rule, ok := rs[fmt.Sprintf("%s.%s", r.Group, name)]
+	if !ok {
+		rule, ok = rs[name]
+	}
+	if ok && !r.canReference(&rule) {
+		ok = false
+	}
+
+	return rule, ok
+}
+
+// enabled return true if the rule or sequence is enabled, it is disabled unless enable is true.
+func (r *Rule) enabled() bool {
+	return r.Enable != nil && *r.Enable
+}
+
+// disabled return true if the macro, list or alias is disabled, it is enabled unless enable is false.
+func (r *Rule) disabled() bool {
+	return r.Enable != nil && !*r.Enable
+}
+
 func (r *Rule) Print() map[string]interface{} {
 
 	m, err := utils.StructToMap(r)
@@ -224,14 +296,15 @@ func (r *Rule) Print() map[string]interface{} {
 		return nil
 	}
 
-	if r.Expr.Kind != KindRule {
+	if r.Expr.Kind != KindRule && r.Expr.Kind != KindSequence {
 		delete(m, "enable")
 
 	}
 	return m
 }
 
-func (r *Rule) SetParams() {
+// SetParams parse the params of message, the aliases in params are resolved with the rules.
+func (r *Rule) SetParams(rs map[string]Rule) {
 
 	regex, err := regexp.Compile("\\${(.*?)}")
 	if err != nil {
@@ -254,6 +327,15 @@ func (r *Rule) SetParams() {
 		op = strings.ReplaceAll(op, s, "%s")
 		s = strings.TrimPrefix(s, "${")
 		s = strings.TrimSuffix(s, "}")
+		if !strings.HasPrefix(s, "$") {
+			mr, ok := rs[fmt.Sprintf("%s.%s", r.Group, s)]
+			if !ok || mr.Expr.Kind != KindAlias {
+				mr, ok = rs[s]
+			}
+			if ok && mr.Expr.Kind == KindAlias && r.canReference(&mr) {
+				s = mr.Expr.Alias
+			}
+		}
 		ps = append(ps, s)
 	}
 
@@ -288,6 +370,12 @@ func (r *Rule) GetEventType() string {
 	return r.whizardEventType
 }
 
+// GetReceivers return the receivers of the rule, or the receivers of the group
+// if the rule does not specify, empty means all receivers.
+func (r *Rule) GetReceivers() []string {
+	return r.receivers
+}
+
 
 // LoadRule load rule policy from Rules.
 func LoadRule() (map[string]Rule, error) {
@@ -297,38 +385,224 @@ func LoadRule() (map[string]Rule, error) {
 		return nil, err
 	}
 
+	nrl := &v1alpha1.RuleGroupList{}
+	if err := cache.Cache().List(context.Background(), nrl); err != nil {
+		return nil, err
+	}
+
+	return LoadRuleGroups(rl.Items, nrl.Items), nil
+}
+
+// LoadRuleGroups build the rules of the groups, keep the states of the unchanged threshold and sequence
+// rules, and record the validation results of the groups. The loads must not run concurrently, or the
+// states and results may be of another load.
+func LoadRuleGroups(groups []v1alpha1.ClusterRuleGroup, namespaced []v1alpha1.RuleGroup) map[string]Rule {
+	rules, results := buildRules(groups, namespaced)
+	metrics.RulesInvalid.Set(float64(logInvalidRules(results)))
+	KeepStates(rules)
+	setGroupResults(results)
+	return rules
+}
+
+// BuildRules build the rules from the rule groups. The conditions of rules are expanded
+// and compiled, and the params of messages are parsed, the invalid rules are dropped.
+// The groups of RuleGroup are named by namespace/name, and their rules only match the
+// events of the namespace.
+func BuildRules(groups []v1alpha1.ClusterRuleGroup, namespaced []v1alpha1.RuleGroup) map[string]Rule {
+	rules, results := buildRules(groups, namespaced)
+	logInvalidRules(results)
+	return rules
+}
+
+// logInvalidRules log the invalid rules, and return the number of them.
+func logInvalidRules(results map[string]*GroupResult) int {
+	n := 0
+	for group, gr := range results {
+		for _, r := range gr.Rules {
+			if !r.Valid {
+				glog.Errorf("item %s.%s is not correct, %s", group, r.Name, r.Error)
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// ruleSource is a ClusterRuleGroup or RuleGroup which the rules are built from.
+type ruleSource struct {
+	// The name of ClusterRuleGroup, or namespace/name of RuleGroup.
+	name       string
+	namespace  string
+	generation int64
+	spec       *v1alpha1.ClusterRuleGroupRuleSpec
+}
+
+func ruleSources(groups []v1alpha1.ClusterRuleGroup, namespaced []v1alpha1.RuleGroup) []ruleSource {
+
+	var sources []ruleSource
+	for i := range groups {
+		item := &groups[i]
+		sources = append(sources, ruleSource{name: item.Name, generation: item.Generation, spec: &item.Spec})
+	}
+	for i := range namespaced {
+		item := &namespaced[i]
+		sources = append(sources, ruleSource{
+			name:       fmt.Sprintf("%s/%s", item.Namespace, item.Name),
+			namespace:  item.Namespace,
+			generation: item.Generation,
+			spec:       &item.Spec,
+		})
+	}
+
+	return sources
+}
+
+// buildRules build the rules, and return the validation results of every group, the invalid rules are not logged.
+func buildRules(groups []v1alpha1.ClusterRuleGroup, namespaced []v1alpha1.RuleGroup) (map[string]Rule, map[string]*GroupResult) {
+
+	sources := ruleSources(groups, namespaced)
 	rules := make(map[string]Rule)
-	for _, item := range rl.Items {
-		outputType := item.Spec.Type
-		for _, pr := range item.Spec.Rules {
+	for _, item := range sources {
+		outputType := item.spec.Type
+		mode := item.spec.MatchMode
+		if err := ValidateMatchMode(mode); err != nil {
+			glog.Errorf("rule group %s uses the global match mode, %s", item.name, err)
+			mode = ""
+		}
+		for _, pr := range item.spec.Rules {
 			r := Rule{}
 			r.Rule = pr
 			r.whizardEventType = outputType
-			r.Group = item.Name
+			r.Group = item.name
+			r.Namespace = item.namespace
+			r.matchMode = mode
+			// The alert of a rule without severity is INFO.
+			if (pr.Expr.Kind == KindRule || pr.Expr.Kind == KindSequence) && len(pr.Alerts.Severity) == 0 {
+				r.Alerts.Severity = constant.Info
+			}
+			r.receivers = item.spec.Receivers
+			if len(pr.Receivers) > 0 {
+				r.receivers = pr.Receivers
+			}
 			rules[fmt.Sprintf("%s.%s", r.Group, r.Name)] = r
 		}
 	}
 
+	// The macros, lists and aliases are read when compiling, so the compiled rules are
+	// put into a new map to keep the source rules unchanged.
+	compiled := make(map[string]Rule)
+	ruleResults := make(map[string]RuleResult)
 	for name, r := range rules {
-		if r.Expr.Kind == KindRule {
-			// If the condition of item is incorrect, delete this item.
-			c, err := r.GetCondition(rules)
+		c, err := r.compile(rules)
+		ruleResults[name] = RuleResult{Name: r.Name, Valid: err == nil, Condition: c, Error: errorString(err)}
+		if err != nil {
+			continue
+		}
+
+		r.SetParams(rules)
+		compiled[name] = r
+	}
+
+	// The results of rules are kept in the order of the group.
+	results := make(map[string]*GroupResult)
+	for _, item := range sources {
+		gr := &GroupResult{Generation: item.generation}
+		for _, pr := range item.spec.Rules {
+			gr.Rules = append(gr.Rules, ruleResults[fmt.Sprintf("%s.%s", item.name, pr.Name)])
+		}
+		results[item.name] = gr
+	}
+
+	return compiled, results
+}
+
+// compile expand and compile the condition, and build the threshold and sequence of the rule.
+// The expanded condition is returned even if the rule is invalid.
+func (r *Rule) compile(rules map[string]Rule) (string, error) {
+
+	var c string
+	if r.Expr.Kind == KindRule {
+		var err error
+		// If the condition of item is incorrect, delete this item.
+		c, err = r.GetCondition(rules)
+		if err != nil {
+			return c, err
+		}
+
+		// If the condition of item is not grammatical, delete this item.
+		condition, err := CompileCondition(c)
+		if err != nil {
+			return c, fmt.Errorf("conditions(%s), err(%s)", c, err)
+		}
+		r.condition = condition
+
+		if r.Threshold != nil {
+			w, err := newWindow(r.Threshold)
 			if err != nil {
-				glog.Error(err)
-				delete(rules, name)
-				continue
+				return c, err
 			}
+			r.window = w
+		}
+	}
 
-			// If the condition of item is not grammatical, delete this item.
-			if ok, err := visitor.CheckRule(c); !ok {
-				glog.Errorf("item %s is not correct, conditions(%s), err(%s)", name, c, err)
-				delete(rules, name)
-			}
+	if r.Dedup != nil && r.Dedup.Window.Duration <= 0 {
+		return c, fmt.Errorf("the window of dedup must be greater than 0")
+	}
+
+	if r.Expr.Kind == KindSequence {
+		seq, err := r.compileSequence(rules)
+		if err != nil {
+			return c, err
 		}
+		r.sequence = seq
+	}
+
+	return c, nil
+}
 
-		r.SetParams()
-		rules[name] = r
+func errorString(err error) string {
+	if err == nil {
+		return ""
 	}
+	return err.Error()
+}
+
+// GetCompiledCondition return the compiled condition, it is nil if the kind of rule is not rule.
+func (r *Rule) GetCompiledCondition() *Condition {
+	return r.condition
+}
+
+// Evaluate return true if the fields match the compiled condition of rule.
+func (r *Rule) Evaluate(f Fields) (bool, error) {
+	if r.condition == nil {
+		return false, fmt.Errorf("rule %s is not compiled", r.Name)
+	}
+
+	if !r.InScope(f) {
+		return false, nil
+	}
+
+	return r.condition.Evaluate(f)
+}
+
+// RulesByType return the enabled rules of kind rule grouped by type, every list is sorted
+// by the group and name of rules.
+func RulesByType(rules map[string]Rule) map[string][]*Rule {
+
+	var names []string
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	return rules, nil
+	m := make(map[string][]*Rule)
+	for _, name := range names {
+		r := rules[name]
+		if !r.enabled() || r.Expr.Kind != KindRule || r.condition == nil {
+			continue
+		}
+		m[r.whizardEventType] = append(m[r.whizardEventType], &r)
+	}
+
+	return m
 }
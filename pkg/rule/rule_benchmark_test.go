@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	"github.com/kubesphere/event-rule-engine/visitor"
+	"sigs.k8s.io/yaml"
+)
+
+// loadBenchmarkRules load the example rules in deploy/yaml/rules.yaml.
+func loadBenchmarkRules(b *testing.B) map[string]Rule {
+
+	data, err := ioutil.ReadFile("../../deploy/yaml/rules.yaml")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var groups []v1alpha1.ClusterRuleGroup
+	for _, doc := range strings.Split(string(data), "\n---") {
+		if len(strings.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		group := v1alpha1.ClusterRuleGroup{}
+		if err := yaml.Unmarshal([]byte(doc), &group); err != nil {
+			b.Fatal(err)
+		}
+		groups = append(groups, group)
+	}
+
+	return BuildRules(groups, nil)
+}
+
+// loadBenchmarkAuditings load the auditing events in pkg/test/auditing.json, and derive
+// events with different verbs and resources from them.
+func loadBenchmarkAuditings(b *testing.B) []*Auditing {
+
+	data, err := ioutil.ReadFile("../test/auditing.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var events []*Auditing
+	for _, verb := range []string{"create", "delete", "get", "list", "patch"} {
+		for _, resource := range []string{"pods", "services", "namespaces", "secrets"} {
+			auditings, err := NewAuditing(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for _, a := range auditings {
+				a.Verb = verb
+				a.ObjectRef.Resource = resource
+				events = append(events, a)
+			}
+		}
+	}
+
+	return events
+}
+
+func flattenAuditing(b *testing.B, a *Auditing) map[string]interface{} {
+
+	m, err := utils.StructToMap(a.Event)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return utils.Flatten(m)
+}
+
+// loadBenchmarkEvents load the auditing events, the events are flattened.
+func loadBenchmarkEvents(b *testing.B) []map[string]interface{} {
+
+	var events []map[string]interface{}
+	for _, a := range loadBenchmarkAuditings(b) {
+		events = append(events, flattenAuditing(b, a))
+	}
+
+	return events
+}
+
+// BenchmarkEvaluateInterpreted expand and parse the conditions for every event, as it was done before the rules are compiled.
+func BenchmarkEvaluateInterpreted(b *testing.B) {
+
+	rules := loadBenchmarkRules(b)
+	events := loadBenchmarkEvents(b)
+	rs := RulesByType(rules)[AuditingType]
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, m := range events {
+			for _, r := range rs {
+				c, _ := r.GetCondition(rules)
+				if err, _ := visitor.EventRuleEvaluate(m, c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkEvaluateCompiled evaluate the conditions compiled when the rules are loaded.
+func BenchmarkEvaluateCompiled(b *testing.B) {
+
+	rules := loadBenchmarkRules(b)
+	events := loadBenchmarkEvents(b)
+	rs := RulesByType(rules)[AuditingType]
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, m := range events {
+			for _, r := range rs {
+				if _, err := r.Evaluate(MapFields(m)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkFieldsFlatten convert every event to the flattened map by the JSON round trip before evaluating.
+func BenchmarkFieldsFlatten(b *testing.B) {
+
+	rules := loadBenchmarkRules(b)
+	events := loadBenchmarkAuditings(b)
+	rs := RulesByType(rules)[AuditingType]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, a := range events {
+			fields := MapFields(flattenAuditing(b, a))
+			for _, r := range rs {
+				if _, err := r.Evaluate(fields); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkFieldsAccessor read the fields of every event directly when evaluating.
+func BenchmarkFieldsAccessor(b *testing.B) {
+
+	rules := loadBenchmarkRules(b)
+	events := loadBenchmarkAuditings(b)
+	rs := RulesByType(rules)[AuditingType]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, a := range events {
+			fields := a.Fields()
+			for _, r := range rs {
+				if _, err := r.Evaluate(fields); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLoadRuleGroupsInvalidRules(t *testing.T) {
+
+	defer setGroupResults(nil)
+
+	invalid := newClusterRuleGroup("g", AuditingType,
+		newConditionRule("valid", `Verb = "delete"`),
+		newConditionRule("unresolved", "${missing}"),
+		newConditionRule("ungrammatical", `Verb = `),
+	)
+	fixed := newClusterRuleGroup("g", AuditingType, newConditionRule("valid", `Verb = "delete"`))
+
+	loadErrors := testutil.ToFloat64(metrics.RuleLoadErrors)
+	for i, c := range []struct {
+		group v1alpha1.ClusterRuleGroup
+		want  float64
+	}{
+		{invalid, 2},
+		// The rules which stay invalid are not counted again.
+		{invalid, 2},
+		{fixed, 0},
+	} {
+		LoadRuleGroups([]v1alpha1.ClusterRuleGroup{c.group}, nil)
+		if got := testutil.ToFloat64(metrics.RulesInvalid); got != c.want {
+			t.Errorf("load %d: got %v invalid rules, want %v", i+1, got, c.want)
+		}
+	}
+
+	if got := testutil.ToFloat64(metrics.RuleLoadErrors); got != loadErrors {
+		t.Errorf("the invalid rules should not be counted as load errors, got %v, want %v", got, loadErrors)
+	}
+}
+
+func TestLoadRuleGroupsPruneLastMatches(t *testing.T) {
+
+	defer setGroupResults(nil)
+
+	at := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	rules := LoadRuleGroups([]v1alpha1.ClusterRuleGroup{
+		newClusterRuleGroup("g", AuditingType, newConditionRule("kept", `Verb = "delete"`), newConditionRule("removed", `Verb = "get"`)),
+		newClusterRuleGroup("deleted", AuditingType, newConditionRule("kept", `Verb = "delete"`)),
+	}, nil)
+	for _, r := range rules {
+		r.RecordMatch(at)
+	}
+
+	LoadRuleGroups([]v1alpha1.ClusterRuleGroup{
+		newClusterRuleGroup("g", AuditingType, newConditionRule("kept", `Verb = "delete"`)),
+	}, nil)
+
+	for _, c := range []struct {
+		group, name string
+		want        bool
+	}{
+		{"g", "kept", true},
+		{"g", "removed", false},
+		{"deleted", "kept", false},
+	} {
+		if _, ok := GetLastMatchTime(c.group, c.name); ok != c.want {
+			t.Errorf("last match time of %s.%s: got %v, want %v", c.group, c.name, ok, c.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+// The fields which hold the namespace of event, by type.
+var namespaceFields = map[string]string{
+	AuditingType: "ObjectRef.Namespace",
+	EventsType:   "involvedObject.namespace",
+	LoggingType:  "kubernetes.namespace_name",
+}
+
+// InScope return true if the event is in the namespace of the RuleGroup which the rule in,
+// the rules of ClusterRuleGroup match the events of all namespaces.
+func (r *Rule) InScope(f Fields) bool {
+	return inNamespace(r.Namespace, r.whizardEventType, f)
+}
+
+// inNamespace return true if the namespace is empty, or the event of the type is in the namespace.
+func inNamespace(namespace, eventType string, f Fields) bool {
+
+	if len(namespace) == 0 {
+		return true
+	}
+
+	field, ok := namespaceFields[eventType]
+	if !ok {
+		return false
+	}
+
+	ns, _ := f.Get(field).(string)
+	return ns == namespace
+}
+
+// canReference return true if the rule can use the macro, list or alias. The rules of RuleGroup
+// can use the ones of ClusterRuleGroups and the RuleGroups in the same namespace, and the rules
+// of ClusterRuleGroup can only use the ones of ClusterRuleGroups.
+func (r *Rule) canReference(ref *Rule) bool {
+	return len(ref.Namespace) == 0 || ref.Namespace == r.Namespace
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func newRuleGroup(namespace, name, eventType string, rules ...v1alpha1.Rule) v1alpha1.RuleGroup {
+	return v1alpha1.RuleGroup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       v1alpha1.ClusterRuleGroupRuleSpec{Type: eventType, Rules: rules},
+	}
+}
+
+func newClusterRuleGroup(name, eventType string, rules ...v1alpha1.Rule) v1alpha1.ClusterRuleGroup {
+	return v1alpha1.ClusterRuleGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1alpha1.ClusterRuleGroupRuleSpec{Type: eventType, Rules: rules},
+	}
+}
+
+func newConditionRule(name, condition string) v1alpha1.Rule {
+	return v1alpha1.Rule{
+		Name:   name,
+		Enable: pointer.Bool(true),
+		Expr:   v1alpha1.Expr{Kind: KindRule, Condition: condition},
+	}
+}
+
+func TestRuleGroupScope(t *testing.T) {
+
+	tests := []struct {
+		eventType string
+		condition string
+		// The events in the namespace tenant, in the namespace other, and of no namespace.
+		tenant, other, cluster string
+	}{
+		{
+			eventType: AuditingType,
+			condition: `Verb = "delete"`,
+			tenant:    `[{"Verb":"delete","ObjectRef":{"Namespace":"tenant"}}]`,
+			other:     `[{"Verb":"delete","ObjectRef":{"Namespace":"other"}}]`,
+			cluster:   `[{"Verb":"delete"}]`,
+		},
+		{
+			eventType: EventsType,
+			condition: `reason = "BackOff"`,
+			tenant:    `[{"Event":{"reason":"BackOff","involvedObject":{"namespace":"tenant"}}}]`,
+			other:     `[{"Event":{"reason":"BackOff","involvedObject":{"namespace":"other"}}}]`,
+			cluster:   `[{"Event":{"reason":"BackOff","involvedObject":{"kind":"Node"}}}]`,
+		},
+		{
+			eventType: LoggingType,
+			condition: `log contains "panic"`,
+			tenant:    `[{"log":"panic","kubernetes":{"namespace_name":"tenant"}}]`,
+			other:     `[{"log":"panic","kubernetes":{"namespace_name":"other"}}]`,
+			cluster:   `[{"log":"panic"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			rules, results := buildRules(nil, []v1alpha1.RuleGroup{
+				newRuleGroup("tenant", "g", tt.eventType, newConditionRule("r", tt.condition)),
+			})
+			if len(rules) != 1 {
+				t.Fatalf("rules = %d, results = %+v, want 1 rule", len(rules), results["tenant/g"])
+			}
+
+			for _, c := range []struct {
+				body string
+				want bool
+			}{
+				{tt.tenant, true},
+				{tt.other, false},
+				{tt.cluster, false},
+			} {
+				es, err := DecodeEvents(tt.eventType, []byte(c.body))
+				if err != nil || len(es) != 1 {
+					t.Fatalf("decode %s: %d events, %v", c.body, len(es), err)
+				}
+
+				fired := false
+				EvaluateEvent(RulesByType(rules), Sequences(rules), es[0], time.Now(), func(ev *Evaluation) {
+					if ev.Fired {
+						fired = true
+					}
+				})
+				if fired != c.want {
+					t.Errorf("event %s fired %v, want %v", c.body, fired, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRuleGroupReference(t *testing.T) {
+
+	definitions := func() []v1alpha1.Rule {
+		return []v1alpha1.Rule{
+			{Name: "m", Expr: v1alpha1.Expr{Kind: KindMacro, Macro: `Verb = "delete"`}},
+			{Name: "l", Expr: v1alpha1.Expr{Kind: KindList, List: []string{"pods", "secrets"}}},
+			{Name: "a", Expr: v1alpha1.Expr{Kind: KindAlias, Alias: "ObjectRef.Resource"}},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		group string
+		// The group which holds the macro, list and alias.
+		ref   string
+		valid bool
+	}{
+		{name: "RuleGroup to the same namespace", group: "tenant/g", ref: "tenant/defs", valid: true},
+		{name: "RuleGroup to another namespace", group: "tenant/g", ref: "other/defs", valid: false},
+		{name: "RuleGroup to ClusterRuleGroup", group: "tenant/g", ref: "defs", valid: true},
+		{name: "ClusterRuleGroup to ClusterRuleGroup", group: "g", ref: "defs", valid: true},
+		{name: "ClusterRuleGroup to RuleGroup", group: "g", ref: "tenant/defs", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var groups []v1alpha1.ClusterRuleGroup
+			var namespaced []v1alpha1.RuleGroup
+			add := func(group string, rules ...v1alpha1.Rule) {
+				if namespace, name, ok := strings.Cut(group, "/"); ok {
+					namespaced = append(namespaced, newRuleGroup(namespace, name, AuditingType, rules...))
+					return
+				}
+				groups = append(groups, newClusterRuleGroup(group, AuditingType, rules...))
+			}
+
+			add(tt.ref, definitions()...)
+			add(tt.group,
+				newConditionRule("macro", "${"+tt.ref+".m}"),
+				newConditionRule("list", "ObjectRef.Resource in ${"+tt.ref+".l}"),
+				newConditionRule("alias", "${"+tt.ref+".a} = \"pods\""),
+			)
+
+			_, results := buildRules(groups, namespaced)
+			gr, ok := results[tt.group]
+			if !ok {
+				t.Fatalf("no result of group %s", tt.group)
+			}
+			if len(gr.Rules) != 3 {
+				t.Fatalf("results = %+v, want 3 rules", gr.Rules)
+			}
+			for _, r := range gr.Rules {
+				if r.Valid != tt.valid {
+					t.Errorf("rule %s valid %v, want %v, error: %s", r.Name, r.Valid, tt.valid, r.Error)
+				}
+			}
+		})
+	}
+}
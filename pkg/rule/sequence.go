@@ -0,0 +1,361 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"container/list"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+)
+
+// The params of message which are only available for the sequence rules.
+const (
+	// ParamSteps is the summary of every matched step.
+	ParamSteps = "$steps"
+	// ParamKey is the value of the join key.
+	ParamKey = "$key"
+)
+
+var sequenceMaxKeys int
+
+func init() {
+	flag.IntVar(&sequenceMaxKeys, "sequence-max-keys", 10000, "The max number of join keys tracked by a sequence rule, "+
+		"the key least recently matched is evicted when it is exceeded")
+}
+
+type sequenceStep struct {
+	name      string
+	eventType string
+	joinBy    string
+	condition *Condition
+}
+
+// sequence tracks the progress of a sequence rule for every join key.
+// A sequence is safe for concurrent use.
+type sequence struct {
+	spec    v1alpha1.Sequence
+	steps   []sequenceStep
+	maxSpan time.Duration
+	mutex   sync.Mutex
+	// The element of every join key in lru.
+	progresses map[string]*list.Element
+	// The progresses ordered by the last matched time, the front is the latest.
+	lru *list.List
+}
+
+// progress is the steps matched by the events with the same join key.
+type progress struct {
+	key   string
+	start time.Time
+	steps []StepMatch
+}
+
+// StepMatch is a step of sequence matched by an event.
+type StepMatch struct {
+	Step    string    `json:"step"`
+	Time    time.Time `json:"time"`
+	Summary string    `json:"summary"`
+}
+
+// compileSequence compile the conditions of steps, the macros, lists and aliases are expanded with the rules.
+func (r *Rule) compileSequence(rs map[string]Rule) (*sequence, error) {
+
+	spec := r.Sequence
+	if spec == nil {
+		return nil, fmt.Errorf("sequence is required when the kind of rule is %s", KindSequence)
+	}
+	if len(spec.Steps) < 2 {
+		return nil, fmt.Errorf("the sequence must have at least two steps")
+	}
+	if spec.MaxSpan.Duration <= 0 {
+		return nil, fmt.Errorf("the max span of sequence must be greater than 0")
+	}
+
+	seq := &sequence{
+		spec:       *spec.DeepCopy(),
+		maxSpan:    spec.MaxSpan.Duration,
+		progresses: make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+	for i, s := range spec.Steps {
+		step := sequenceStep{
+			name:      s.Name,
+			eventType: s.Type,
+			joinBy:    s.JoinBy,
+		}
+		if len(step.name) == 0 {
+			step.name = fmt.Sprintf("step%d", i+1)
+		}
+		if len(step.eventType) == 0 {
+			step.eventType = r.whizardEventType
+		}
+		switch step.eventType {
+		case AuditingType, EventsType, LoggingType:
+		default:
+			return nil, fmt.Errorf("step %s has unknown type %s", step.name, step.eventType)
+		}
+		if len(step.joinBy) == 0 {
+			step.joinBy = spec.JoinBy
+		}
+		if len(step.joinBy) == 0 {
+			return nil, fmt.Errorf("step %s has no join key", step.name)
+		}
+
+		c, err := r.expandCondition(s.Condition, rs)
+		if err != nil {
+			return nil, err
+		}
+		if step.condition, err = CompileCondition(c); err != nil {
+			return nil, fmt.Errorf("step %s is not correct, condition(%s), %s", step.name, c, err)
+		}
+
+		seq.steps = append(seq.steps, step)
+	}
+
+	return seq, nil
+}
+
+// IsSequence return true if the rule is a compiled sequence rule.
+func (r *Rule) IsSequence() bool {
+	return r.sequence != nil
+}
+
+// Advance match the event at time t with the steps of sequence rule, and return true if the
+// event matched the last step, then the fields to format the alert message are returned, they
+// include `$steps` and `$key`. Every event advances a join key by one step at most.
+func (r *Rule) Advance(e *WhizardEvent, f Fields, t time.Time) (Fields, bool, error) {
+
+	seq := r.sequence
+	if seq == nil {
+		return nil, false, fmt.Errorf("rule %s is not a sequence", r.Name)
+	}
+
+	eventType := typeOfKind(e.Kind)
+
+	var errs []string
+	// The steps are matched from the last one, so that the event will not advance the key
+	// which it has just advanced.
+	for i := len(seq.steps) - 1; i >= 0; i-- {
+		step := seq.steps[i]
+		if step.eventType != eventType || !inNamespace(r.Namespace, step.eventType, f) {
+			continue
+		}
+
+		ok, err := step.condition.Evaluate(f)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("step %s, %s", step.name, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		v := f.Get(step.joinBy)
+		if v == nil {
+			continue
+		}
+		key := fmt.Sprint(v)
+
+		match := StepMatch{Step: step.name, Time: t, Summary: summarize(e)}
+		if steps, done := seq.advance(i, key, match); done {
+			var ss []string
+			for n, s := range steps {
+				ss = append(ss, fmt.Sprintf("%d. %s at %s: %s", n+1, s.Step, s.Time.Format(time.RFC3339), s.Summary))
+			}
+
+			return &paramFields{
+				Fields: f,
+				values: map[string]interface{}{
+					ParamSteps: strings.Join(ss, "; "),
+					ParamKey:   key,
+				},
+			}, true, nil
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, false, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil, false, nil
+}
+
+// advance record the step i matched by the event of the join key, and return the matched steps
+// and true if the last step is matched, then the progress of the key is reset.
+func (s *sequence) advance(i int, key string, match StepMatch) ([]StepMatch, bool) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire(match.Time)
+
+	e, ok := s.progresses[key]
+	if ok && match.Time.Sub(e.Value.(*progress).start) > s.maxSpan {
+		s.remove(e)
+		ok = false
+	}
+
+	if !ok {
+		// A new progress only starts from the first step.
+		if i != 0 {
+			return nil, false
+		}
+
+		for len(s.progresses) >= sequenceMaxKeys && s.lru.Len() > 0 {
+			s.remove(s.lru.Back())
+		}
+		s.progresses[key] = s.lru.PushFront(&progress{
+			key:   key,
+			start: match.Time,
+			steps: []StepMatch{match},
+		})
+		return nil, false
+	}
+
+	p := e.Value.(*progress)
+	if len(p.steps) != i {
+		return nil, false
+	}
+
+	p.steps = append(p.steps, match)
+	s.lru.MoveToFront(e)
+	if len(p.steps) < len(s.steps) {
+		return nil, false
+	}
+
+	s.remove(e)
+	return p.steps, true
+}
+
+// expire remove the progresses which started before the max span.
+func (s *sequence) expire(t time.Time) {
+	for e := s.lru.Back(); e != nil; e = s.lru.Back() {
+		if t.Sub(e.Value.(*progress).start) <= s.maxSpan {
+			return
+		}
+		s.remove(e)
+	}
+}
+
+func (s *sequence) remove(e *list.Element) {
+	delete(s.progresses, e.Value.(*progress).key)
+	s.lru.Remove(e)
+}
+
+// GetSequenceAlertMessage return the alert message of the sequence rule, which summarises
+// the matched steps if the message of rule is empty.
+func (r *Rule) GetSequenceAlertMessage(f Fields) (string, map[string]string) {
+
+	var msg string
+	key, _ := f.Get(ParamKey).(string)
+	if len(r.Alerts.Message) == 0 {
+		msg = fmt.Sprintf("%s matched by %s: %s", r.Name, key, f.Get(ParamSteps))
+	} else {
+		msg = r.formatMessage(f, key)
+	}
+
+	return msg, r.copyAnnotations()
+}
+
+// Sequences return the enabled sequence rules which are compiled, sorted by the group and name of rules.
+func Sequences(rules map[string]Rule) []*Rule {
+
+	var names []string
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rs []*Rule
+	for _, name := range names {
+		r := rules[name]
+		if !r.enabled() || r.Expr.Kind != KindSequence || r.sequence == nil {
+			continue
+		}
+		rs = append(rs, &r)
+	}
+
+	return rs
+}
+
+func typeOfKind(kind string) string {
+	switch kind {
+	case constant.Auditing:
+		return AuditingType
+	case constant.Event:
+		return EventsType
+	case constant.Logging:
+		return LoggingType
+	default:
+		return ""
+	}
+}
+
+// summarize describe the event matched by a step.
+func summarize(e *WhizardEvent) string {
+	switch e.Kind {
+	case constant.Auditing:
+		a := e.Auditing
+		s := fmt.Sprintf("%s %s", a.User.Username, a.Verb)
+		if a.ObjectRef != nil {
+			s = fmt.Sprintf("%s %s '%s'", s, a.ObjectRef.Resource, a.ObjectRef.Name)
+			if len(a.ObjectRef.Namespace) > 0 {
+				s = fmt.Sprintf("%s in Namespace %s", s, a.ObjectRef.Namespace)
+			}
+		} else {
+			s = fmt.Sprintf("%s %s", s, a.RequestURI)
+		}
+		return s
+	case constant.Event:
+		ev := e.Event.Event
+		if ev == nil {
+			return ""
+		}
+		s := fmt.Sprintf("%s %s/%s %s", ev.InvolvedObject.Kind, ev.InvolvedObject.Namespace, ev.InvolvedObject.Name, ev.Reason)
+		if len(ev.Message) > 0 {
+			s = fmt.Sprintf("%s: %s", s, ev.Message)
+		}
+		return s
+	case constant.Logging:
+		return e.Logging.Content()
+	default:
+		return ""
+	}
+}
+
+// sameSequence return true if the sequences have the same spec, so the progresses can be kept.
+func sameSequence(s1, s2 *sequence) bool {
+	if len(s1.steps) != len(s2.steps) || !reflect.DeepEqual(s1.spec, s2.spec) {
+		return false
+	}
+
+	for i := range s1.steps {
+		if s1.steps[i].eventType != s2.steps[i].eventType ||
+			s1.steps[i].condition.String() != s2.steps[i].condition.String() {
+			return false
+		}
+	}
+
+	return true
+}
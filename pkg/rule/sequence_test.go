@@ -0,0 +1,268 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+// newSequence return the compiled sequence rule of the steps, which are joined by User.username.
+func newSequence(t *testing.T, maxSpan time.Duration, steps ...v1alpha1.SequenceStep) *Rule {
+	t.Helper()
+
+	rules, results := buildRules([]v1alpha1.ClusterRuleGroup{newClusterRuleGroup("g", AuditingType, v1alpha1.Rule{
+		Name:   "seq",
+		Enable: pointer.Bool(true),
+		Expr:   v1alpha1.Expr{Kind: KindSequence},
+		Sequence: &v1alpha1.Sequence{
+			Steps:   steps,
+			JoinBy:  "User.username",
+			MaxSpan: metav1.Duration{Duration: maxSpan},
+		},
+	})}, nil)
+
+	seqs := Sequences(rules)
+	if len(seqs) != 1 {
+		t.Fatalf("got %d sequences, results = %+v", len(seqs), results["g"])
+	}
+	return seqs[0]
+}
+
+// verbSteps return the auditing steps which match the verbs in order.
+func verbSteps(verbs ...string) []v1alpha1.SequenceStep {
+	var steps []v1alpha1.SequenceStep
+	for _, v := range verbs {
+		steps = append(steps, v1alpha1.SequenceStep{Name: v, Condition: fmt.Sprintf("Verb = %q", v)})
+	}
+	return steps
+}
+
+func decodeEvent(t *testing.T, eventType, body string) *WhizardEvent {
+	t.Helper()
+
+	es, err := DecodeEvents(eventType, []byte(body))
+	if err != nil || len(es) != 1 {
+		t.Fatalf("decode %s: %d events, %v", body, len(es), err)
+	}
+	return es[0]
+}
+
+func auditingEvent(t *testing.T, verb, user string) *WhizardEvent {
+	return decodeEvent(t, AuditingType, fmt.Sprintf(`[{"Verb":%q,"User":{"username":%q}}]`, verb, user))
+}
+
+// advance advance the sequence with the event at the time, and return the join key if the sequence is completed.
+func advance(t *testing.T, r *Rule, e *WhizardEvent, at time.Time) (string, bool) {
+	t.Helper()
+
+	f, ok, err := r.Advance(e, e.Fields(), at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		return "", false
+	}
+	key, _ := f.Get(ParamKey).(string)
+	return key, true
+}
+
+func TestSequenceStepOrder(t *testing.T) {
+
+	r := newSequence(t, time.Hour, verbSteps("create", "get", "delete")...)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		verb string
+		want bool
+	}{
+		// The progress only starts from the first step.
+		{"get", false},
+		{"delete", false},
+		{"create", false},
+		// The step skipping the second one does not advance the progress.
+		{"delete", false},
+		{"get", false},
+		{"delete", true},
+		// The progress is reset after the sequence is completed.
+		{"delete", false},
+	}
+
+	for i, tt := range tests {
+		e := auditingEvent(t, tt.verb, "alice")
+		at := now.Add(time.Duration(i) * time.Second)
+		if _, ok := advance(t, r, e, at); ok != tt.want {
+			t.Fatalf("event %d %s: completed %v, want %v", i+1, tt.verb, ok, tt.want)
+		}
+	}
+
+	// The matched steps are summarised in the alert message.
+	for i, verb := range []string{"create", "get", "delete"} {
+		e := auditingEvent(t, verb, "bob")
+		f, ok, err := r.Advance(e, e.Fields(), now.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			continue
+		}
+		msg, _ := r.GetSequenceAlertMessage(f)
+		for n, step := range []string{"1. create", "2. get", "3. delete"} {
+			if !strings.Contains(msg, step) {
+				t.Errorf("message %q does not contain step %d %q", msg, n+1, step)
+			}
+		}
+		return
+	}
+	t.Fatal("the sequence of bob is not completed")
+}
+
+func TestSequenceJoinKey(t *testing.T) {
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("same type", func(t *testing.T) {
+		r := newSequence(t, time.Hour, verbSteps("create", "delete")...)
+
+		for i, c := range []struct {
+			verb, user string
+			want       bool
+		}{
+			{"create", "alice", false},
+			{"delete", "bob", false},
+			{"create", "bob", false},
+			{"delete", "bob", true},
+			{"delete", "alice", true},
+		} {
+			key, ok := advance(t, r, auditingEvent(t, c.verb, c.user), now.Add(time.Duration(i)*time.Second))
+			if ok != c.want {
+				t.Fatalf("event %d %s by %s: completed %v, want %v", i+1, c.verb, c.user, ok, c.want)
+			}
+			if ok && key != c.user {
+				t.Errorf("event %d: key %q, want %q", i+1, key, c.user)
+			}
+		}
+	})
+
+	t.Run("step joinBy", func(t *testing.T) {
+		// The pod created is backing off, the events step is joined by the involved object.
+		r := newSequence(t, time.Hour,
+			v1alpha1.SequenceStep{Name: "create", Condition: `Verb = "create" and ObjectRef.Resource = "pods"`, JoinBy: "ObjectRef.Name"},
+			v1alpha1.SequenceStep{Name: "backoff", Type: EventsType, Condition: `reason = "BackOff"`, JoinBy: "involvedObject.name"},
+		)
+
+		create := decodeEvent(t, AuditingType, `[{"Verb":"create","ObjectRef":{"Resource":"pods","Name":"web"}}]`)
+		other := decodeEvent(t, EventsType, `[{"Event":{"reason":"BackOff","involvedObject":{"name":"db"}}}]`)
+		backoff := decodeEvent(t, EventsType, `[{"Event":{"reason":"BackOff","involvedObject":{"name":"web"}}}]`)
+
+		if _, ok := advance(t, r, create, now); ok {
+			t.Fatal("the first step should not complete the sequence")
+		}
+		if _, ok := advance(t, r, other, now.Add(time.Second)); ok {
+			t.Fatal("the event of another pod should not complete the sequence")
+		}
+		key, ok := advance(t, r, backoff, now.Add(2*time.Second))
+		if !ok || key != "web" {
+			t.Fatalf("got key %q, %v, want web", key, ok)
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		r := newSequence(t, time.Hour, verbSteps("create", "delete")...)
+		for i, verb := range []string{"create", "delete"} {
+			e := decodeEvent(t, AuditingType, fmt.Sprintf(`[{"Verb":%q}]`, verb))
+			if _, ok := advance(t, r, e, now.Add(time.Duration(i)*time.Second)); ok {
+				t.Fatal("the events without the join key should not complete the sequence")
+			}
+		}
+		if n := len(r.sequence.progresses); n != 0 {
+			t.Errorf("got %d progresses, want 0", n)
+		}
+	})
+}
+
+func TestSequenceMaxSpan(t *testing.T) {
+
+	r := newSequence(t, time.Minute, verbSteps("create", "get", "delete")...)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	advance(t, r, auditingEvent(t, "create", "alice"), now)
+	advance(t, r, auditingEvent(t, "get", "alice"), now.Add(30*time.Second))
+	advance(t, r, auditingEvent(t, "create", "bob"), now.Add(40*time.Second))
+
+	// The progress of alice is expired, it could not be completed.
+	if _, ok := advance(t, r, auditingEvent(t, "delete", "alice"), now.Add(61*time.Second)); ok {
+		t.Fatal("the sequence longer than the max span should not be completed")
+	}
+	if _, ok := r.sequence.progresses["alice"]; ok {
+		t.Error("the expired progress of alice should be removed")
+	}
+	if _, ok := r.sequence.progresses["bob"]; !ok {
+		t.Error("the progress of bob is not expired")
+	}
+
+	// The sequence within the max span is completed.
+	advance(t, r, auditingEvent(t, "get", "bob"), now.Add(70*time.Second))
+	if key, ok := advance(t, r, auditingEvent(t, "delete", "bob"), now.Add(100*time.Second)); !ok || key != "bob" {
+		t.Fatalf("got key %q, %v, want bob", key, ok)
+	}
+
+	// The expired progresses are removed by the events of other keys.
+	advance(t, r, auditingEvent(t, "create", "carol"), now.Add(110*time.Second))
+	advance(t, r, auditingEvent(t, "create", "dave"), now.Add(200*time.Second))
+	if _, ok := r.sequence.progresses["carol"]; ok || r.sequence.lru.Len() != 1 {
+		t.Errorf("got %d progresses, want the one of dave", r.sequence.lru.Len())
+	}
+}
+
+func TestSequenceMaxKeys(t *testing.T) {
+
+	saved := sequenceMaxKeys
+	sequenceMaxKeys = 2
+	defer func() { sequenceMaxKeys = saved }()
+
+	r := newSequence(t, time.Hour, verbSteps("create", "get", "delete")...)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return now.Add(time.Duration(i) * time.Second) }
+
+	advance(t, r, auditingEvent(t, "create", "alice"), at(0))
+	advance(t, r, auditingEvent(t, "create", "bob"), at(1))
+	// Alice is matched later than bob, so bob is the least recently matched.
+	advance(t, r, auditingEvent(t, "get", "alice"), at(2))
+	advance(t, r, auditingEvent(t, "create", "carol"), at(3))
+
+	if n := len(r.sequence.progresses); n != 2 || r.sequence.lru.Len() != 2 {
+		t.Fatalf("got %d progresses, %d in lru, want 2", n, r.sequence.lru.Len())
+	}
+	if _, ok := r.sequence.progresses["bob"]; ok {
+		t.Error("the progress of bob should be evicted")
+	}
+
+	advance(t, r, auditingEvent(t, "get", "bob"), at(4))
+	if _, ok := advance(t, r, auditingEvent(t, "delete", "bob"), at(5)); ok {
+		t.Error("the evicted progress of bob should not be completed")
+	}
+	if key, ok := advance(t, r, auditingEvent(t, "delete", "alice"), at(6)); !ok || key != "alice" {
+		t.Errorf("got key %q, %v, want alice", key, ok)
+	}
+}
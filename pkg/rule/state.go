@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"reflect"
+	"sync"
+)
+
+// The states of the loaded threshold and sequence rules, the key is `group.name` of rule.
+var (
+	statesMutex sync.Mutex
+	windows     = make(map[string]*window)
+	sequences   = make(map[string]*sequence)
+)
+
+// KeepStates make the threshold and sequence rules keep the counts and progresses of the
+// rules loaded before if the rules are not changed, the states of the other rules are
+// dropped. It is called when the rules are reloaded.
+func KeepStates(rules map[string]Rule) {
+
+	statesMutex.Lock()
+	defer statesMutex.Unlock()
+
+	currentWindows := make(map[string]*window)
+	currentSequences := make(map[string]*sequence)
+	for name, r := range rules {
+		if r.window != nil {
+			if w, ok := windows[name]; ok && reflect.DeepEqual(w.spec, r.window.spec) {
+				r.window = w
+			}
+			currentWindows[name] = r.window
+		}
+
+		if r.sequence != nil {
+			if s, ok := sequences[name]; ok && sameSequence(s, r.sequence) {
+				r.sequence = s
+			}
+			currentSequences[name] = r.sequence
+		}
+
+		rules[name] = r
+	}
+
+	windows, sequences = currentWindows, currentSequences
+}
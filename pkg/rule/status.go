@@ -0,0 +1,98 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	resultsMutex sync.Mutex
+	// The validation results of the last loaded groups, by group name.
+	groupResults map[string]*GroupResult
+
+	// The time every rule matched an event last, by group.name.
+	lastMatches sync.Map
+)
+
+// GroupResult is the validation result of the rules of a group.
+type GroupResult struct {
+	// The generation of the group when it was loaded.
+	Generation int64
+	Rules      []RuleResult
+}
+
+// RuleResult is the validation result of a rule.
+type RuleResult struct {
+	Name  string
+	Valid bool
+	// The condition with the macros, lists and aliases expanded.
+	Condition string
+	// The reason why the rule is invalid.
+	Error string
+}
+
+// setGroupResults record the validation results of the loaded groups, and remove the last match times
+// of the rules which are not loaded any more.
+func setGroupResults(results map[string]*GroupResult) {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+
+	groupResults = results
+
+	loaded := make(map[string]struct{})
+	for group, gr := range results {
+		for _, r := range gr.Rules {
+			loaded[matchKey(group, r.Name)] = struct{}{}
+		}
+	}
+	lastMatches.Range(func(k, _ interface{}) bool {
+		if _, ok := loaded[k.(string)]; !ok {
+			lastMatches.Delete(k)
+		}
+		return true
+	})
+}
+
+// GetGroupResult return the validation result of the group when the rules were loaded last.
+func GetGroupResult(group string) (*GroupResult, bool) {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+
+	gr, ok := groupResults[group]
+	return gr, ok
+}
+
+// RecordMatch record the time the rule matched an event.
+func (r *Rule) RecordMatch(t time.Time) {
+	lastMatches.Store(matchKey(r.Group, r.Name), t)
+}
+
+// GetLastMatchTime return the time the rule of the group matched an event last.
+func GetLastMatchTime(group, name string) (time.Time, bool) {
+	v, ok := lastMatches.Load(matchKey(group, name))
+	if !ok {
+		return time.Time{}, false
+	}
+	return v.(time.Time), true
+}
+
+func matchKey(group, name string) string {
+	return fmt.Sprintf("%s.%s", group, name)
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+)
+
+// Tester evaluates events against the rules in the same way as the ruler, but nothing is exported and
+// no metrics are recorded. The rules are built by the tester, so the thresholds and sequences start
+// empty and keep their states between the events tested by the same tester.
+type Tester struct {
+	group     string
+	results   map[string]*GroupResult
+	byType    map[string][]*Rule
+	sequences []*Rule
+}
+
+// TestResult is the result of an event.
+type TestResult struct {
+	Rules []RuleTestResult `json:"rules"`
+	// The first rule selected by the match mode.
+	Winner string `json:"winner,omitempty"`
+	// The alerts which would be sent.
+	Alerts []TestAlert `json:"alerts,omitempty"`
+}
+
+// RuleTestResult is the result of a rule.
+type RuleTestResult struct {
+	Group string `json:"group"`
+	Name  string `json:"name"`
+	// The condition with the macros, lists and aliases expanded.
+	Condition string `json:"condition,omitempty"`
+	// Whether the condition matches the event, or the sequence is completed by the event.
+	Matched bool `json:"matched"`
+	// Whether the rule is selected by the match mode and its threshold is reached.
+	Fired bool `json:"fired"`
+	// Whether the rule is not evaluated, since it could not be selected by the match mode.
+	Skipped bool `json:"skipped,omitempty"`
+	// The reason why the rule is invalid or failed to evaluate.
+	Error string `json:"error,omitempty"`
+}
+
+// TestAlert is an alert which would be sent.
+type TestAlert struct {
+	Group       string            `json:"group"`
+	Rule        string            `json:"rule"`
+	Severity    string            `json:"severity,omitempty"`
+	Message     string            `json:"message"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NewTester build the rules of the groups, and only the rules of the group are tested if it is not empty.
+// The group is named by name for ClusterRuleGroup, and namespace/name for RuleGroup.
+func NewTester(groups []v1alpha1.ClusterRuleGroup, namespaced []v1alpha1.RuleGroup, group string) *Tester {
+
+	rules, results := buildRules(groups, namespaced)
+	t := &Tester{group: group, results: results, byType: make(map[string][]*Rule)}
+	for eventType, rs := range RulesByType(rules) {
+		for _, r := range rs {
+			if t.selects(r) {
+				t.byType[eventType] = append(t.byType[eventType], r)
+			}
+		}
+	}
+	for _, r := range Sequences(rules) {
+		if t.selects(r) {
+			t.sequences = append(t.sequences, r)
+		}
+	}
+
+	return t
+}
+
+func (t *Tester) selects(r *Rule) bool {
+	return len(t.group) == 0 || r.Group == t.group
+}
+
+// Test evaluate the event at the time, the rules are evaluated by EvaluateEvent as the ruler does.
+func (t *Tester) Test(e *WhizardEvent, now time.Time) *TestResult {
+
+	res := &TestResult{Rules: make([]RuleTestResult, 0)}
+	evs := make(map[*Rule]*Evaluation)
+	EvaluateEvent(t.byType, t.sequences, e, now, func(ev *Evaluation) {
+		evs[ev.Rule] = ev
+	})
+
+	rs := append(append([]*Rule{}, t.byType[typeOfKind(e.Kind)]...), t.sequences...)
+	for _, r := range rs {
+		rr := t.newResult(r)
+		ev, ok := evs[r]
+		if !ok {
+			rr.Skipped = true
+			res.Rules = append(res.Rules, *rr)
+			continue
+		}
+
+		rr.Matched, rr.Fired, rr.Error = ev.Matched, ev.Fired, errorString(ev.Err)
+		if ev.Fired {
+			if len(res.Winner) == 0 && !r.IsSequence() {
+				res.Winner = r.Name
+			}
+			res.Alerts = append(res.Alerts, TestAlert{
+				Group:       r.Group,
+				Rule:        r.Name,
+				Severity:    r.Alerts.Severity,
+				Message:     ev.Alert.Message(),
+				Annotations: ev.Alert.Annotations(),
+			})
+		}
+		res.Rules = append(res.Rules, *rr)
+	}
+
+	res.Rules = append(res.Rules, t.InvalidRules()...)
+	return res
+}
+
+func (t *Tester) newResult(r *Rule) *RuleTestResult {
+
+	rr := &RuleTestResult{Group: r.Group, Name: r.Name}
+	if gr, ok := t.results[r.Group]; ok {
+		for _, result := range gr.Rules {
+			if result.Name == r.Name {
+				rr.Condition = result.Condition
+			}
+		}
+	}
+
+	return rr
+}
+
+// InvalidRules return the results of the invalid rules, which are dropped when building.
+func (t *Tester) InvalidRules() []RuleTestResult {
+
+	var groups []string
+	for group := range t.results {
+		if len(t.group) == 0 || group == t.group {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+
+	var rs []RuleTestResult
+	for _, group := range groups {
+		for _, r := range t.results[group].Rules {
+			if !r.Valid {
+				rs = append(rs, RuleTestResult{Group: group, Name: r.Name, Condition: r.Condition, Error: r.Error})
+			}
+		}
+	}
+
+	return rs
+}
+
+// Fields return the fields of the event which the rules read.
+func (e *WhizardEvent) Fields() Fields {
+	switch e.Kind {
+	case constant.Auditing:
+		return e.Auditing.Fields()
+	case constant.Event:
+		return e.Event.Fields()
+	case constant.Logging:
+		return e.Logging.Fields()
+	default:
+		return MapFields(nil)
+	}
+}
+
+// DecodeEvents decode the body of webhook of the type, auditing, events or logging.
+func DecodeEvents(eventType string, data []byte) ([]*WhizardEvent, error) {
+
+	var es []*WhizardEvent
+	switch eventType {
+	case AuditingType:
+		audits, err := NewAuditing(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range audits {
+			es = append(es, &WhizardEvent{Kind: constant.Auditing, Auditing: a})
+		}
+	case EventsType:
+		events, err := NewEvents(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			es = append(es, &WhizardEvent{Kind: constant.Event, Event: e})
+		}
+	case LoggingType:
+		logs, err := NewLogging(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range logs {
+			es = append(es, &WhizardEvent{Kind: constant.Logging, Logging: l})
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q, must be one of auditing, events or logging", eventType)
+	}
+
+	return es, nil
+}
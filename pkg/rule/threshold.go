@@ -0,0 +1,175 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"container/list"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+)
+
+// The params of message which are only available for the threshold rules.
+const (
+	// ParamCount is the number of matched events of the group within the window.
+	ParamCount = "$count"
+	// ParamWindow is the time window.
+	ParamWindow = "$window"
+	// ParamGroup is the values of the group by fields, such as `User.username=admin`.
+	ParamGroup = "$group"
+)
+
+var thresholdMaxGroups int
+
+func init() {
+	flag.IntVar(&thresholdMaxGroups, "threshold-max-groups", 10000, "The max number of groups counted by a threshold rule, "+
+		"the group least recently matched is evicted when it is exceeded")
+}
+
+// window counts the matched events of a threshold rule over a sliding time window.
+// A window is safe for concurrent use.
+type window struct {
+	spec  v1alpha1.Threshold
+	mutex sync.Mutex
+	// The element of every group in lru.
+	groups map[string]*list.Element
+	// The groups ordered by the last matched time, the front is the latest.
+	lru *list.List
+}
+
+type windowGroup struct {
+	key string
+	// The times of the matched events within the window.
+	times []time.Time
+	last  time.Time
+}
+
+func newWindow(spec *v1alpha1.Threshold) (*window, error) {
+
+	if spec.Count < 1 {
+		return nil, fmt.Errorf("the count of threshold must be greater than 0")
+	}
+	if spec.Window.Duration <= 0 {
+		return nil, fmt.Errorf("the window of threshold must be greater than 0")
+	}
+
+	return &window{
+		spec:   *spec.DeepCopy(),
+		groups: make(map[string]*list.Element),
+		lru:    list.New(),
+	}, nil
+}
+
+// observe record a matched event of the group at time t, and return the number of matched events of
+// the group within the window, true if it reaches the count of threshold, then the group is reset.
+func (w *window) observe(key string, t time.Time) (int, bool) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	start := t.Add(-w.spec.Window.Duration)
+	w.expire(start)
+
+	var g *windowGroup
+	if e, ok := w.groups[key]; ok {
+		g = e.Value.(*windowGroup)
+		w.lru.MoveToFront(e)
+	} else {
+		for len(w.groups) >= thresholdMaxGroups && w.lru.Len() > 0 {
+			w.remove(w.lru.Back())
+		}
+		g = &windowGroup{key: key}
+		w.groups[key] = w.lru.PushFront(g)
+	}
+
+	times := g.times[:0]
+	for _, tm := range g.times {
+		if tm.After(start) {
+			times = append(times, tm)
+		}
+	}
+	g.times = append(times, t)
+	if t.After(g.last) {
+		g.last = t
+	}
+
+	count := len(g.times)
+	if count >= int(w.spec.Count) {
+		w.remove(w.groups[key])
+		return count, true
+	}
+
+	return count, false
+}
+
+// expire remove the groups whose last matched event is out of the window.
+func (w *window) expire(start time.Time) {
+	for e := w.lru.Back(); e != nil; e = w.lru.Back() {
+		if e.Value.(*windowGroup).last.After(start) {
+			return
+		}
+		w.remove(e)
+	}
+}
+
+func (w *window) remove(e *list.Element) {
+	delete(w.groups, e.Value.(*windowGroup).key)
+	w.lru.Remove(e)
+}
+
+// HasThreshold return true if the rule fires only when the matched events reach the count of threshold.
+func (r *Rule) HasThreshold() bool {
+	return r.window != nil
+}
+
+// Observe record the event matched by the rule at time t, and return true if the rule fires.
+// A rule without threshold always fires. The fields returned are used to format the alert message,
+// for the threshold rule, they include `$count`, `$window` and `$group`.
+func (r *Rule) Observe(f Fields, t time.Time) (Fields, bool) {
+
+	if r.window == nil {
+		return f, true
+	}
+
+	var values, group []string
+	for _, path := range r.window.spec.GroupBy {
+		value := ""
+		if v := f.Get(path); v != nil {
+			value = fmt.Sprint(v)
+		}
+		values = append(values, value)
+		group = append(group, fmt.Sprintf("%s=%s", path, value))
+	}
+
+	count, fired := r.window.observe(strings.Join(values, "\x00"), t)
+	if !fired {
+		return f, false
+	}
+
+	return &paramFields{
+		Fields: f,
+		values: map[string]interface{}{
+			ParamCount:  strconv.Itoa(count),
+			ParamWindow: r.window.spec.Window.Duration.String(),
+			ParamGroup:  strings.Join(group, ", "),
+		},
+	}, true
+}
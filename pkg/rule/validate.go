@@ -0,0 +1,172 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+	"whizard-telemetry-ruler/pkg/constant"
+	"whizard-telemetry-ruler/pkg/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apiserver/pkg/apis/audit"
+)
+
+var (
+	placeholderRegex = regexp.MustCompile(`\${(.*?)}`)
+
+	// The types of event which the fields of rules are read from, nil means any field is valid.
+	eventTypes = map[string]reflect.Type{
+		AuditingType: reflect.TypeOf(audit.Event{}),
+		EventsType:   reflect.TypeOf(corev1.Event{}),
+		LoggingType:  nil,
+	}
+
+	kinds      = []string{KindRule, KindMacro, KindList, KindAlias, KindSequence}
+	severities = []string{constant.Info, constant.Warning, constant.ERROR, constant.CRITICAL}
+)
+
+// ValidateGroup validate the group with the loaded groups which it may reference, and return an error
+// for every problem found. The group is named by name for ClusterRuleGroup, and namespace/name for RuleGroup,
+// it must be one of the groups, and it is put before the other groups with the same name.
+func ValidateGroup(group string, groups []v1alpha1.ClusterRuleGroup, namespaced []v1alpha1.RuleGroup) []error {
+
+	// The first group with the name is validated.
+	var spec *v1alpha1.ClusterRuleGroupRuleSpec
+	namespace := ""
+	for i := range groups {
+		if groups[i].Name == group {
+			spec = &groups[i].Spec
+			break
+		}
+	}
+	for i := range namespaced {
+		if spec == nil && fmt.Sprintf("%s/%s", namespaced[i].Namespace, namespaced[i].Name) == group {
+			spec, namespace = &namespaced[i].Spec, namespaced[i].Namespace
+		}
+	}
+	if spec == nil {
+		return []error{fmt.Errorf("rule group %s is not found", group)}
+	}
+
+	var errs []error
+	if _, ok := eventTypes[spec.Type]; !ok {
+		errs = append(errs, fmt.Errorf("spec.type %q is not one of auditing, events or logging", spec.Type))
+	}
+	if err := ValidateMatchMode(spec.MatchMode); err != nil {
+		errs = append(errs, fmt.Errorf("spec.matchMode %s", err))
+	}
+
+	names := make(map[string]bool)
+	for _, r := range spec.Rules {
+		if len(r.Name) == 0 {
+			errs = append(errs, fmt.Errorf("rule name is required"))
+			continue
+		}
+		if names[r.Name] {
+			errs = append(errs, fmt.Errorf("rule %s: duplicate name", r.Name))
+		}
+		names[r.Name] = true
+
+		if !utils.IsExist(kinds, r.Expr.Kind) {
+			errs = append(errs, fmt.Errorf("rule %s: unknown kind %q, must be one of %s", r.Name, r.Expr.Kind, strings.Join(kinds, ", ")))
+			continue
+		}
+		if (r.Expr.Kind == KindRule || r.Expr.Kind == KindSequence) &&
+			len(r.Alerts.Severity) > 0 && !utils.IsExist(severities, r.Alerts.Severity) {
+			errs = append(errs, fmt.Errorf("rule %s: unknown severity %q, must be one of %s", r.Name, r.Alerts.Severity, strings.Join(severities, ", ")))
+		}
+	}
+
+	rules, results := buildRules(groups, namespaced)
+	if gr, ok := results[group]; ok {
+		for _, r := range gr.Rules {
+			if !r.Valid {
+				errs = append(errs, fmt.Errorf("rule %s: %s", r.Name, r.Error))
+			}
+		}
+	}
+
+	for _, pr := range spec.Rules {
+		r := Rule{Rule: pr, Group: group, Namespace: namespace, whizardEventType: spec.Type}
+		for _, err := range r.validatePlaceholders(rules) {
+			errs = append(errs, fmt.Errorf("rule %s: %s", r.Name, err))
+		}
+	}
+
+	return errs
+}
+
+// validatePlaceholders return an error for every placeholder of the message which points at nothing,
+// a placeholder is an alias, a field of event, the nth part of the name, or a param of threshold and sequence.
+func (r *Rule) validatePlaceholders(rules map[string]Rule) []error {
+
+	eventType := r.whizardEventType
+	if r.Sequence != nil && len(r.Sequence.Steps) > 0 {
+		// The message is formatted with the event which completes the sequence.
+		if t := r.Sequence.Steps[len(r.Sequence.Steps)-1].Type; len(t) > 0 {
+			eventType = t
+		}
+	}
+
+	var errs []error
+	for _, s := range placeholderRegex.FindAllStringSubmatch(r.Alerts.Message, -1) {
+		p := s[1]
+		switch {
+		case strings.HasPrefix(p, "$"):
+			if !r.validParam(p) {
+				errs = append(errs, fmt.Errorf("message placeholder %s is not a param of the rule", s[0]))
+			}
+		case r.isAlias(p, rules):
+		case eventTypes[eventType] != nil && !utils.FieldPathValid(eventTypes[eventType], p):
+			errs = append(errs, fmt.Errorf("message placeholder %s is neither an alias nor a field of %s", s[0], eventType))
+		}
+	}
+
+	return errs
+}
+
+func (r *Rule) validParam(p string) bool {
+
+	if index, err := strconv.Atoi(p[1:]); err == nil {
+		return index > 0
+	}
+
+	switch p {
+	case ParamCount, ParamWindow, ParamGroup:
+		return r.Threshold != nil
+	case ParamSteps, ParamKey:
+		return r.Expr.Kind == KindSequence
+	}
+
+	return false
+}
+
+// isAlias return true if the name is an alias which the rule can use, same as SetParams.
+func (r *Rule) isAlias(name string, rules map[string]Rule) bool {
+
+	mr, ok := rules[fmt.Sprintf("%s.%s", r.Group, name)]
+	if !ok || mr.Expr.Kind != KindAlias {
+		mr, ok = rules[name]
+	}
+
+	return ok && mr.Expr.Kind == KindAlias && r.canReference(&mr)
+}
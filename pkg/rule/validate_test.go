@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"whizard-telemetry-ruler/pkg/apis/logging.whizard.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateGroup(t *testing.T) {
+
+	alerting := func(r v1alpha1.Rule, severity, message string) v1alpha1.Rule {
+		r.Alerts = v1alpha1.Alerts{Severity: severity, Message: message}
+		return r
+	}
+	// The loaded groups which the validated group may reference.
+	loaded := newClusterRuleGroup("loaded", AuditingType,
+		v1alpha1.Rule{Name: "deleting", Expr: v1alpha1.Expr{Kind: KindMacro, Macro: `Verb = "delete"`}},
+		v1alpha1.Rule{Name: "user", Expr: v1alpha1.Expr{Kind: KindAlias, Alias: "User.username"}},
+	)
+	other := newRuleGroup("other", "defs", AuditingType,
+		v1alpha1.Rule{Name: "getting", Expr: v1alpha1.Expr{Kind: KindMacro, Macro: `Verb = "get"`}},
+	)
+
+	tests := []struct {
+		name      string
+		eventType string
+		matchMode string
+		rules     []v1alpha1.Rule
+		// The validated group is a RuleGroup in the namespace tenant if it is true.
+		namespaced bool
+		// The substrings of the errors, in order.
+		want []string
+	}{
+		{
+			name: "valid",
+			rules: []v1alpha1.Rule{
+				alerting(newConditionRule("delete", "${loaded.deleting}"), "WARNING", "${loaded.user} deleted ${ObjectRef.Name}"),
+			},
+		},
+		{
+			name:       "valid RuleGroup",
+			namespaced: true,
+			rules:      []v1alpha1.Rule{alerting(newConditionRule("delete", "${loaded.deleting}"), "", "${loaded.user}")},
+		},
+		{
+			name:      "unknown type",
+			eventType: "metrics",
+			rules:     []v1alpha1.Rule{newConditionRule("get", `Verb = "get"`)},
+			want:      []string{`spec.type "metrics"`},
+		},
+		{
+			name:      "unknown match mode",
+			matchMode: "any",
+			rules:     []v1alpha1.Rule{newConditionRule("get", `Verb = "get"`)},
+			want:      []string{"spec.matchMode"},
+		},
+		{
+			name:  "missing name",
+			rules: []v1alpha1.Rule{newConditionRule("", `Verb = "get"`)},
+			want:  []string{"rule name is required"},
+		},
+		{
+			name:  "duplicate name",
+			rules: []v1alpha1.Rule{newConditionRule("get", `Verb = "get"`), newConditionRule("get", `Verb = "list"`)},
+			want:  []string{"rule get: duplicate name"},
+		},
+		{
+			name:  "unknown kind",
+			rules: []v1alpha1.Rule{{Name: "get", Expr: v1alpha1.Expr{Kind: "filter"}}},
+			want:  []string{`rule get: unknown kind "filter"`},
+		},
+		{
+			name:  "unknown severity",
+			rules: []v1alpha1.Rule{alerting(newConditionRule("get", `Verb = "get"`), "FATAL", "")},
+			want:  []string{`rule get: unknown severity "FATAL"`},
+		},
+		{
+			name:  "invalid condition",
+			rules: []v1alpha1.Rule{newConditionRule("get", `Verb = `)},
+			want:  []string{"rule get: "},
+		},
+		{
+			name:  "unresolved reference",
+			rules: []v1alpha1.Rule{newConditionRule("get", "${missing}")},
+			want:  []string{"rule get: ", "missing is not found"},
+		},
+		{
+			name:       "reference to another namespace",
+			namespaced: true,
+			rules:      []v1alpha1.Rule{newConditionRule("get", "${other/defs.getting}")},
+			want:       []string{"other/defs.getting is not found"},
+		},
+		{
+			name:  "unknown placeholder",
+			rules: []v1alpha1.Rule{alerting(newConditionRule("get", `Verb = "get"`), "INFO", "${Missing}")},
+			want:  []string{"rule get: message placeholder ${Missing} is neither an alias nor a field of auditing"},
+		},
+		{
+			name: "param of threshold",
+			rules: []v1alpha1.Rule{
+				func() v1alpha1.Rule {
+					r := alerting(newConditionRule("get", `Verb = "get"`), "INFO", "${$count} in ${$window}")
+					r.Threshold = &v1alpha1.Threshold{Count: 2, Window: metav1.Duration{Duration: time.Minute}}
+					return r
+				}(),
+			},
+		},
+		{
+			name:  "param without threshold",
+			rules: []v1alpha1.Rule{alerting(newConditionRule("get", `Verb = "get"`), "INFO", "${$count}")},
+			want:  []string{"rule get: message placeholder ${$count} is not a param of the rule"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventType := tt.eventType
+			if len(eventType) == 0 {
+				eventType = AuditingType
+			}
+
+			groups := []v1alpha1.ClusterRuleGroup{loaded}
+			namespaced := []v1alpha1.RuleGroup{other}
+			group := "g"
+			if tt.namespaced {
+				g := newRuleGroup("tenant", "g", eventType, tt.rules...)
+				g.Spec.MatchMode = tt.matchMode
+				namespaced = append([]v1alpha1.RuleGroup{g}, namespaced...)
+				group = "tenant/g"
+			} else {
+				g := newClusterRuleGroup("g", eventType, tt.rules...)
+				g.Spec.MatchMode = tt.matchMode
+				groups = append([]v1alpha1.ClusterRuleGroup{g}, groups...)
+			}
+
+			errs := ValidateGroup(group, groups, namespaced)
+			var msgs []string
+			for _, err := range errs {
+				msgs = append(msgs, err.Error())
+			}
+			got := strings.Join(msgs, "\n")
+
+			if len(tt.want) == 0 {
+				if len(errs) > 0 {
+					t.Errorf("got errors:\n%s", got)
+				}
+				return
+			}
+			rest := got
+			for _, w := range tt.want {
+				i := strings.Index(rest, w)
+				if i < 0 {
+					t.Fatalf("got errors:\n%s\nwant %q", got, w)
+				}
+				rest = rest[i+len(w):]
+			}
+		})
+	}
+
+	if errs := ValidateGroup("missing", []v1alpha1.ClusterRuleGroup{loaded}, nil); len(errs) != 1 || !strings.Contains(errs[0].Error(), "not found") {
+		t.Errorf("missing group: got %v", errs)
+	}
+}
@@ -0,0 +1,539 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	// The json fields of struct types, the key is reflect.Type.
+	structFields sync.Map
+	// The marshalers which types implement, the key is reflect.Type.
+	typeMarshalers sync.Map
+)
+
+type marshalers struct {
+	marshaler     bool
+	ptrMarshaler  bool
+	textMarshaler bool
+}
+
+func marshalersOf(t reflect.Type) marshalers {
+
+	if m, ok := typeMarshalers.Load(t); ok {
+		return m.(marshalers)
+	}
+
+	m := marshalers{
+		marshaler:     t.Implements(marshalerType),
+		ptrMarshaler:  t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(marshalerType),
+		textMarshaler: t.Implements(textMarshalerType),
+	}
+	typeMarshalers.Store(t, m)
+	return m
+}
+
+// FieldAccessor reads the fields of a value with the dotted names, such as `ObjectRef.Resource`.
+// The names and values are same as the keys and values of the map flattened from the JSON of
+// the value, that is Flatten(StructToMap(v)), but the fields are read directly without the JSON
+// round trip. The fields which implement json.Marshaler, such as the `RequestObject` of audit
+// event, are only decoded when they are read.
+// A FieldAccessor is not safe for concurrent use.
+type FieldAccessor struct {
+	root reflect.Value
+	// The decoded values of the json.Marshaler fields, the key is the dotted name of the field.
+	decoded map[string]reflect.Value
+}
+
+// NewFieldAccessor create a FieldAccessor of the value, which can be a struct, a map, or a pointer to them.
+func NewFieldAccessor(v interface{}) *FieldAccessor {
+	return &FieldAccessor{
+		root: reflect.ValueOf(v),
+	}
+}
+
+// Get return the value of the field, nil if the field does not exist, or it is an object.
+// The number is returned as float64, and the array is returned as []interface{}.
+func (f *FieldAccessor) Get(name string) interface{} {
+
+	v, ok := f.lookup(name)
+	if !ok {
+		return nil
+	}
+
+	return leafValue(v)
+}
+
+// Exists return true if the value of the field is not nil, or the field is an object which
+// has any field whose value is not nil.
+func (f *FieldAccessor) Exists(name string) bool {
+
+	v, ok := f.lookup(name)
+	if !ok {
+		return f.partialKeyExists(name)
+	}
+
+	return f.hasValue(v, name)
+}
+
+// partialKeyExists return true if the name is the prefix of a map key which contains dot,
+// such as `Annotations.authorization` of the key `authorization.k8s.io/decision`,
+// and the value of the key is not nil.
+func (f *FieldAccessor) partialKeyExists(name string) bool {
+
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] != '.' {
+			continue
+		}
+
+		v, ok := f.lookup(name[:i])
+		if !ok || v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			continue
+		}
+
+		prefix := name[i+1:] + "."
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+
+			if f.hasValue(iter.Value(), join(name[:i], key)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// lookup return the field with the dotted name.
+func (f *FieldAccessor) lookup(name string) (reflect.Value, bool) {
+
+	v := f.resolve(f.root, "")
+	consumed := ""
+	path := name
+	for len(path) > 0 {
+		if !v.IsValid() {
+			return v, false
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			seg, rest := cut(path)
+			field, ok := structField(v, seg)
+			if !ok {
+				return reflect.Value{}, false
+			}
+			v, path = field, rest
+			consumed = join(consumed, seg)
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false
+			}
+
+			// The key of map may contain dot, try the shortest key first.
+			found := false
+			for i := 0; i <= len(path); i++ {
+				if i < len(path) && path[i] != '.' {
+					continue
+				}
+
+				key := reflect.ValueOf(path[:i]).Convert(v.Type().Key())
+				if value := v.MapIndex(key); value.IsValid() {
+					consumed = join(consumed, path[:i])
+					v, path, found = value, strings.TrimPrefix(path[i:], "."), true
+					break
+				}
+			}
+			if !found {
+				return reflect.Value{}, false
+			}
+		default:
+			// The array and the scalar have no field.
+			return reflect.Value{}, false
+		}
+
+		v = f.resolve(v, consumed)
+	}
+
+	return v, true
+}
+
+// resolve dereference the pointer and interface, and decode the json.Marshaler.
+// An invalid value is returned if the value is nil.
+func (f *FieldAccessor) resolve(v reflect.Value, name string) reflect.Value {
+
+	for {
+		if !v.IsValid() {
+			return v
+		}
+
+		if m, ok := marshaler(v); ok {
+			if d, ok := f.decoded[name]; ok {
+				return d
+			}
+
+			d := decode(m)
+			if f.decoded == nil {
+				f.decoded = make(map[string]reflect.Value)
+			}
+			f.decoded[name] = d
+			return d
+		}
+
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		default:
+			return v
+		}
+	}
+}
+
+// hasValue return true if the value is not nil, or it is an object which has any field whose value is not nil.
+func (f *FieldAccessor) hasValue(v reflect.Value, name string) bool {
+
+	v = f.resolve(v, name)
+	if !isObject(v) {
+		return leafValue(v) != nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, fi := range jsonFields(v.Type()) {
+			field, ok := fieldByIndex(v, fi.index)
+			if !ok || (fi.omitEmpty && isEmptyValue(field)) {
+				continue
+			}
+			if f.hasValue(field, join(name, fi.name)) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if f.hasValue(iter.Value(), join(name, iter.Key().String())) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func marshaler(v reflect.Value) (json.Marshaler, bool) {
+
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+
+	m := marshalersOf(v.Type())
+	if m.marshaler {
+		return v.Interface().(json.Marshaler), true
+	}
+
+	// Same as encoding/json, the method of pointer receiver is called when the value is addressable.
+	if m.ptrMarshaler && v.CanAddr() {
+		return v.Addr().Interface().(json.Marshaler), true
+	}
+
+	return nil, false
+}
+
+func decode(m json.Marshaler) reflect.Value {
+
+	bs, err := m.MarshalJSON()
+	if err != nil {
+		return reflect.Value{}
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(bs, &value); err != nil || value == nil {
+		return reflect.Value{}
+	}
+
+	return reflect.ValueOf(value)
+}
+
+// leafValue return the value which is same as the value decoded from the JSON.
+func leafValue(v reflect.Value) interface{} {
+
+	if !v.IsValid() {
+		return nil
+	}
+
+	if marshalersOf(v.Type()).textMarshaler {
+		if bs, err := v.Interface().(encoding.TextMarshaler).MarshalText(); err == nil {
+			return string(bs)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if value, ok := v.Interface().([]interface{}); ok {
+			return value
+		}
+
+		// The elements of array are converted by the JSON round trip.
+		bs, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil
+		}
+		var value interface{}
+		if err := json.Unmarshal(bs, &value); err != nil {
+			return nil
+		}
+		return value
+	default:
+		// The object is flattened, it has no value.
+		return nil
+	}
+}
+
+func isObject(v reflect.Value) bool {
+	return v.IsValid() && (v.Kind() == reflect.Struct || v.Kind() == reflect.Map) &&
+		!marshalersOf(v.Type()).textMarshaler
+}
+
+// Same as encoding/json, decide whether the field with omitempty is omitted.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+type jsonField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structField return the field of struct with the json name, the omitted field is not found.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+
+	for _, fi := range jsonFields(v.Type()) {
+		if fi.name != name {
+			continue
+		}
+
+		field, ok := fieldByIndex(v, fi.index)
+		if !ok || (fi.omitEmpty && isEmptyValue(field)) {
+			return reflect.Value{}, false
+		}
+		return field, true
+	}
+
+	return reflect.Value{}, false
+}
+
+// fieldByIndex return the nested field, false if it is in a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// jsonFields return the fields of the struct type which are encoded by encoding/json,
+// the fields of embedded struct without json name are promoted.
+func jsonFields(t reflect.Type) []jsonField {
+
+	if fs, ok := structFields.Load(t); ok {
+		return fs.([]jsonField)
+	}
+
+	var fields []jsonField
+	names := make(map[string]bool)
+	current := []jsonField{{index: nil}}
+	types := []reflect.Type{t}
+	for len(current) > 0 {
+		var next []jsonField
+		var nextTypes []reflect.Type
+		level := make(map[string]bool)
+		for i, parent := range current {
+			st := types[i]
+			for j := 0; j < st.NumField(); j++ {
+				sf := st.Field(j)
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+
+				name, opts := tag, ""
+				if idx := strings.Index(tag, ","); idx >= 0 {
+					name, opts = tag[:idx], tag[idx+1:]
+				}
+
+				index := append(append([]int{}, parent.index...), j)
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+
+				if sf.Anonymous && len(name) == 0 && ft.Kind() == reflect.Struct {
+					next = append(next, jsonField{index: index})
+					nextTypes = append(nextTypes, ft)
+					continue
+				}
+
+				if len(sf.PkgPath) > 0 {
+					// Unexported field.
+					continue
+				}
+
+				if len(name) == 0 {
+					name = sf.Name
+				}
+
+				// The field of shallower depth dominates.
+				if names[name] || level[name] {
+					continue
+				}
+				level[name] = true
+				fields = append(fields, jsonField{
+					name:      name,
+					index:     index,
+					omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+				})
+			}
+		}
+
+		for name := range level {
+			names[name] = true
+		}
+		current, types = next, nextTypes
+	}
+
+	structFields.Store(t, fields)
+	return fields
+}
+
+func cut(path string) (string, string) {
+	if i := strings.Index(path, "."); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+func join(prefix, name string) string {
+	if len(prefix) == 0 {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// FieldPathValid return true if the dotted name could be a field of the type, it is used to
+// validate the names before there is any value. The fields of maps, interfaces and json.Marshalers
+// are unknown, so any name of them is valid. A segment can select the elements of an array, such as `ports[*]`.
+func FieldPathValid(t reflect.Type, name string) bool {
+
+	path := name
+	for len(path) > 0 {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if m := marshalersOf(t); m.marshaler || m.ptrMarshaler {
+			return true
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			seg, rest := cut(path)
+			selected := false
+			if i := strings.Index(seg, "["); i >= 0 {
+				seg, selected = seg[:i], true
+			}
+			found := false
+			for _, fi := range jsonFields(t) {
+				if fi.name == seg {
+					t, path, found = t.FieldByIndex(fi.index).Type, rest, true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+			if selected {
+				for t.Kind() == reflect.Ptr {
+					t = t.Elem()
+				}
+				if m := marshalersOf(t); m.marshaler || m.ptrMarshaler {
+					return true
+				}
+				switch t.Kind() {
+				case reflect.Slice, reflect.Array:
+					t = t.Elem()
+				case reflect.Map, reflect.Interface:
+					return true
+				default:
+					return false
+				}
+			}
+		case reflect.Map, reflect.Interface:
+			return true
+		default:
+			return false
+		}
+	}
+
+	return true
+}
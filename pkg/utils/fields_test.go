@@ -0,0 +1,208 @@
+/*
+Copyright 2023 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apiserver/pkg/apis/audit"
+)
+
+const testAuditing = `{
+	"AuditID": "0b0f5c1e-7d4b-4a51-a0a4-8d1f0e2f4a3b",
+	"Level": "RequestResponse",
+	"Stage": "ResponseComplete",
+	"RequestURI": "/api/v1/namespaces/default/pods",
+	"Verb": "create",
+	"User": {"username": "admin", "groups": ["system:authenticated"], "extra": {"scopes.authorization.k8s.io": ["user:full"]}},
+	"SourceIPs": ["10.0.0.1"],
+	"ObjectRef": {"Resource": "pods", "Namespace": "default", "Name": "nginx", "APIVersion": "v1"},
+	"ResponseStatus": {"code": 201, "metadata": {}},
+	"RequestObject": {
+		"kind": "Pod",
+		"apiVersion": "v1",
+		"metadata": {"name": "nginx", "labels": {"app.kubernetes.io/name": "nginx"}},
+		"spec": {"hostNetwork": true, "containers": [{"name": "nginx", "ports": [{"hostPort": 80}]}]}
+	},
+	"RequestReceivedTimestamp": "2023-01-01T00:00:00.000000Z",
+	"StageTimestamp": "2023-01-01T00:00:00.100000Z",
+	"Annotations": {"authorization.k8s.io/decision": "allow", "authorization.k8s.io/reason": ""}
+}`
+
+const testEvent = `{
+	"metadata": {"name": "nginx.17", "namespace": "default", "creationTimestamp": "2023-01-01T00:00:00Z"},
+	"involvedObject": {"kind": "Pod", "namespace": "default", "name": "nginx", "fieldPath": "spec.containers{nginx}"},
+	"reason": "BackOff",
+	"message": "Back-off restarting failed container",
+	"source": {"component": "kubelet", "host": "node1"},
+	"firstTimestamp": "2023-01-01T00:00:00Z",
+	"lastTimestamp": "2023-01-01T00:05:00Z",
+	"count": 5,
+	"type": "Warning"
+}`
+
+const testLogging = `{
+	"date": 1672531200.5,
+	"log": "panic: runtime error\n",
+	"stream": "stderr",
+	"time": "2023-01-01T00:00:00.5Z",
+	"kubernetes": {
+		"namespace_name": "default",
+		"pod_name": "nginx",
+		"container_name": "nginx",
+		"host": "node1",
+		"labels": {"app.kubernetes.io/name": "nginx", "pod-template-hash": "abc"},
+		"annotations": {}
+	},
+	"empty": null
+}`
+
+// flattened return the fields of the value by the JSON round trip, as they were read before FieldAccessor.
+func flattened(t *testing.T, v interface{}) map[string]interface{} {
+
+	m, err := StructToMap(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Flatten(m)
+}
+
+// TestFieldAccessorSameAsFlatten compare the values of FieldAccessor with the values of Flatten(StructToMap(v)),
+// for every flattened field of the fixtures and the dotted names which the rules read.
+func TestFieldAccessorSameAsFlatten(t *testing.T) {
+
+	auditing := &audit.Event{}
+	if err := json.Unmarshal([]byte(testAuditing), auditing); err != nil {
+		t.Fatal(err)
+	}
+	var auditings []audit.Event
+	data, err := ioutil.ReadFile("../test/auditing.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &auditings); err != nil {
+		t.Fatal(err)
+	}
+	event := &corev1.Event{}
+	if err := json.Unmarshal([]byte(testEvent), event); err != nil {
+		t.Fatal(err)
+	}
+	logging := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(testLogging), &logging); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value interface{}
+		names []string
+	}{
+		{
+			name:  "auditing",
+			value: auditing,
+			names: []string{
+				"Verb",
+				"User.username",
+				"User.groups",
+				"User.extra.scopes.authorization.k8s.io",
+				"SourceIPs",
+				"ObjectRef.Resource",
+				"ObjectRef.Namespace",
+				"ObjectRef.Name",
+				"ObjectRef.Subresource",
+				"ResponseStatus.code",
+				"RequestObject.kind",
+				"RequestObject.spec.hostNetwork",
+				"RequestObject.spec.containers",
+				"RequestObject.metadata.labels.app.kubernetes.io/name",
+				"RequestObject.spec.dnsPolicy",
+				"ResponseObject.kind",
+				"RequestReceivedTimestamp",
+				"Annotations.authorization.k8s.io/decision",
+				"Annotations.authorization",
+				"ObjectRef",
+				"Unknown",
+				"Unknown.field",
+			},
+		},
+		{
+			name:  "auditing.json",
+			value: &auditings[0],
+			names: []string{"Verb", "User.username", "ObjectRef.Resource", "ObjectRef.Name", "ResponseStatus.code", "RequestObject.kind"},
+		},
+		{
+			name:  "events",
+			value: event,
+			names: []string{
+				"reason",
+				"type",
+				"count",
+				"message",
+				"involvedObject.kind",
+				"involvedObject.namespace",
+				"involvedObject.name",
+				"involvedObject.Name",
+				"source.host",
+				"metadata.namespace",
+				"metadata.labels",
+				"lastTimestamp",
+				"eventTime",
+				"series",
+			},
+		},
+		{
+			name:  "logging",
+			value: logging,
+			names: []string{
+				"log",
+				"stream",
+				"date",
+				"kubernetes.namespace_name",
+				"kubernetes.pod_name",
+				"kubernetes.labels.app.kubernetes.io/name",
+				"kubernetes.labels.pod-template-hash",
+				"kubernetes.annotations",
+				"kubernetes.labels.app",
+				"empty",
+				"missing",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flat := flattened(t, tt.value)
+			accessor := NewFieldAccessor(tt.value)
+
+			names := append([]string{}, tt.names...)
+			for k := range flat {
+				names = append(names, k)
+			}
+
+			for _, name := range names {
+				if got, want := accessor.Get(name), flat[name]; !reflect.DeepEqual(got, want) {
+					t.Errorf("Get(%q): got %#v, want %#v", name, got, want)
+				}
+			}
+		})
+	}
+}
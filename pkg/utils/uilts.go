@@ -19,7 +19,9 @@ package utils
 import (
 	"bytes"
 	"encoding/json"
+	"os"
 	"strings"
+	"whizard-telemetry-ruler/pkg/constant"
 )
 
 func ToJsonString(value interface{}) (string, error) {
@@ -123,3 +125,13 @@ func MapToStruct(mv map[string]interface{}, v interface{}) error {
 
 	return nil
 }
+
+// GetNamespace return the namespace which the ruler running in.
+func GetNamespace() string {
+	ns := os.Getenv("NAMESPACE")
+	if len(ns) == 0 {
+		ns = constant.DefaultNamespace
+	}
+
+	return ns
+}